@@ -1,14 +1,16 @@
 package cmd
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"os"
 	"os/exec"
+	"strings"
 
 	"github.com/fatih/color"
 	"github.com/spf13/cobra"
 
-	"github.com/yasomaru/git-wt/internal/config"
 	"github.com/yasomaru/git-wt/internal/git"
 )
 
@@ -17,39 +19,174 @@ var addCmd = &cobra.Command{
 	Short: "Create a new worktree",
 	Long: `Create a new worktree with automatic path resolution and branch management.
 
-If the branch already exists, it checks it out in the new worktree.
-If it doesn't exist, a new branch is created from the base branch.`,
+If the branch already exists, it checks it out in the new worktree, with
+a warning if it has diverged from the remote branch of the same name.
+Without --base, a branch that only exists on a remote, e.g. as
+origin/<branch>, is created locally and tracks it; remotes are searched in
+the order of git.remotes, origin first, or only --remote, and --fetch
+fetches them first. --no-track creates it without tracking. Otherwise a new
+branch is created from the base branch, tracking it with --track.
+
+With --submodules or submodules.update, submodules are initialised and
+updated recursively in the new worktree. Submodules the main worktree has
+already cloned are cloned from its module repositories unless
+submodules.reuse_objects is false.
+
+--sparse checks out only the directories of a sparse-checkout profile
+defined in the [sparse] table of the configuration.`,
 	Args: cobra.ExactArgs(1),
 	Example: `  git wt add feature-auth
   git wt add feature-auth -b main
-  git wt add hotfix-123 -b release/v2`,
+  git wt add hotfix-123 -b release/v2
+  git wt add feature-x --fetch --remote upstream
+  git wt add feature-auth --submodules
+  git wt add feature-ui --sparse frontend`,
 	RunE: runAdd,
 }
 
-var addBase string
+var (
+	addBase       string
+	addSubmodules bool
+	addSparse     string
+	addTrack      bool
+	addNoTrack    bool
+	addRemote     string
+	addFetch      bool
+)
 
 func init() {
 	addCmd.Flags().StringVarP(&addBase, "base", "b", "", "base branch to create from (default: current HEAD)")
+	addCmd.Flags().BoolVar(&addSubmodules, "submodules", false, "initialise and update submodules (default: submodules.update)")
+	addCmd.Flags().StringVar(&addSparse, "sparse", "", "only check out the directories of this sparse-checkout profile")
+	addCmd.Flags().BoolVar(&addTrack, "track", false, "track the remote branch or --base (default for remote branches)")
+	addCmd.Flags().BoolVar(&addNoTrack, "no-track", false, "do not track the branch it is created from")
+	addCmd.Flags().StringVar(&addRemote, "remote", "", "only look for the branch on this remote")
+	addCmd.Flags().BoolVar(&addFetch, "fetch", false, "fetch the remotes before looking for the branch")
+	addCmd.MarkFlagsMutuallyExclusive("track", "no-track")
 	rootCmd.AddCommand(addCmd)
 }
 
 func runAdd(cmd *cobra.Command, args []string) error {
+	ctx := cmd.Context()
 	branch := args[0]
 
-	repoRoot, err := git.RepoRoot("")
+	repo, err := openRepo(ctx)
 	if err != nil {
-		return fmt.Errorf("not a git repository")
+		return err
 	}
 
-	cfg := config.LoadForRepo(repoRoot)
-	targetPath := cfg.WorktreePath(repoRoot, branch)
+	targetPath := repo.cfg.WorktreePath(repo.root, branch)
 
 	// Check if path already exists
 	if _, err := os.Stat(targetPath); err == nil {
 		return fmt.Errorf("path already exists: %s", targetPath)
 	}
 
-	if err := git.AddWorktree(repoRoot, targetPath, branch, addBase); err != nil {
+	var patterns []string
+	if addSparse != "" {
+		var ok bool
+		patterns, ok = repo.cfg.Sparse[addSparse]
+		if !ok || len(patterns) == 0 {
+			return fmt.Errorf("unknown sparse-checkout profile %q (define it under [sparse] in .git-wt.toml)", addSparse)
+		}
+	}
+
+	remotes := repo.remotes(ctx)
+	if addRemote != "" {
+		remotes = []string{addRemote}
+	}
+	if addFetch {
+		// Fetching may take longer than git.timeout allows for a single
+		// command.
+		runner := newRunner(0)
+		for _, remote := range remotes {
+			fmt.Printf("  Fetching %s\n", remote)
+			if err := git.Fetch(ctx, runner, repo.root, remote); err != nil {
+				return fmt.Errorf("failed to fetch %s: %s", remote, git.Describe(err))
+			}
+		}
+	}
+	remote, remoteRef := findRemoteBranch(ctx, repo, branch, remotes)
+	if addBase == "" && remoteRef == "" {
+		if addRemote != "" {
+			return fmt.Errorf("branch %q not found on remote %q", branch, addRemote)
+		}
+		if addTrack {
+			return fmt.Errorf("no remote branch %q to track", branch)
+		}
+	}
+
+	var details []string
+	base, tracking, created := addBase, "", false
+	// An existing branch only tracks the remote branch once its worktree has
+	// been added, so that a failed add leaves its config untouched.
+	setUpstream := false
+	switch {
+	case git.BranchExists(ctx, repo.runner, repo.root, branch):
+		if remoteRef != "" {
+			warnDiverged(ctx, repo, branch, remoteRef)
+			setUpstream = addTrack
+		}
+	case addBase == "" && remoteRef != "":
+		// The branch only exists on a remote.
+		if err := git.CreateBranch(ctx, repo.runner, repo.root, branch, remoteRef, !addNoTrack); err != nil {
+			return fmt.Errorf("failed to create branch from %s: %s", remoteRef, git.Describe(err))
+		}
+		created = true
+		details = append(details, "from "+remoteRef)
+		if !addNoTrack {
+			tracking = remoteRef
+		}
+	case addBase != "":
+		details = append(details, "based on "+addBase)
+		if addTrack || addNoTrack {
+			if err := git.CreateBranch(ctx, repo.runner, repo.root, branch, addBase, addTrack); err != nil {
+				return fmt.Errorf("failed to create branch from %s: %s", addBase, git.Describe(err))
+			}
+			created = true
+			if addTrack {
+				tracking = addBase
+			}
+		}
+	default:
+		// The root is the main worktree; new branches start from the HEAD of
+		// the worktree the command runs in.
+		if head, err := git.HeadCommit(ctx, repo.runner, ""); err == nil {
+			base = head
+		}
+	}
+
+	if addSparse != "" {
+		err = git.AddSparseWorktree(ctx, repo.runner, repo.root, targetPath, branch, base, patterns)
+	} else {
+		err = git.AddWorktree(ctx, repo.runner, repo.root, targetPath, branch, base)
+	}
+	if err != nil && created {
+		_ = git.DeleteBranch(context.WithoutCancel(ctx), repo.runner, repo.root, branch)
+	}
+	if err == nil && setUpstream {
+		if err := git.SetBranchUpstream(ctx, repo.runner, repo.root, branch, remote, "refs/heads/"+branch); err != nil {
+			color.Yellow("  Warning: could not track %s: %s", remoteRef, git.Describe(err))
+		} else {
+			tracking = remoteRef
+		}
+	}
+	if tracking != "" {
+		details = append(details, "tracking "+tracking)
+	}
+	if addSparse != "" {
+		details = append(details, "sparse profile "+addSparse)
+	}
+	ev := git.Event{Action: git.ActionAdd, Branch: branch, Path: targetPath, Detail: strings.Join(details, ", ")}
+	if err != nil {
+		ev.Error = git.Describe(err)
+	}
+	repo.logEvent(ctx, ev)
+	if err != nil {
+		var gitErr *git.GitError
+		if errors.As(err, &gitErr) && gitErr.Kind == git.KindBranchCheckedOut {
+			return fmt.Errorf("branch %q is already checked out in another worktree", branch)
+		}
 		return err
 	}
 
@@ -57,15 +194,43 @@ func runAdd(cmd *cobra.Command, args []string) error {
 	success.Printf("  Created worktree\n")
 	fmt.Printf("  Branch: %s\n", color.CyanString(branch))
 	fmt.Printf("  Path:   %s\n", targetPath)
+	if tracking != "" {
+		fmt.Printf("  Tracking: %s\n", tracking)
+	}
+	if addSparse != "" {
+		fmt.Printf("  Sparse: %s (%s)\n", addSparse, strings.Join(repo.cfg.Sparse[addSparse], ", "))
+	}
+
+	// Submodules are checked out before the hook, which may need them.
+	updateSubmodules := repo.cfg.Submodules.Update
+	if cmd.Flags().Changed("submodules") {
+		updateSubmodules = addSubmodules
+	}
+	if updateSubmodules {
+		// Cloning submodules may take longer than git.timeout allows for a
+		// single command.
+		subs, err := git.UpdateSubmodules(ctx, newRunner(0), targetPath, repo.cfg.Submodules.ReuseObjects)
+		if err != nil {
+			color.Yellow("  Warning: submodule update failed: %s", git.Describe(err))
+		} else if len(subs) > 0 {
+			fmt.Printf("  Submodules: %d updated\n", len(subs))
+		}
+	}
 
 	// Run post-add hook
-	if cfg.Hooks.PostAdd != "" {
-		fmt.Printf("  Running: %s\n", color.YellowString(cfg.Hooks.PostAdd))
-		hookCmd := exec.Command("sh", "-c", cfg.Hooks.PostAdd)
+	if repo.cfg.Hooks.PostAdd != "" {
+		fmt.Printf("  Running: %s\n", color.YellowString(repo.cfg.Hooks.PostAdd))
+		hookCmd := exec.Command("sh", "-c", repo.cfg.Hooks.PostAdd)
 		hookCmd.Dir = targetPath
 		hookCmd.Stdout = os.Stdout
 		hookCmd.Stderr = os.Stderr
-		if err := hookCmd.Run(); err != nil {
+		err := hookCmd.Run()
+		ev := git.Event{Action: git.ActionHook, Branch: branch, Path: targetPath, Detail: "post_add: " + repo.cfg.Hooks.PostAdd}
+		if err != nil {
+			ev.Error = err.Error()
+		}
+		repo.logEvent(ctx, ev)
+		if err != nil {
 			color.Yellow("  Warning: post_add hook failed: %v", err)
 		}
 	}
@@ -73,3 +238,25 @@ func runAdd(cmd *cobra.Command, args []string) error {
 	fmt.Printf("\n  cd %s\n", targetPath)
 	return nil
 }
+
+// findRemoteBranch returns the first of remotes that has branch, and the
+// short name of its remote-tracking ref, e.g. "origin/feature". Both are
+// empty if no remote has it.
+func findRemoteBranch(ctx context.Context, repo *repository, branch string, remotes []string) (remote, ref string) {
+	for _, remote := range remotes {
+		if ref, ok := git.RemoteTrackingRef(ctx, repo.runner, repo.root, remote, branch); ok {
+			return remote, ref
+		}
+	}
+	return "", ""
+}
+
+// warnDiverged warns if the local branch and its namesake on a remote both
+// have commits the other lacks, so that neither can be fast-forwarded.
+func warnDiverged(ctx context.Context, repo *repository, branch, remoteRef string) {
+	ahead, behind, err := git.Divergence(ctx, repo.runner, repo.root, branch, remoteRef)
+	if err != nil || ahead == 0 || behind == 0 {
+		return
+	}
+	color.Yellow("  Warning: %s and %s have diverged (%d local and %d remote commits)", branch, remoteRef, ahead, behind)
+}
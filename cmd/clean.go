@@ -1,15 +1,12 @@
 package cmd
 
 import (
-	"bufio"
 	"fmt"
-	"os"
 	"strings"
 
 	"github.com/fatih/color"
 	"github.com/spf13/cobra"
 
-	"github.com/yasomaru/git-wt/internal/config"
 	"github.com/yasomaru/git-wt/internal/git"
 )
 
@@ -19,12 +16,24 @@ var cleanCmd = &cobra.Command{
 	Long: `Identify and remove worktrees that are no longer needed.
 
 By default, shows candidates interactively for confirmation.
-Use --merged to target only branches merged into the default branch.
-Use --stale to target branches inactive for a specified number of days.`,
+Use --merged to target only branches merged into the default branch, or
+into one of cleanup.merge_targets.
+Use --stale to target branches inactive for a specified number of days.
+Use --gone to target branches whose upstream was deleted on the remote.
+Without flags, worktrees whose directory no longer exists are pruned too.
+Locked worktrees are skipped unless --include-locked is given. Worktrees
+in the middle of a rebase, merge, cherry-pick, revert or bisect are always
+skipped.
+
+Local changes in a removed worktree are saved under refs/wt-backup/ first
+and can be restored with 'git stash apply <ref>'. With cleanup.on_dirty set
+to "refuse", dirty worktrees are kept unless --force is given.`,
 	Example: `  git wt clean              # interactive cleanup
   git wt clean --merged     # remove merged worktrees
   git wt clean --stale 30   # remove worktrees inactive for 30+ days
-  git wt clean --dry-run    # preview only, no changes`,
+  git wt clean --gone       # remove worktrees whose upstream is gone
+  git wt clean --dry-run    # preview only, no changes
+  git wt clean --merged --include-locked`,
 	RunE: runClean,
 }
 
@@ -33,41 +42,37 @@ var (
 	cleanStaleDays int
 	cleanDryRun    bool
 	cleanForce     bool
+	cleanLocked    bool
+	cleanGone      bool
 )
 
 func init() {
 	cleanCmd.Flags().BoolVar(&cleanMerged, "merged", false, "remove worktrees with merged branches")
 	cleanCmd.Flags().IntVar(&cleanStaleDays, "stale", 0, "remove worktrees inactive for N days")
+	cleanCmd.Flags().BoolVar(&cleanGone, "gone", false, "remove worktrees whose upstream branch is gone")
 	cleanCmd.Flags().BoolVar(&cleanDryRun, "dry-run", false, "preview candidates without removing")
-	cleanCmd.Flags().BoolVarP(&cleanForce, "force", "f", false, "skip confirmation prompt")
+	cleanCmd.Flags().BoolVarP(&cleanForce, "force", "f", false, "skip confirmation prompt and discard local changes refused by cleanup.on_dirty")
+	cleanCmd.Flags().BoolVar(&cleanLocked, "include-locked", false, "also remove locked worktrees")
 	rootCmd.AddCommand(cleanCmd)
 }
 
 func runClean(cmd *cobra.Command, args []string) error {
-	repoRoot, err := git.RepoRoot("")
+	ctx := cmd.Context()
+	repo, err := openRepo(ctx)
 	if err != nil {
-		return fmt.Errorf("not a git repository")
+		return err
 	}
 
-	cfg := config.LoadForRepo(repoRoot)
-
-	worktrees, err := git.ListWorktrees(repoRoot)
+	worktrees, defaultBranch, err := repo.loadWorktrees(ctx)
 	if err != nil {
 		return err
 	}
 
-	defaultBranch, _ := git.DefaultBranch(repoRoot)
-
-	// Enrich all worktrees
-	for i := range worktrees {
-		git.EnrichWorktree(&worktrees[i], defaultBranch)
-	}
-
 	// Determine effective stale days threshold
 	staleDays := cleanStaleDays
-	hasExplicitFlags := cleanMerged || cleanStaleDays > 0
+	hasExplicitFlags := cleanMerged || cleanStaleDays > 0 || cleanGone
 	if !hasExplicitFlags {
-		staleDays = cfg.Cleanup.StaleDays
+		staleDays = repo.cfg.Cleanup.StaleDays
 	}
 
 	type candidate struct {
@@ -77,12 +82,21 @@ func runClean(cmd *cobra.Command, args []string) error {
 
 	// Filter candidates
 	var candidates []candidate
+	var busy []git.Worktree
 	for _, wt := range worktrees {
 		if wt.IsBare || wt.IsCurrent {
 			continue
 		}
+		// Locked worktrees are protected unless explicitly included.
+		if wt.IsLocked && !cleanLocked {
+			continue
+		}
+		// Never remove a worktree whose local changes could not be inspected.
+		if wt.StatusErr != nil {
+			continue
+		}
 		branch := wt.BranchShort()
-		if branch == defaultBranch {
+		if branch != "" && branch == defaultBranch {
 			continue
 		}
 
@@ -91,21 +105,36 @@ func runClean(cmd *cobra.Command, args []string) error {
 		if hasExplicitFlags {
 			// Explicit flags: only match requested criteria
 			if cleanMerged && wt.IsMerged {
-				reasons = append(reasons, "merged")
+				reasons = append(reasons, wt.MergedText())
 			}
 			if cleanStaleDays > 0 && wt.InactiveDays() >= staleDays {
 				reasons = append(reasons, fmt.Sprintf("%dd inactive", wt.InactiveDays()))
 			}
+			if cleanGone && wt.Upstream == git.UpstreamGone {
+				reasons = append(reasons, "upstream gone")
+			}
 		} else {
-			// No flags: show both merged and stale (using config threshold)
+			// No flags: show merged, stale (using config threshold) and
+			// prunable worktrees whose directory is gone
+			if wt.IsPrunable {
+				reasons = append(reasons, "prunable")
+			}
 			if wt.IsMerged {
-				reasons = append(reasons, "merged")
+				reasons = append(reasons, wt.MergedText())
 			}
 			if staleDays > 0 && wt.InactiveDays() >= staleDays {
 				reasons = append(reasons, fmt.Sprintf("%dd inactive", wt.InactiveDays()))
 			}
+			if repo.cfg.Cleanup.IncludeGone && wt.Upstream == git.UpstreamGone {
+				reasons = append(reasons, "upstream gone")
+			}
 		}
 
+		// A rebase or similar operation in progress would be lost.
+		if len(reasons) > 0 && wt.Operation != git.OpNone {
+			busy = append(busy, wt)
+			continue
+		}
 		if len(reasons) > 0 {
 			candidates = append(candidates, candidate{
 				worktree: wt,
@@ -114,10 +143,14 @@ func runClean(cmd *cobra.Command, args []string) error {
 		}
 	}
 
+	for _, wt := range busy {
+		color.Yellow("  Skipping %s: %s; finish or abort it first", wt.BranchShort(), wt.OperationText())
+	}
+
 	if len(candidates) == 0 {
 		color.Green("  No worktrees to clean up.")
-		if cfg.Cleanup.AutoPrune {
-			_ = git.PruneWorktrees(repoRoot)
+		if repo.cfg.Cleanup.AutoPrune {
+			_ = git.PruneWorktrees(ctx, repo.runner, repo.root)
 		}
 		return nil
 	}
@@ -128,6 +161,9 @@ func runClean(cmd *cobra.Command, args []string) error {
 		wt := c.worktree
 		branch := wt.BranchShort()
 		tags := []string{c.reason}
+		if wt.IsLocked {
+			tags = append(tags, color.CyanString("locked"))
+		}
 		if !wt.IsClean() {
 			tags = append(tags, color.YellowString(wt.StatusText()))
 		}
@@ -146,36 +182,68 @@ func runClean(cmd *cobra.Command, args []string) error {
 	}
 
 	// Confirm
-	if !cleanForce {
-		fmt.Print("  Remove these worktrees? (y/N): ")
-		reader := bufio.NewReader(os.Stdin)
-		answer, _ := reader.ReadString('\n')
-		answer = strings.TrimSpace(strings.ToLower(answer))
-		if answer != "y" && answer != "yes" {
-			fmt.Println("  Cancelled.")
-			return nil
-		}
+	if !cleanForce && !confirm(ctx, "Remove these worktrees?") {
+		fmt.Println("  Cancelled.")
+		return ctx.Err()
 	}
 
 	// Remove
 	removed := 0
+	var prunable []string
 	for _, c := range candidates {
 		wt := c.worktree
 		branch := wt.BranchShort()
-		deleteBranch := wt.IsMerged
-		if err := git.RemoveWorktree(repoRoot, wt.Path, deleteBranch); err != nil {
-			color.Red("  Failed to remove %s: %v", branch, err)
+		if wt.IsPrunable {
+			// Nothing left on disk; the administrative entry is pruned below.
+			prunable = append(prunable, branch)
 			continue
 		}
+		opts := repo.removeOptions(wt, cleanForce)
+		opts.Force = cleanLocked
+		rm, err := repo.removeWorktree(ctx, wt, opts)
+		if rm.Backup != "" {
+			fmt.Printf("  Saved local changes of %s to %s\n", branch, color.CyanString(rm.Backup))
+			fmt.Printf("  Restore them with: git stash apply %s\n", rm.Backup)
+		}
+		if err != nil && rm.RemovedAt.IsZero() {
+			color.Red("  Failed to remove %s: %s", branch, worktreeErrorMessage(err))
+			continue
+		}
+		if err != nil {
+			color.Yellow("  Warning: %s", err)
+		}
 		color.Green("  Removed: %s", branch)
 		removed++
 	}
 
 	// Prune
-	if cfg.Cleanup.AutoPrune {
-		_ = git.PruneWorktrees(repoRoot)
+	if len(prunable) > 0 {
+		if err := git.PruneWorktrees(ctx, repo.runner, repo.root); err != nil {
+			color.Red("  Failed to prune: %v", err)
+		} else {
+			for _, branch := range prunable {
+				color.Green("  Pruned: %s", branch)
+			}
+			for _, c := range candidates {
+				if c.worktree.IsPrunable {
+					repo.logEvent(ctx, git.Event{
+						Action: git.ActionRemove,
+						Branch: c.worktree.BranchShort(),
+						Path:   c.worktree.Path,
+						Detail: "pruned missing directory",
+					})
+				}
+			}
+			removed += len(prunable)
+		}
+	} else if repo.cfg.Cleanup.AutoPrune {
+		_ = git.PruneWorktrees(ctx, repo.runner, repo.root)
 	}
 
 	fmt.Printf("\n  Cleaned up %d worktree(s).\n", removed)
+	repo.logEvent(ctx, git.Event{
+		Action: git.ActionClean,
+		Detail: fmt.Sprintf("removed %d of %d candidate(s)", removed, len(candidates)),
+	})
 	return nil
 }
@@ -0,0 +1,90 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+
+	"github.com/yasomaru/git-wt/internal/config"
+	"github.com/yasomaru/git-wt/internal/git"
+)
+
+var cloneCmd = &cobra.Command{
+	Use:   "clone <repository> [directory]",
+	Short: "Clone a repository into the bare worktree layout",
+	Long: `Clone a repository as a bare repository with sibling worktrees.
+
+The repository is cloned into <directory>/.bare, <directory>/.git points to
+it, and the remote's default branch is checked out in <directory>/<branch>.
+A .git-wt.toml with layout.strategy = "bare" is written to <directory>, so
+new worktrees are created next to it and every command works from the
+directory itself or from any of its worktrees.
+
+The directory defaults to the repository name.`,
+	Args: cobra.RangeArgs(1, 2),
+	Example: `  git wt clone https://github.com/yasomaru/git-wt.git
+  git wt clone git@github.com:yasomaru/git-wt.git wt`,
+	RunE: runClone,
+}
+
+func init() {
+	rootCmd.AddCommand(cloneCmd)
+}
+
+func runClone(cmd *cobra.Command, args []string) error {
+	ctx := cmd.Context()
+	url := args[0]
+	dir := cloneDirName(url)
+	if len(args) == 2 {
+		dir = args[1]
+	}
+	container, err := filepath.Abs(dir)
+	if err != nil {
+		return err
+	}
+
+	// Cloning may take longer than git.timeout allows for a single command.
+	runner := newRunner(0)
+	fmt.Printf("  Cloning %s into %s\n", url, container)
+	branch, err := git.CloneBare(ctx, runner, url, container)
+	if err != nil {
+		return fmt.Errorf("clone failed: %s", git.Describe(err))
+	}
+	if err := os.WriteFile(filepath.Join(container, ".git-wt.toml"), []byte(config.GenerateBareConfig()), 0o644); err != nil {
+		return err
+	}
+
+	repo := &repository{runner: runner, root: container, cfg: config.LoadForRepo(container)}
+	targetPath := repo.cfg.WorktreePath(container, branch)
+	err = git.AddWorktree(ctx, repo.runner, container, targetPath, branch, "")
+	ev := git.Event{Action: git.ActionAdd, Branch: branch, Path: targetPath, Detail: "cloned from " + url}
+	if err != nil {
+		ev.Error = git.Describe(err)
+	}
+	repo.logEvent(ctx, ev)
+	if err != nil {
+		return fmt.Errorf("failed to add worktree for %s: %s", branch, git.Describe(err))
+	}
+
+	success := color.New(color.FgGreen, color.Bold)
+	success.Printf("  Cloned repository\n")
+	fmt.Printf("  Branch: %s\n", color.CyanString(branch))
+	fmt.Printf("  Path:   %s\n", targetPath)
+	fmt.Printf("\n  cd %s\n", targetPath)
+	return nil
+}
+
+// cloneDirName derives the directory name of a clone from its URL like git
+// does: the last path component without a trailing ".git".
+func cloneDirName(url string) string {
+	name := strings.TrimRight(url, "/")
+	name = strings.TrimSuffix(name, "/.git")
+	if i := strings.LastIndexAny(name, "/\\:"); i >= 0 {
+		name = name[i+1:]
+	}
+	return strings.TrimSuffix(name, ".git")
+}
@@ -0,0 +1,23 @@
+package cmd
+
+import "testing"
+
+func TestCloneDirName(t *testing.T) {
+	tests := []struct {
+		url  string
+		want string
+	}{
+		{"https://github.com/yasomaru/git-wt.git", "git-wt"},
+		{"https://github.com/yasomaru/git-wt", "git-wt"},
+		{"git@github.com:yasomaru/git-wt.git", "git-wt"},
+		{"host:repo.git", "repo"},
+		{"/srv/git/project/", "project"},
+		{"/srv/git/project/.git", "project"},
+		{"../project", "project"},
+	}
+	for _, tt := range tests {
+		if got := cloneDirName(tt.url); got != tt.want {
+			t.Errorf("cloneDirName(%q) = %q, want %q", tt.url, got, tt.want)
+		}
+	}
+}
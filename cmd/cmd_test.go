@@ -63,6 +63,8 @@ func TestCleanCommandFlags(t *testing.T) {
 		{"stale", "", "0"},
 		{"dry-run", "", "false"},
 		{"force", "f", "false"},
+		{"include-locked", "", "false"},
+		{"gone", "", "false"},
 	}
 
 	for _, tc := range flags {
@@ -81,6 +83,105 @@ func TestCleanCommandFlags(t *testing.T) {
 	}
 }
 
+func TestLockCommandReasonFlag(t *testing.T) {
+	f := lockCmd.Flags().Lookup("reason")
+	if f == nil {
+		t.Fatal("--reason flag not registered on lock command")
+	}
+	if f.Shorthand != "r" {
+		t.Errorf("expected --reason shorthand = %q, got %q", "r", f.Shorthand)
+	}
+}
+
+func TestLockCommandsRegistered(t *testing.T) {
+	for _, name := range []string{"lock", "unlock"} {
+		found := false
+		for _, c := range rootCmd.Commands() {
+			if c.Name() == name {
+				found = true
+				break
+			}
+		}
+		if !found {
+			t.Errorf("%s command not registered on root command", name)
+		}
+	}
+}
+
+func TestMvCommandFlags(t *testing.T) {
+	flags := []struct {
+		name      string
+		shorthand string
+	}{
+		{"all", ""},
+		{"dry-run", ""},
+		{"force", "f"},
+	}
+
+	for _, tc := range flags {
+		t.Run(tc.name, func(t *testing.T) {
+			f := mvCmd.Flags().Lookup(tc.name)
+			if f == nil {
+				t.Fatalf("--%s flag not registered on mv command", tc.name)
+			}
+			if f.Shorthand != tc.shorthand {
+				t.Errorf("--%s shorthand: expected %q, got %q", tc.name, tc.shorthand, f.Shorthand)
+			}
+			if f.DefValue != "false" {
+				t.Errorf("--%s default: expected %q, got %q", tc.name, "false", f.DefValue)
+			}
+		})
+	}
+}
+
+func TestRenameCommandFlags(t *testing.T) {
+	if err := renameCmd.Args(renameCmd, []string{"only-one"}); err == nil {
+		t.Error("expected rename to require two arguments")
+	}
+	for _, name := range []string{"update-upstream", "force"} {
+		if renameCmd.Flags().Lookup(name) == nil {
+			t.Errorf("--%s flag not registered on rename command", name)
+		}
+	}
+}
+
+func TestDoctorCommandFlags(t *testing.T) {
+	for _, name := range []string{"fix", "json"} {
+		f := doctorCmd.Flags().Lookup(name)
+		if f == nil {
+			t.Fatalf("--%s flag not registered on doctor command", name)
+		}
+		if f.DefValue != "false" {
+			t.Errorf("--%s default: expected %q, got %q", name, "false", f.DefValue)
+		}
+	}
+	if len(doctorCmd.Aliases) == 0 || doctorCmd.Aliases[0] != "repair" {
+		t.Errorf("expected doctor to have alias %q, got %v", "repair", doctorCmd.Aliases)
+	}
+}
+
+func TestLogCommandFlags(t *testing.T) {
+	flags := []struct {
+		name      string
+		shorthand string
+	}{
+		{"branch", "b"},
+		{"action", "a"},
+		{"since", ""},
+		{"until", ""},
+		{"json", ""},
+	}
+	for _, tc := range flags {
+		f := logCmd.Flags().Lookup(tc.name)
+		if f == nil {
+			t.Fatalf("--%s flag not registered on log command", tc.name)
+		}
+		if f.Shorthand != tc.shorthand {
+			t.Errorf("--%s shorthand: expected %q, got %q", tc.name, tc.shorthand, f.Shorthand)
+		}
+	}
+}
+
 func TestInitCommandFlags(t *testing.T) {
 	f := initCmd.Flags().Lookup("local")
 	if f == nil {
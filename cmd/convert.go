@@ -0,0 +1,132 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+
+	"github.com/yasomaru/git-wt/internal/config"
+	"github.com/yasomaru/git-wt/internal/git"
+)
+
+var convertCmd = &cobra.Command{
+	Use:   "convert",
+	Short: "Convert a clone to the bare worktree layout in place",
+	Long: `Convert the current clone to the layout git wt clone creates.
+
+The .git directory becomes a bare repository in .bare, a .git file points
+to it, and the checkout of the main worktree, including staged, modified
+and untracked files, is moved into a worktree named after its branch.
+Stashes, hooks, config and all branches stay in the repository, and linked
+worktrees keep working where they are. The local .git-wt.toml is moved next
+to .bare with layout.strategy set to "bare", keeping all other settings, or
+created if there is none; run git wt mv --all afterwards to move the linked
+worktrees into the new layout.
+
+Clones with a detached HEAD, an operation such as a rebase in progress or
+submodules are refused. If a step fails, the steps already taken are rolled
+back.`,
+	Args: cobra.NoArgs,
+	Example: `  git wt convert --dry-run
+  git wt convert`,
+	RunE: runConvert,
+}
+
+var (
+	convertDryRun bool
+	convertYes    bool
+)
+
+func init() {
+	convertCmd.Flags().BoolVar(&convertDryRun, "dry-run", false, "preview the conversion without making changes")
+	convertCmd.Flags().BoolVarP(&convertYes, "yes", "y", false, "convert without confirmation")
+	rootCmd.AddCommand(convertCmd)
+}
+
+func runConvert(cmd *cobra.Command, args []string) error {
+	ctx := cmd.Context()
+
+	repo, err := openRepo(ctx)
+	if err != nil {
+		return err
+	}
+	worktrees, err := git.ListWorktrees(ctx, repo.runner, repo.root)
+	if err != nil {
+		return err
+	}
+	if worktrees[0].IsBare {
+		return fmt.Errorf("%s is already a bare repository", worktrees[0].Path)
+	}
+	root := worktrees[0].Path
+
+	cfg := *repo.cfg
+	cfg.Layout.Strategy = config.LayoutBare
+	c, err := git.PlanConversion(ctx, repo.runner, root, func(branch string) string {
+		return cfg.WorktreePath(root, branch)
+	})
+	if err != nil {
+		return fmt.Errorf("cannot convert %s: %w", root, err)
+	}
+	// The local config moves into the container with the bare layout set.
+	// An untracked config is moved out of the checkout; a tracked one stays
+	// there as part of it.
+	configPath := filepath.Join(root, ".git-wt.toml")
+	configData := config.GenerateBareConfig()
+	configNote := "new, layout.strategy = \"bare\""
+	existing, readErr := os.ReadFile(configPath)
+	moveConfig := false
+	if readErr == nil {
+		configData = config.SetBareLayout(string(existing))
+		configNote = "existing settings kept, layout.strategy = \"bare\""
+		moveConfig = !git.IsTracked(ctx, repo.runner, root, ".git-wt.toml")
+		if !moveConfig {
+			configNote += ", tracked copy stays in the worktree"
+		}
+	}
+
+	fmt.Printf("\n  Conversion of %s:\n\n", root)
+	fmt.Printf("    Repository: %s -> %s\n", filepath.Join(root, ".git"), filepath.Join(root, git.BareDir))
+	fmt.Printf("    Worktree:   %s -> %s (%d entries)\n", color.CyanString(c.Branch), c.WorktreePath, len(c.Entries))
+	if len(c.Worktrees) > 0 {
+		fmt.Printf("    Linked:     %d worktree(s) relinked in place\n", len(c.Worktrees))
+	}
+	fmt.Printf("    Config:     %s (%s)\n", configPath, configNote)
+	fmt.Println()
+
+	if convertDryRun {
+		color.Yellow("  Dry run - no changes made.")
+		return nil
+	}
+	if !convertYes && !confirm(ctx, "Convert this clone?") {
+		fmt.Println("  Cancelled.")
+		return ctx.Err()
+	}
+
+	err = git.ConvertToBare(ctx, repo.runner, c)
+	ev := git.Event{Action: git.ActionMove, Branch: c.Branch, Path: root, Target: c.WorktreePath, Detail: "converted to the bare layout"}
+	if err != nil {
+		ev.Error = git.Describe(err)
+	}
+	repo.logEvent(ctx, ev)
+	if err != nil {
+		return fmt.Errorf("conversion failed: %w", err)
+	}
+	if err := os.WriteFile(configPath, []byte(configData), 0o644); err != nil {
+		color.Yellow("  Warning: could not write %s: %v", configPath, err)
+	} else if moveConfig {
+		_ = os.Remove(filepath.Join(c.WorktreePath, ".git-wt.toml"))
+	}
+
+	success := color.New(color.FgGreen, color.Bold)
+	success.Printf("  Converted repository\n")
+	fmt.Printf("  Branch: %s\n", color.CyanString(c.Branch))
+	fmt.Printf("  Path:   %s\n", c.WorktreePath)
+	if len(c.Worktrees) > 0 {
+		fmt.Printf("\n  Run 'git wt mv --all' to move the other %d worktree(s) into %s.\n", len(c.Worktrees), root)
+	}
+	fmt.Printf("\n  cd %s\n", c.WorktreePath)
+	return nil
+}
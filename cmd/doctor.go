@@ -0,0 +1,128 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+
+	"github.com/yasomaru/git-wt/internal/git"
+)
+
+var doctorCmd = &cobra.Command{
+	Use:     "doctor",
+	Aliases: []string{"repair"},
+	Short:   "Detect and fix broken worktree metadata",
+	Long: `Check the repository's worktrees for broken metadata:
+
+  missing-path      a registered worktree whose directory no longer exists
+  dangling-entry    an entry under .git/worktrees that lost its gitdir file
+  unregistered-dir  a directory in the worktree layout git does not know
+  gitdir-mismatch   a worktree whose .git file points to the wrong place
+
+Problems are fixed with git worktree repair and git worktree prune after
+confirmation, or right away with --fix. Use --json to report them without
+making changes.`,
+	Args: cobra.NoArgs,
+	Example: `  git wt doctor
+  git wt doctor --fix
+  git wt doctor --json`,
+	RunE: runDoctor,
+}
+
+var (
+	doctorFix  bool
+	doctorJSON bool
+)
+
+func init() {
+	doctorCmd.Flags().BoolVar(&doctorFix, "fix", false, "fix problems without confirmation")
+	doctorCmd.Flags().BoolVar(&doctorJSON, "json", false, "report problems as JSON without fixing them")
+	rootCmd.AddCommand(doctorCmd)
+}
+
+func runDoctor(cmd *cobra.Command, args []string) error {
+	ctx := cmd.Context()
+	if doctorFix && doctorJSON {
+		return fmt.Errorf("--fix cannot be combined with --json")
+	}
+
+	repo, err := openRepo(ctx)
+	if err != nil {
+		return err
+	}
+
+	// Directories matching the layout are where unregistered worktrees hide.
+	matches, _ := filepath.Glob(repo.cfg.WorktreeGlob(repo.root))
+	var candidates []string
+	for _, path := range matches {
+		if info, err := os.Stat(path); err == nil && info.IsDir() {
+			candidates = append(candidates, path)
+		}
+	}
+
+	problems, err := git.Diagnose(ctx, repo.runner, repo.root, candidates)
+	if err != nil {
+		return err
+	}
+
+	if doctorJSON {
+		if problems == nil {
+			problems = []git.Problem{}
+		}
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(problems)
+	}
+
+	if len(problems) == 0 {
+		color.Green("  No problems found.")
+		return nil
+	}
+
+	fmt.Printf("\n  Problems found (%d):\n\n", len(problems))
+	var repair []string
+	prune := false
+	for _, p := range problems {
+		fix := "fix by hand"
+		switch p.Fix {
+		case git.FixRepair:
+			fix = "repair"
+			repair = append(repair, p.Path)
+		case git.FixPrune:
+			fix = "prune"
+			prune = true
+		}
+		fmt.Printf("    %s  %s  [%s, %s]\n", color.RedString(string(p.Kind)), p.Path, p.Detail, fix)
+	}
+	fmt.Println()
+
+	if len(repair) == 0 && !prune {
+		color.Yellow("  None of these can be fixed automatically.")
+		return nil
+	}
+	if !doctorFix && !confirm(ctx, "Fix these problems?") {
+		fmt.Println("  Cancelled.")
+		return ctx.Err()
+	}
+
+	// Repair first: it can reconnect entries that prune would otherwise drop.
+	if len(repair) > 0 {
+		if err := git.RepairWorktrees(ctx, repo.runner, repo.root, repair...); err != nil {
+			return fmt.Errorf("failed to repair worktrees: %s", git.Describe(err))
+		}
+		for _, path := range repair {
+			color.Green("  Repaired: %s", path)
+		}
+	}
+	if prune {
+		if err := git.PruneWorktrees(ctx, repo.runner, repo.root); err != nil {
+			return fmt.Errorf("failed to prune worktrees: %s", git.Describe(err))
+		}
+		color.Green("  Pruned stale worktree entries")
+	}
+	return nil
+}
@@ -0,0 +1,133 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+
+	"github.com/yasomaru/git-wt/internal/git"
+)
+
+var lockCmd = &cobra.Command{
+	Use:   "lock [branch]",
+	Short: "Lock a worktree to protect it from removal",
+	Long: `Lock the worktree matching the given branch name.
+
+Locked worktrees are skipped by clean and cannot be selected for removal
+in the TUI. Branch names are matched like in switch; without arguments,
+an interactive selector is shown.`,
+	Args: cobra.MaximumNArgs(1),
+	Example: `  git wt lock experiment
+  git wt lock feature-auth --reason "on removable drive"`,
+	RunE: runLock,
+}
+
+var unlockCmd = &cobra.Command{
+	Use:   "unlock [branch]",
+	Short: "Unlock a locked worktree",
+	Long: `Remove the lock from the worktree matching the given branch name.
+
+Branch names are matched like in switch; without arguments, an interactive
+selector over the locked worktrees is shown.`,
+	Args:    cobra.MaximumNArgs(1),
+	Example: `  git wt unlock experiment`,
+	RunE:    runUnlock,
+}
+
+var lockReason string
+
+func init() {
+	lockCmd.Flags().StringVarP(&lockReason, "reason", "r", "", "reason for locking the worktree")
+	rootCmd.AddCommand(lockCmd)
+	rootCmd.AddCommand(unlockCmd)
+}
+
+func runLock(cmd *cobra.Command, args []string) error {
+	ctx := cmd.Context()
+	repo, err := openRepo(ctx)
+	if err != nil {
+		return err
+	}
+
+	wt, err := pickLockTarget(ctx, repo, args, false)
+	if err != nil {
+		return err
+	}
+	if wt.IsLocked {
+		return fmt.Errorf("worktree %s is already locked", wt.BranchShort())
+	}
+
+	if err := git.LockWorktree(ctx, repo.runner, repo.root, wt.Path, lockReason); err != nil {
+		return fmt.Errorf("failed to lock %s: %s", wt.BranchShort(), git.Describe(err))
+	}
+
+	success := color.New(color.FgGreen, color.Bold)
+	success.Printf("  Locked worktree\n")
+	fmt.Printf("  Branch: %s\n", color.CyanString(wt.BranchShort()))
+	fmt.Printf("  Path:   %s\n", wt.Path)
+	if lockReason != "" {
+		fmt.Printf("  Reason: %s\n", lockReason)
+	}
+	return nil
+}
+
+func runUnlock(cmd *cobra.Command, args []string) error {
+	ctx := cmd.Context()
+	repo, err := openRepo(ctx)
+	if err != nil {
+		return err
+	}
+
+	wt, err := pickLockTarget(ctx, repo, args, true)
+	if err != nil {
+		return err
+	}
+	if !wt.IsLocked {
+		return fmt.Errorf("worktree %s is not locked", wt.BranchShort())
+	}
+
+	if err := git.UnlockWorktree(ctx, repo.runner, repo.root, wt.Path); err != nil {
+		return fmt.Errorf("failed to unlock %s: %s", wt.BranchShort(), git.Describe(err))
+	}
+
+	success := color.New(color.FgGreen, color.Bold)
+	success.Printf("  Unlocked worktree\n")
+	fmt.Printf("  Branch: %s\n", color.CyanString(wt.BranchShort()))
+	fmt.Printf("  Path:   %s\n", wt.Path)
+	return nil
+}
+
+// pickLockTarget resolves the worktree to lock or unlock. The main worktree
+// cannot be locked, so it is never a candidate. When no branch is given, the
+// interactive selector only offers worktrees whose lock state would change.
+func pickLockTarget(ctx context.Context, repo *repository, args []string, locked bool) (*git.Worktree, error) {
+	worktrees, err := git.ListWorktrees(ctx, repo.runner, repo.root)
+	if err != nil {
+		return nil, err
+	}
+
+	var candidates []git.Worktree
+	for i, wt := range worktrees {
+		if i == 0 || wt.IsBare || wt.IsDetached {
+			continue
+		}
+		if len(args) == 0 && wt.IsLocked != locked {
+			continue
+		}
+		candidates = append(candidates, wt)
+	}
+	if len(candidates) == 0 {
+		if locked {
+			return nil, fmt.Errorf("no locked worktrees")
+		}
+		return nil, fmt.Errorf("no worktrees available")
+	}
+
+	query := ""
+	if len(args) > 0 {
+		query = args[0]
+	}
+	return selectWorktree(candidates, query)
+}
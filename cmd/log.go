@@ -0,0 +1,176 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+
+	"github.com/yasomaru/git-wt/internal/git"
+)
+
+var logCmd = &cobra.Command{
+	Use:   "log",
+	Short: "Show the log of changes made by git-wt",
+	Long: `Show the audit log of the changes git-wt made to this repository, newest
+first.
+
+Every add, remove, move, rename, restore, clean and hook run is appended as
+a JSON line to git-wt/log.jsonl in the repository's git directory.
+--since and --until take a date (2006-01-02) or an RFC 3339 time; a date
+given to --until includes that whole day.`,
+	Args: cobra.NoArgs,
+	Example: `  git wt log
+  git wt log --branch feature-auth
+  git wt log --action remove --since 2026-01-01
+  git wt log --json`,
+	RunE: runLog,
+}
+
+var (
+	logBranch string
+	logAction string
+	logSince  string
+	logUntil  string
+	logJSON   bool
+)
+
+func init() {
+	logCmd.Flags().StringVarP(&logBranch, "branch", "b", "", "only show events of this branch")
+	logCmd.Flags().StringVarP(&logAction, "action", "a", "", "only show events of this action")
+	logCmd.Flags().StringVar(&logSince, "since", "", "only show events at or after this date")
+	logCmd.Flags().StringVar(&logUntil, "until", "", "only show events at or before this date")
+	logCmd.Flags().BoolVar(&logJSON, "json", false, "print the events as JSON lines")
+	rootCmd.AddCommand(logCmd)
+}
+
+// eventFilter selects audit log events. Zero fields match everything.
+type eventFilter struct {
+	branch string
+	action git.Action
+	since  time.Time
+	until  time.Time
+}
+
+func (f eventFilter) match(ev git.Event) bool {
+	if f.branch != "" && ev.Branch != f.branch && !(ev.Action == git.ActionRename && ev.Target == f.branch) {
+		return false
+	}
+	if f.action != "" && ev.Action != f.action {
+		return false
+	}
+	if !f.since.IsZero() && ev.Time.Before(f.since) {
+		return false
+	}
+	if !f.until.IsZero() && ev.Time.After(f.until) {
+		return false
+	}
+	return true
+}
+
+func runLog(cmd *cobra.Command, args []string) error {
+	ctx := cmd.Context()
+
+	filter := eventFilter{branch: logBranch, action: git.Action(logAction)}
+	if filter.action != "" && !slices.Contains(git.Actions, filter.action) {
+		names := make([]string, len(git.Actions))
+		for i, a := range git.Actions {
+			names[i] = string(a)
+		}
+		return fmt.Errorf("unknown action %q (valid: %s)", logAction, strings.Join(names, ", "))
+	}
+	var err error
+	if filter.since, err = parseLogTime(logSince, false); err != nil {
+		return err
+	}
+	if filter.until, err = parseLogTime(logUntil, true); err != nil {
+		return err
+	}
+
+	repo, err := openRepo(ctx)
+	if err != nil {
+		return err
+	}
+	events, err := git.Events(ctx, repo.runner, repo.root)
+	if err != nil {
+		return err
+	}
+
+	var matched []git.Event
+	for i := len(events) - 1; i >= 0; i-- {
+		if filter.match(events[i]) {
+			matched = append(matched, events[i])
+		}
+	}
+
+	if logJSON {
+		enc := json.NewEncoder(os.Stdout)
+		for _, ev := range matched {
+			if err := enc.Encode(ev); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	if len(matched) == 0 {
+		fmt.Println("  No events recorded.")
+		return nil
+	}
+	for _, ev := range matched {
+		fmt.Println(formatEvent(ev))
+	}
+	return nil
+}
+
+// parseLogTime parses a --since or --until value. A bare date means the
+// start of that day in local time, or its end if endOfDay is set.
+func parseLogTime(value string, endOfDay bool) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	t, err := time.ParseInLocation(time.DateOnly, value, time.Local)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid date %q (use 2006-01-02 or RFC 3339)", value)
+	}
+	if endOfDay {
+		t = t.AddDate(0, 0, 1).Add(-time.Nanosecond)
+	}
+	return t, nil
+}
+
+// formatEvent renders an event as a single line of the log output.
+func formatEvent(ev git.Event) string {
+	action := color.CyanString("%-7s", ev.Action)
+	if ev.Error != "" {
+		action = color.RedString("%-7s", ev.Action)
+	}
+
+	parts := []string{"  " + ev.Time.Local().Format(time.DateTime), action}
+	if ev.Branch != "" {
+		parts = append(parts, ev.Branch)
+	}
+	switch {
+	case ev.Action == git.ActionRename:
+		parts = append(parts, "-> "+ev.Target, ev.Path)
+	case ev.Target != "":
+		parts = append(parts, ev.Path, "-> "+ev.Target)
+	case ev.Path != "":
+		parts = append(parts, ev.Path)
+	}
+	if ev.Detail != "" {
+		parts = append(parts, fmt.Sprintf("(%s)", ev.Detail))
+	}
+	if ev.Error != "" {
+		parts = append(parts, color.RedString("failed: %s", ev.Error))
+	}
+	return strings.Join(parts, "  ")
+}
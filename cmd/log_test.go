@@ -0,0 +1,66 @@
+package cmd
+
+import (
+	"testing"
+	"time"
+
+	"github.com/yasomaru/git-wt/internal/git"
+)
+
+func TestEventFilter(t *testing.T) {
+	day := time.Date(2026, 3, 10, 12, 0, 0, 0, time.Local)
+	remove := git.Event{Time: day, Action: git.ActionRemove, Branch: "feature"}
+	rename := git.Event{Time: day, Action: git.ActionRename, Branch: "old", Target: "feature"}
+
+	tests := []struct {
+		name   string
+		filter eventFilter
+		ev     git.Event
+		want   bool
+	}{
+		{"empty filter", eventFilter{}, remove, true},
+		{"branch", eventFilter{branch: "feature"}, remove, true},
+		{"other branch", eventFilter{branch: "other"}, remove, false},
+		{"renamed to branch", eventFilter{branch: "feature"}, rename, true},
+		{"action", eventFilter{action: git.ActionRemove}, remove, true},
+		{"other action", eventFilter{action: git.ActionAdd}, remove, false},
+		{"since before", eventFilter{since: day.Add(-time.Hour)}, remove, true},
+		{"since after", eventFilter{since: day.Add(time.Hour)}, remove, false},
+		{"until after", eventFilter{until: day.Add(time.Hour)}, remove, true},
+		{"until before", eventFilter{until: day.Add(-time.Hour)}, remove, false},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := tc.filter.match(tc.ev); got != tc.want {
+				t.Errorf("match() = %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestParseLogTime(t *testing.T) {
+	since, err := parseLogTime("2026-03-10", false)
+	if err != nil {
+		t.Fatalf("parseLogTime() error: %v", err)
+	}
+	if want := time.Date(2026, 3, 10, 0, 0, 0, 0, time.Local); !since.Equal(want) {
+		t.Errorf("since = %v, want %v", since, want)
+	}
+
+	until, err := parseLogTime("2026-03-10", true)
+	if err != nil {
+		t.Fatalf("parseLogTime() error: %v", err)
+	}
+	if until.Day() != 10 || until.Hour() != 23 {
+		t.Errorf("until = %v, want the end of 2026-03-10", until)
+	}
+
+	exact, err := parseLogTime("2026-03-10T08:30:00Z", true)
+	if err != nil || !exact.Equal(time.Date(2026, 3, 10, 8, 30, 0, 0, time.UTC)) {
+		t.Errorf("parseLogTime(RFC 3339) = %v, %v", exact, err)
+	}
+
+	if _, err := parseLogTime("last tuesday", false); err == nil {
+		t.Error("expected an error for an unparsable date")
+	}
+}
@@ -22,12 +22,13 @@ func init() {
 }
 
 func runLs(cmd *cobra.Command, args []string) error {
-	repoRoot, err := git.RepoRoot("")
+	ctx := cmd.Context()
+	repo, err := openRepo(ctx)
 	if err != nil {
-		return fmt.Errorf("not a git repository")
+		return err
 	}
 
-	worktrees, err := git.ListWorktrees(repoRoot)
+	worktrees, _, err := repo.loadWorktrees(ctx)
 	if err != nil {
 		return err
 	}
@@ -37,13 +38,6 @@ func runLs(cmd *cobra.Command, args []string) error {
 		return nil
 	}
 
-	defaultBranch, _ := git.DefaultBranch(repoRoot)
-
-	// Enrich each worktree with status info
-	for i := range worktrees {
-		git.EnrichWorktree(&worktrees[i], defaultBranch)
-	}
-
 	printWorktreeTable(worktrees)
 	return nil
 }
@@ -125,8 +119,27 @@ func printWorktreeTable(worktrees []git.Worktree) {
 
 		// Sync info
 		syncText := wt.SyncText()
+		if wt.Operation != git.OpNone {
+			syncText += " " + color.RedString("(%s)", wt.OperationText())
+		}
 		if wt.IsMerged {
-			syncText += " " + color.GreenString("(merged)")
+			syncText += " " + color.GreenString("(%s)", wt.MergedText())
+		}
+		if wt.Upstream == git.UpstreamGone {
+			syncText += " " + color.YellowString("(upstream gone)")
+		}
+		if wt.IsLocked {
+			if wt.LockReason != "" {
+				syncText += " " + color.CyanString("(locked: %s)", wt.LockReason)
+			} else {
+				syncText += " " + color.CyanString("(locked)")
+			}
+		}
+		if wt.IsPrunable {
+			syncText += " " + color.RedString("(prunable)")
+		}
+		if wt.IsSparse {
+			syncText += " " + color.CyanString("(sparse)")
 		}
 		days := wt.InactiveDays()
 		if days > 30 {
@@ -0,0 +1,209 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+
+	"github.com/yasomaru/git-wt/internal/git"
+)
+
+var mvCmd = &cobra.Command{
+	Use:     "mv [branch] [new-path]",
+	Aliases: []string{"move"},
+	Short:   "Move worktrees to a new path or to the configured layout",
+	Long: `Move a worktree with git worktree move.
+
+With a new path, the worktree matching the branch name is moved there.
+Without one, it is moved to the path the current layout configuration
+computes, as git wt add would create it today. Use --all after changing
+layout.strategy or layout.pattern to re-home every worktree.
+
+Worktrees with local changes and locked worktrees are skipped unless
+--force is given. The main worktree is never moved.`,
+	Args: cobra.MaximumNArgs(2),
+	Example: `  git wt mv feature-auth ~/src/auth
+  git wt mv feature-auth        # move to the configured layout path
+  git wt mv --all --dry-run     # preview re-homing all worktrees
+  git wt mv --all`,
+	RunE: runMv,
+}
+
+var (
+	mvAll    bool
+	mvDryRun bool
+	mvForce  bool
+)
+
+func init() {
+	mvCmd.Flags().BoolVar(&mvAll, "all", false, "move all worktrees to their configured layout path")
+	mvCmd.Flags().BoolVar(&mvDryRun, "dry-run", false, "preview moves without making changes")
+	mvCmd.Flags().BoolVarP(&mvForce, "force", "f", false, "also move dirty and locked worktrees")
+	rootCmd.AddCommand(mvCmd)
+}
+
+// plannedMove is a worktree move together with the reason it cannot be
+// carried out, if any.
+type plannedMove struct {
+	worktree git.Worktree
+	target   string
+	skip     string
+}
+
+func runMv(cmd *cobra.Command, args []string) error {
+	ctx := cmd.Context()
+	if mvAll && len(args) > 0 {
+		return fmt.Errorf("--all cannot be combined with a branch or path")
+	}
+
+	repo, err := openRepo(ctx)
+	if err != nil {
+		return err
+	}
+
+	worktrees, _, err := repo.loadWorktrees(ctx)
+	if err != nil {
+		return err
+	}
+
+	// The main worktree cannot be moved by git.
+	var candidates []git.Worktree
+	for i, wt := range worktrees {
+		if i == 0 || wt.IsBare || wt.IsDetached {
+			continue
+		}
+		candidates = append(candidates, wt)
+	}
+	if len(candidates) == 0 {
+		return fmt.Errorf("no worktrees available")
+	}
+
+	layoutPath := func(wt git.Worktree) string {
+		return repo.cfg.WorktreePath(repo.root, wt.BranchShort())
+	}
+
+	if !mvAll {
+		query := ""
+		if len(args) > 0 {
+			query = args[0]
+		}
+		selected, err := selectWorktree(candidates, query)
+		if err != nil {
+			return err
+		}
+		target := layoutPath(*selected)
+		if len(args) == 2 {
+			if target, err = filepath.Abs(args[1]); err != nil {
+				return err
+			}
+		}
+		moves := planMoves([]git.Worktree{*selected}, func(git.Worktree) string { return target }, mvForce)
+		if len(moves) == 0 {
+			color.Green("  %s is already at %s", selected.BranchShort(), target)
+			return nil
+		}
+		if moves[0].skip != "" {
+			return fmt.Errorf("cannot move %s: %s", selected.BranchShort(), moves[0].skip)
+		}
+		return applyMoves(ctx, repo, moves)
+	}
+
+	moves := planMoves(candidates, layoutPath, mvForce)
+	if len(moves) == 0 {
+		color.Green("  All worktrees match the configured layout.")
+		return nil
+	}
+	return applyMoves(ctx, repo, moves)
+}
+
+// planMoves computes where each worktree should go. Worktrees already at
+// their target are left out; those that cannot be moved safely are kept with
+// a skip reason so they can be reported.
+func planMoves(worktrees []git.Worktree, targetFor func(git.Worktree) string, force bool) []plannedMove {
+	var moves []plannedMove
+	claimed := make(map[string]string)
+	for _, wt := range worktrees {
+		target := filepath.Clean(targetFor(wt))
+		if filepath.Clean(wt.Path) == target {
+			continue
+		}
+
+		m := plannedMove{worktree: wt, target: target}
+		switch {
+		case wt.IsPrunable:
+			m.skip = "directory is missing; run 'git wt clean' to prune it"
+		case wt.StatusErr != nil:
+			m.skip = wt.StatusText()
+		case wt.IsLocked && !force:
+			m.skip = "locked (use --force to move anyway)"
+		case !wt.IsClean() && !force:
+			m.skip = wt.StatusText() + " (use --force to move anyway)"
+		case claimed[target] != "":
+			m.skip = fmt.Sprintf("target is also the path for %s", claimed[target])
+		default:
+			if _, err := os.Stat(target); err == nil {
+				m.skip = "target path already exists"
+			}
+		}
+		if m.skip == "" {
+			claimed[target] = wt.BranchShort()
+		}
+		moves = append(moves, m)
+	}
+	return moves
+}
+
+// applyMoves prints the plan and, unless --dry-run is set, carries out every
+// move without a skip reason. It fails if any of those moves failed.
+func applyMoves(ctx context.Context, repo *repository, moves []plannedMove) error {
+	fmt.Printf("\n  Worktrees to move (%d):\n\n", len(moves))
+	for _, m := range moves {
+		branch := color.CyanString(m.worktree.BranchShort())
+		if m.skip != "" {
+			fmt.Printf("    %s  %s  [%s]\n", branch, m.worktree.Path, color.YellowString("skipped: "+m.skip))
+			continue
+		}
+		fmt.Printf("    %s  %s -> %s\n", branch, m.worktree.Path, m.target)
+	}
+	fmt.Println()
+
+	if mvDryRun {
+		color.Yellow("  Dry run - no changes made.")
+		return nil
+	}
+
+	moved, failed := 0, 0
+	for _, m := range moves {
+		if m.skip != "" {
+			continue
+		}
+		wt := m.worktree
+		branch := wt.BranchShort()
+		err := git.MoveWorktree(ctx, repo.runner, repo.root, wt.Path, m.target, mvForce)
+		ev := git.Event{Action: git.ActionMove, Branch: branch, Path: wt.Path, Target: m.target}
+		if err != nil {
+			ev.Error = git.Describe(err)
+		}
+		repo.logEvent(ctx, ev)
+		if err != nil {
+			color.Red("  Failed to move %s: %s", branch, worktreeErrorMessage(err))
+			failed++
+			continue
+		}
+		color.Green("  Moved: %s", branch)
+		if wt.IsCurrent {
+			fmt.Printf("\n  cd %s\n", m.target)
+		}
+		moved++
+	}
+
+	fmt.Printf("\n  Moved %d worktree(s).\n", moved)
+	if failed > 0 {
+		return fmt.Errorf("failed to move %d worktree(s)", failed)
+	}
+	return nil
+}
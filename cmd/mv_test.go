@@ -0,0 +1,102 @@
+package cmd
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/yasomaru/git-wt/internal/git"
+)
+
+func layoutTarget(wt git.Worktree) string {
+	return "/layout/" + wt.BranchShort()
+}
+
+func TestPlanMoves_SkipsWorktreesInPlace(t *testing.T) {
+	t.Parallel()
+	worktrees := []git.Worktree{
+		{Path: "/layout/done", Branch: "refs/heads/done"},
+		{Path: "/old/todo", Branch: "refs/heads/todo"},
+	}
+
+	moves := planMoves(worktrees, layoutTarget, false)
+	if len(moves) != 1 {
+		t.Fatalf("expected 1 move, got %d", len(moves))
+	}
+	if moves[0].target != "/layout/todo" || moves[0].skip != "" {
+		t.Errorf("unexpected move: %+v", moves[0])
+	}
+}
+
+func TestPlanMoves_SafetyChecks(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name  string
+		wt    git.Worktree
+		force bool
+		skip  string
+	}{
+		{"dirty", git.Worktree{Modified: 2}, false, "2 modified"},
+		{"dirty forced", git.Worktree{Modified: 2}, true, ""},
+		{"locked", git.Worktree{IsLocked: true}, false, "locked"},
+		{"locked forced", git.Worktree{IsLocked: true}, true, ""},
+		{"status unknown", git.Worktree{StatusErr: errors.New("boom")}, true, "status: unknown"},
+		{"missing", git.Worktree{IsPrunable: true}, true, "directory is missing"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			wt := tt.wt
+			wt.Path = "/old/feat"
+			wt.Branch = "refs/heads/feat"
+
+			moves := planMoves([]git.Worktree{wt}, layoutTarget, tt.force)
+			if len(moves) != 1 {
+				t.Fatalf("expected 1 move, got %d", len(moves))
+			}
+			got := moves[0].skip
+			if tt.skip == "" && got != "" {
+				t.Errorf("expected move to proceed, skipped: %s", got)
+			}
+			if tt.skip != "" && !strings.Contains(got, tt.skip) {
+				t.Errorf("skip = %q, want it to contain %q", got, tt.skip)
+			}
+		})
+	}
+}
+
+func TestPlanMoves_TargetExists(t *testing.T) {
+	t.Parallel()
+	existing := t.TempDir()
+	wt := git.Worktree{Path: "/old/feat", Branch: "refs/heads/feat"}
+
+	moves := planMoves([]git.Worktree{wt}, func(git.Worktree) string { return existing }, false)
+	if len(moves) != 1 || moves[0].skip != "target path already exists" {
+		t.Errorf("expected existing target to be skipped, got %+v", moves)
+	}
+}
+
+func TestPlanMoves_ConflictingTargets(t *testing.T) {
+	t.Parallel()
+	target := filepath.Join(t.TempDir(), "shared")
+	worktrees := []git.Worktree{
+		{Path: "/old/a", Branch: "refs/heads/feat/a"},
+		{Path: "/old/b", Branch: "refs/heads/feat-a"},
+	}
+
+	moves := planMoves(worktrees, func(git.Worktree) string { return target }, false)
+	if len(moves) != 2 {
+		t.Fatalf("expected 2 moves, got %d", len(moves))
+	}
+	if moves[0].skip != "" {
+		t.Errorf("first move should proceed, skipped: %s", moves[0].skip)
+	}
+	if !strings.Contains(moves[1].skip, "feat/a") {
+		t.Errorf("second move skip = %q, want conflict with feat/a", moves[1].skip)
+	}
+	if _, err := os.Stat(target); !os.IsNotExist(err) {
+		t.Error("planMoves must not touch the filesystem")
+	}
+}
@@ -0,0 +1,159 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+
+	"github.com/yasomaru/git-wt/internal/git"
+)
+
+var renameCmd = &cobra.Command{
+	Use:   "rename <branch> <new-branch>",
+	Short: "Rename a branch and move its worktree to match",
+	Long: `Rename the branch of a worktree and move the worktree to the path the
+layout configuration computes for the new name.
+
+The branch is matched like in switch. With --update-upstream, the branch
+tracks <remote>/<new-branch> instead of its old upstream branch if that
+remote branch exists; otherwise the upstream is left unchanged. If any
+step fails, the steps already taken are rolled back.
+
+Worktrees with local changes and locked worktrees are refused unless
+--force is given. The main worktree cannot be renamed.`,
+	Args: cobra.ExactArgs(2),
+	Example: `  git wt rename feature-auth feature-login
+  git wt rename feat-auth feature-login --update-upstream`,
+	RunE: runRename,
+}
+
+var (
+	renameUpstream bool
+	renameForce    bool
+)
+
+func init() {
+	renameCmd.Flags().BoolVarP(&renameUpstream, "update-upstream", "u", false, "track <remote>/<new-branch> after renaming")
+	renameCmd.Flags().BoolVarP(&renameForce, "force", "f", false, "also rename dirty and locked worktrees")
+	rootCmd.AddCommand(renameCmd)
+}
+
+func runRename(cmd *cobra.Command, args []string) error {
+	ctx := cmd.Context()
+	newBranch := args[1]
+
+	repo, err := openRepo(ctx)
+	if err != nil {
+		return err
+	}
+
+	worktrees, _, err := repo.loadWorktrees(ctx)
+	if err != nil {
+		return err
+	}
+
+	// The main worktree cannot be moved by git.
+	var candidates []git.Worktree
+	for i, wt := range worktrees {
+		if i == 0 || wt.IsBare || wt.IsDetached {
+			continue
+		}
+		candidates = append(candidates, wt)
+	}
+	if len(candidates) == 0 {
+		return fmt.Errorf("no worktrees available")
+	}
+
+	wt, err := selectWorktree(candidates, args[0])
+	if err != nil {
+		return err
+	}
+	oldBranch := wt.BranchShort()
+	if oldBranch == newBranch {
+		return fmt.Errorf("branch is already named %s", newBranch)
+	}
+	if git.BranchExists(ctx, repo.runner, repo.root, newBranch) {
+		return fmt.Errorf("branch %q already exists", newBranch)
+	}
+
+	target := repo.cfg.WorktreePath(repo.root, newBranch)
+	moves := planMoves([]git.Worktree{*wt}, func(git.Worktree) string { return target }, renameForce)
+	if len(moves) > 0 && moves[0].skip != "" {
+		return fmt.Errorf("cannot rename %s: %s", oldBranch, moves[0].skip)
+	}
+
+	var undo rollback
+	if err := git.RenameBranch(ctx, repo.runner, repo.root, oldBranch, newBranch); err != nil {
+		return fmt.Errorf("failed to rename branch: %s", git.Describe(err))
+	}
+	undo.add(func(ctx context.Context) error {
+		return git.RenameBranch(ctx, repo.runner, repo.root, newBranch, oldBranch)
+	})
+
+	upstream := ""
+	if renameUpstream {
+		remote, merge := git.BranchUpstream(ctx, repo.runner, repo.root, newBranch)
+		if remote == "" {
+			color.Yellow("  Warning: %s has no upstream to update", oldBranch)
+		} else if _, ok := git.RemoteTrackingRef(ctx, repo.runner, repo.root, remote, newBranch); !ok {
+			// Tracking a branch the remote does not have would show the
+			// upstream as gone.
+			color.Yellow("  Warning: %s/%s does not exist; upstream left unchanged", remote, newBranch)
+			fmt.Printf("  Push it with: git push -u %s %s\n", remote, newBranch)
+		} else {
+			if err := git.SetBranchUpstream(ctx, repo.runner, repo.root, newBranch, remote, "refs/heads/"+newBranch); err != nil {
+				return undo.run(ctx, fmt.Errorf("failed to update upstream: %s", git.Describe(err)))
+			}
+			undo.add(func(ctx context.Context) error {
+				return git.SetBranchUpstream(ctx, repo.runner, repo.root, newBranch, remote, merge)
+			})
+			upstream = remote + "/" + newBranch
+		}
+	}
+
+	if len(moves) > 0 {
+		if err := git.MoveWorktree(ctx, repo.runner, repo.root, wt.Path, target, renameForce); err != nil {
+			return undo.run(ctx, fmt.Errorf("failed to move worktree: %s", worktreeErrorMessage(err)))
+		}
+	}
+
+	ev := git.Event{Action: git.ActionRename, Branch: oldBranch, Path: target, Target: newBranch}
+	if upstream != "" {
+		ev.Detail = "upstream set to " + upstream
+	}
+	repo.logEvent(ctx, ev)
+
+	success := color.New(color.FgGreen, color.Bold)
+	success.Printf("  Renamed worktree\n")
+	fmt.Printf("  Branch: %s -> %s\n", oldBranch, color.CyanString(newBranch))
+	fmt.Printf("  Path:   %s\n", target)
+	if upstream != "" {
+		fmt.Printf("  Upstream: %s\n", upstream)
+	}
+	if wt.IsCurrent {
+		fmt.Printf("\n  cd %s\n", target)
+	}
+	return nil
+}
+
+// rollback collects the compensating actions of a multi-step operation.
+type rollback []func(context.Context) error
+
+func (rb *rollback) add(undo func(context.Context) error) {
+	*rb = append(*rb, undo)
+}
+
+// run undoes the completed steps in reverse order and returns err annotated
+// with the outcome. Cancellation of ctx is ignored so that an interrupted
+// operation is still rolled back.
+func (rb rollback) run(ctx context.Context, err error) error {
+	ctx = context.WithoutCancel(ctx)
+	for i := len(rb) - 1; i >= 0; i-- {
+		if undoErr := rb[i](ctx); undoErr != nil {
+			return fmt.Errorf("%w; rollback failed: %s", err, git.Describe(undoErr))
+		}
+	}
+	return fmt.Errorf("%w (changes rolled back)", err)
+}
@@ -0,0 +1,82 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/spf13/cobra"
+
+	"github.com/yasomaru/git-wt/internal/git"
+	"github.com/yasomaru/git-wt/internal/git/gittest"
+)
+
+func TestRollback_RunsInReverse(t *testing.T) {
+	var order []int
+	var rb rollback
+	for i := range 3 {
+		rb.add(func(context.Context) error {
+			order = append(order, i)
+			return nil
+		})
+	}
+
+	err := rb.run(t.Context(), errors.New("step failed"))
+	if err == nil || !strings.Contains(err.Error(), "rolled back") {
+		t.Errorf("run() error = %v, want it to mention the rollback", err)
+	}
+	if len(order) != 3 || order[0] != 2 || order[2] != 0 {
+		t.Errorf("undo order = %v, want [2 1 0]", order)
+	}
+}
+
+func TestRollback_IgnoresCancellation(t *testing.T) {
+	ctx, cancel := context.WithCancel(t.Context())
+	cancel()
+
+	var rb rollback
+	rb.add(func(ctx context.Context) error { return ctx.Err() })
+
+	if err := rb.run(ctx, context.Canceled); strings.Contains(err.Error(), "rollback failed") {
+		t.Errorf("run() error = %v, want undo to run despite cancellation", err)
+	}
+}
+
+func TestRollback_ReportsUndoFailure(t *testing.T) {
+	var rb rollback
+	rb.add(func(context.Context) error { return errors.New("cannot undo") })
+
+	err := rb.run(t.Context(), errors.New("step failed"))
+	if err == nil || !strings.Contains(err.Error(), "rollback failed: cannot undo") {
+		t.Errorf("run() error = %v, want the undo failure", err)
+	}
+}
+
+func TestRename_RollsBackBranchWhenMoveFails(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	root := filepath.Join(t.TempDir(), "repo")
+	wtPath := root + "-feat"
+	target := root + "-renamed"
+
+	fake := useFakeRunner(t)
+	fake.Stub("rev-parse --git-common-dir", filepath.Join(root, ".git"), nil)
+	fake.Stub("worktree list --porcelain -z",
+		"worktree "+root+"\x00HEAD abc\x00branch refs/heads/main\x00\x00"+
+			"worktree "+wtPath+"\x00HEAD abc\x00branch refs/heads/feat\x00\x00", nil)
+	fake.Stub("branch -m feat renamed", "", nil)
+	fake.Stub("worktree move "+wtPath+" "+target, "", gittest.Fail(git.KindUnknown,
+		"fatal: failed to move", "worktree", "move", wtPath, target))
+	fake.Stub("branch -m renamed feat", "", nil)
+
+	cmd := &cobra.Command{}
+	cmd.SetContext(t.Context())
+	err := runRename(cmd, []string{"feat", "renamed"})
+	if err == nil || !strings.Contains(err.Error(), "rolled back") {
+		t.Fatalf("runRename() error = %v, want a rolled back failure", err)
+	}
+	if !fake.Called("branch -m renamed feat") {
+		t.Error("expected the branch rename to be undone")
+	}
+}
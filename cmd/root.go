@@ -1,8 +1,10 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
 	"os"
+	"os/signal"
 
 	"github.com/spf13/cobra"
 
@@ -35,7 +37,17 @@ Usage as a git subcommand:
   git wt add <branch>     Create a worktree with automatic path and branch setup
   git wt ls               List all worktrees with status information
   git wt switch [branch]  Switch to a worktree by branch name
-  git wt clean            Remove merged or stale worktrees`,
+  git wt clean            Remove merged or stale worktrees
+  git wt undo             Restore the most recently removed worktree
+  git wt restore <branch> Restore a removed worktree by branch name
+  git wt log              Show the log of changes made by git-wt
+  git wt mv [branch]      Move worktrees to a new path or the configured layout
+  git wt rename <a> <b>   Rename a branch and move its worktree to match
+  git wt doctor           Detect and fix broken worktree metadata
+  git wt lock [branch]    Protect a worktree from removal
+  git wt unlock [branch]  Remove a worktree lock
+  git wt clone <url>      Clone into a bare repository with sibling worktrees
+  git wt convert          Convert a clone to the bare worktree layout in place`,
 	SilenceUsage:  true,
 	SilenceErrors: true,
 	RunE:          runRoot,
@@ -54,26 +66,34 @@ func init() {
 }
 
 func runRoot(cmd *cobra.Command, args []string) error {
-	repoDir, err := git.RepoRoot("")
+	ctx := cmd.Context()
+	repo, err := openRepo(ctx)
 	if err != nil {
-		return fmt.Errorf("not a git repository")
+		return err
 	}
 
-	worktrees, err := git.ListWorktrees(repoDir)
+	worktrees, _, err := repo.loadWorktrees(ctx)
 	if err != nil {
 		return err
 	}
 
-	defaultBranch, _ := git.DefaultBranch(repoDir)
-	for i := range worktrees {
-		git.EnrichWorktree(&worktrees[i], defaultBranch)
+	remove := func(ctx context.Context, wt git.Worktree) (string, error) {
+		rm, err := repo.removeWorktree(ctx, wt, repo.removeOptions(wt, false))
+		return rm.Backup, err
 	}
-
-	return tui.Run(worktrees, repoDir)
+	return tui.Run(ctx, repo.runner, worktrees, repo.root, remove)
 }
 
 func Execute() {
-	if err := rootCmd.Execute(); err != nil {
+	// Cancel running git commands on Ctrl+C instead of waiting for them.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	// Restore the default handling after the first Ctrl+C, so that a second
+	// one terminates git-wt even where a command does not watch ctx.
+	context.AfterFunc(ctx, stop)
+	err := rootCmd.ExecuteContext(ctx)
+	stop()
+
+	if err != nil {
 		fmt.Fprintln(os.Stderr, err)
 		os.Exit(1)
 	}
@@ -45,25 +45,21 @@ func init() {
 }
 
 func runSwitch(cmd *cobra.Command, args []string) error {
+	ctx := cmd.Context()
 	if switchInitShell != "" {
 		return printShellInit(switchInitShell)
 	}
 
-	repoDir, err := git.RepoRoot("")
+	repo, err := openRepo(ctx)
 	if err != nil {
-		return fmt.Errorf("not a git repository")
+		return err
 	}
 
-	worktrees, err := git.ListWorktrees(repoDir)
+	worktrees, _, err := repo.loadWorktrees(ctx)
 	if err != nil {
 		return err
 	}
 
-	defaultBranch, _ := git.DefaultBranch(repoDir)
-	for i := range worktrees {
-		git.EnrichWorktree(&worktrees[i], defaultBranch)
-	}
-
 	// Filter out bare and detached worktrees
 	var candidates []git.Worktree
 	for _, wt := range worktrees {
@@ -77,42 +73,43 @@ func runSwitch(cmd *cobra.Command, args []string) error {
 		return fmt.Errorf("no worktrees available")
 	}
 
-	// No argument: launch interactive selector
-	if len(args) == 0 {
-		selected, err := tui.RunSelector(candidates)
-		if err != nil {
-			return err
-		}
-		if selected == nil {
-			return fmt.Errorf("cancelled")
-		}
-		fmt.Println(selected.Path)
-		return nil
+	query := ""
+	if len(args) > 0 {
+		query = args[0]
 	}
+	selected, err := selectWorktree(candidates, query)
+	if err != nil {
+		return err
+	}
+	fmt.Println(selected.Path)
+	return nil
+}
 
-	// With argument: match by branch name
-	query := args[0]
-	matches := matchWorktrees(candidates, query)
-
-	switch len(matches) {
-	case 0:
-		return fmt.Errorf("no worktree matching %q", query)
-	case 1:
-		fmt.Println(matches[0].Path)
-		return nil
-	default:
-		// Multiple matches: launch selector with filtered list
-		fmt.Fprintf(os.Stderr, "Multiple worktrees match %q:\n", query)
-		selected, err := tui.RunSelector(matches)
-		if err != nil {
-			return err
-		}
-		if selected == nil {
-			return fmt.Errorf("cancelled")
+// selectWorktree picks the worktree matching query using matchWorktrees.
+// An empty query, or one matching several worktrees, launches the interactive
+// selector over the remaining candidates.
+func selectWorktree(candidates []git.Worktree, query string) (*git.Worktree, error) {
+	matches := candidates
+	if query != "" {
+		matches = matchWorktrees(candidates, query)
+		switch len(matches) {
+		case 0:
+			return nil, fmt.Errorf("no worktree matching %q", query)
+		case 1:
+			return &matches[0], nil
+		default:
+			fmt.Fprintf(os.Stderr, "Multiple worktrees match %q:\n", query)
 		}
-		fmt.Println(selected.Path)
-		return nil
 	}
+
+	selected, err := tui.RunSelector(matches)
+	if err != nil {
+		return nil, err
+	}
+	if selected == nil {
+		return nil, fmt.Errorf("cancelled")
+	}
+	return selected, nil
 }
 
 // matchWorktrees returns worktrees matching the query with the following
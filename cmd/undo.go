@@ -0,0 +1,149 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+
+	"github.com/yasomaru/git-wt/internal/git"
+)
+
+var undoCmd = &cobra.Command{
+	Use:   "undo",
+	Short: "Restore the most recently removed worktree",
+	Long: `Recreate the worktree removed last by clean or the interactive manager.
+
+Every removal is recorded in a journal in the repository's git directory.
+undo recreates the deleted branch at its old tip, adds the worktree at its
+old path, applies backed up local changes and restores the lock. Running it
+again restores the removal before that.`,
+	Args:    cobra.NoArgs,
+	Example: `  git wt undo`,
+	RunE:    runUndo,
+}
+
+var restoreCmd = &cobra.Command{
+	Use:   "restore <branch>",
+	Short: "Restore a removed worktree by branch name",
+	Long: `Recreate the most recently removed worktree of the given branch.
+
+The worktree is restored like with undo, from the same journal.`,
+	Args:    cobra.ExactArgs(1),
+	Example: `  git wt restore feature-auth`,
+	RunE:    runRestore,
+}
+
+func init() {
+	rootCmd.AddCommand(undoCmd)
+	rootCmd.AddCommand(restoreCmd)
+}
+
+func runUndo(cmd *cobra.Command, args []string) error {
+	ctx := cmd.Context()
+	repo, err := openRepo(ctx)
+	if err != nil {
+		return err
+	}
+
+	removals, err := git.Removals(ctx, repo.runner, repo.root)
+	if err != nil {
+		return err
+	}
+	if len(removals) == 0 {
+		return fmt.Errorf("no removed worktrees to restore")
+	}
+	return restoreRemoval(ctx, repo, removals[len(removals)-1])
+}
+
+func runRestore(cmd *cobra.Command, args []string) error {
+	ctx := cmd.Context()
+	branch := args[0]
+	repo, err := openRepo(ctx)
+	if err != nil {
+		return err
+	}
+
+	removals, err := git.Removals(ctx, repo.runner, repo.root)
+	if err != nil {
+		return err
+	}
+	rm, ok := findRemoval(removals, branch)
+	if !ok {
+		if recorded := removedBranches(removals); len(recorded) > 0 {
+			return fmt.Errorf("no removed worktree for branch %q (recorded: %s)", branch, strings.Join(recorded, ", "))
+		}
+		return fmt.Errorf("no removed worktree for branch %q", branch)
+	}
+	return restoreRemoval(ctx, repo, rm)
+}
+
+// findRemoval returns the most recent removal of branch.
+func findRemoval(removals []git.Removal, branch string) (git.Removal, bool) {
+	for i := len(removals) - 1; i >= 0; i-- {
+		if removals[i].Branch == branch {
+			return removals[i], true
+		}
+	}
+	return git.Removal{}, false
+}
+
+// removedBranches lists the branches in removals once each, most recent
+// first.
+func removedBranches(removals []git.Removal) []string {
+	seen := make(map[string]bool)
+	var branches []string
+	for i := len(removals) - 1; i >= 0; i-- {
+		b := removals[i].Branch
+		if b == "" || seen[b] {
+			continue
+		}
+		seen[b] = true
+		branches = append(branches, b)
+	}
+	return branches
+}
+
+// restoreRemoval recreates the worktree of rm and drops it from the journal.
+func restoreRemoval(ctx context.Context, repo *repository, rm git.Removal) error {
+	err := git.RestoreWorktree(ctx, repo.runner, repo.root, rm)
+	ev := git.Event{Action: git.ActionRestore, Branch: rm.Branch, Path: rm.Path}
+	if err != nil {
+		ev.Error = git.Describe(err)
+	}
+	repo.logEvent(ctx, ev)
+	if err != nil {
+		return fmt.Errorf("failed to restore %s: %s", rm.Path, git.Describe(err))
+	}
+	if err := git.ForgetRemoval(ctx, repo.runner, repo.root, rm); err != nil {
+		color.Yellow("  Warning: could not update the removal journal: %v", err)
+	}
+
+	branch := rm.Branch
+	if branch == "" {
+		branch = shortHash(rm.Head) + " (detached)"
+	}
+	success := color.New(color.FgGreen, color.Bold)
+	success.Printf("  Restored worktree\n")
+	fmt.Printf("  Branch: %s\n", color.CyanString(branch))
+	fmt.Printf("  Path:   %s\n", rm.Path)
+	if rm.BranchTip != "" {
+		fmt.Printf("  Recreated branch at %s\n", shortHash(rm.BranchTip))
+	}
+	if rm.Backup != "" {
+		fmt.Printf("  Applied local changes from %s\n", rm.Backup)
+	}
+	if rm.Locked {
+		fmt.Printf("  Locked again\n")
+	}
+
+	fmt.Printf("\n  cd %s\n", rm.Path)
+	return nil
+}
+
+// shortHash abbreviates a commit hash for display like Worktree.ShortHead.
+func shortHash(hash string) string {
+	return (&git.Worktree{Head: hash}).ShortHead()
+}
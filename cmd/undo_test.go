@@ -0,0 +1,30 @@
+package cmd
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/yasomaru/git-wt/internal/git"
+)
+
+func TestFindRemoval(t *testing.T) {
+	removals := []git.Removal{
+		{Path: "/old-feature", Branch: "feature"},
+		{Path: "/other", Branch: "other"},
+		{Path: "/new-feature", Branch: "feature"},
+		{Path: "/detached", Head: "1111"},
+	}
+
+	rm, ok := findRemoval(removals, "feature")
+	if !ok || rm.Path != "/new-feature" {
+		t.Errorf("findRemoval(feature) = %+v, %v; want the most recent removal", rm, ok)
+	}
+	if _, ok := findRemoval(removals, "missing"); ok {
+		t.Error("findRemoval(missing) found a removal, want none")
+	}
+
+	want := []string{"feature", "other"}
+	if got := removedBranches(removals); !reflect.DeepEqual(got, want) {
+		t.Errorf("removedBranches() = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,212 @@
+package cmd
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/fatih/color"
+
+	"github.com/yasomaru/git-wt/internal/config"
+	"github.com/yasomaru/git-wt/internal/git"
+)
+
+// newRunner creates the git.Runner used by all commands. Tests replace it
+// with a gittest.FakeRunner to script git's behaviour.
+var newRunner = func(timeout time.Duration) git.Runner {
+	return &git.ExecRunner{Timeout: timeout}
+}
+
+// repository bundles what commands need to operate on the current repository.
+type repository struct {
+	runner git.Runner
+	root   string
+	cfg    *config.Config
+}
+
+// openRepo locates the repository containing the working directory and
+// loads its configuration.
+func openRepo(ctx context.Context) (*repository, error) {
+	root, err := git.RepoRoot(ctx, newRunner(0), "")
+	if err != nil {
+		var gitErr *git.GitError
+		if errors.As(err, &gitErr) && gitErr.Kind == git.KindNotARepo {
+			return nil, fmt.Errorf("not a git repository")
+		}
+		return nil, err
+	}
+
+	cfg := config.LoadForRepo(root)
+	return &repository{
+		runner: newRunner(cfg.Git.Timeout),
+		root:   root,
+		cfg:    cfg,
+	}, nil
+}
+
+// loadWorktrees lists all worktrees of the repository and enriches them with
+// status information in parallel. It also returns the resolved default branch.
+func (r *repository) loadWorktrees(ctx context.Context) ([]git.Worktree, string, error) {
+	worktrees, err := git.ListWorktrees(ctx, r.runner, r.root)
+	if err != nil {
+		return nil, "", err
+	}
+
+	defaultBranch, err := r.defaultBranch(ctx)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, color.YellowString("  Warning: %v; merge status is not shown. Set git.default_branch or git.remotes in .git-wt.toml", err))
+	}
+	opts := git.EnrichOptions{
+		DefaultBranch:  defaultBranch,
+		MergeDetection: git.MergeDetection(r.cfg.Cleanup.MergeDetection),
+		MergeTargets:   r.mergeTargets(ctx, defaultBranch),
+	}
+	if len(opts.MergeTargets) > 0 {
+		opts.Remotes, _ = git.Remotes(ctx, r.runner, r.root)
+	}
+	git.EnrichWorktrees(ctx, r.runner, worktrees, opts, r.cfg.Git.Parallelism)
+	if err := ctx.Err(); err != nil {
+		return nil, "", err
+	}
+	return worktrees, defaultBranch, nil
+}
+
+// defaultBranch returns git.default_branch if set, or the default branch
+// detected from git.remotes.
+func (r *repository) defaultBranch(ctx context.Context) (string, error) {
+	if r.cfg.Git.DefaultBranch != "" {
+		return r.cfg.Git.DefaultBranch, nil
+	}
+	return git.DefaultBranch(ctx, r.runner, r.root, r.cfg.Git.Remotes)
+}
+
+// remotes returns git.remotes, or all remotes with origin first.
+func (r *repository) remotes(ctx context.Context) []string {
+	if len(r.cfg.Git.Remotes) > 0 {
+		return r.cfg.Git.Remotes
+	}
+	remotes, _ := git.Remotes(ctx, r.runner, r.root)
+	return remotes
+}
+
+// mergeTargets resolves cleanup.merge_targets to the refs merge status is
+// computed against. Without configured targets it returns nil, meaning the
+// default branch, or with cleanup.prefer_remote its remote-tracking ref on
+// the first of the remotes that has it.
+func (r *repository) mergeTargets(ctx context.Context, defaultBranch string) []string {
+	if len(r.cfg.Cleanup.MergeTargets) == 0 {
+		if r.cfg.Cleanup.PreferRemote && defaultBranch != "" {
+			for _, remote := range r.remotes(ctx) {
+				if ref, ok := git.RemoteTrackingRef(ctx, r.runner, r.root, remote, defaultBranch); ok {
+					return []string{ref}
+				}
+			}
+		}
+		return nil
+	}
+	targets, err := git.ExpandRefPatterns(ctx, r.runner, r.root, r.cfg.Cleanup.MergeTargets)
+	if err != nil {
+		return nil
+	}
+	return targets
+}
+
+// removeOptions returns how wt is removed: merged branches are deleted with
+// it and local changes are handled as cleanup.on_dirty says. force discards
+// local changes that would otherwise be refused.
+func (r *repository) removeOptions(wt git.Worktree, force bool) git.RemoveOptions {
+	opts := git.RemoveOptions{
+		DeleteBranch:      wt.IsMerged,
+		ForceDeleteBranch: wt.MergedBy == git.MergedByRebase || wt.MergedBy == git.MergedBySquash,
+	}
+	if r.cfg.Cleanup.OnDirty == "refuse" {
+		opts.Dirty = git.DirtyRefuse
+		if force {
+			opts.Dirty = git.DirtyDiscard
+		}
+	}
+	return opts
+}
+
+// removeWorktree removes wt with opts and records the removal in the journal
+// so that it can be undone. If only recording fails, the returned Removal has
+// a RemovedAt time along with the error.
+func (r *repository) removeWorktree(ctx context.Context, wt git.Worktree, opts git.RemoveOptions) (git.Removal, error) {
+	rm, err := git.RemoveWorktree(ctx, r.runner, r.root, wt.Path, opts)
+	ev := git.Event{Action: git.ActionRemove, Branch: wt.BranchShort(), Path: wt.Path}
+	var details []string
+	if rm.BranchTip != "" {
+		flag := "-d"
+		if opts.ForceDeleteBranch {
+			flag = "-D"
+		}
+		details = append(details, fmt.Sprintf("deleted branch with git branch %s", flag))
+	}
+	if rm.Backup != "" {
+		details = append(details, "saved local changes to "+rm.Backup)
+	}
+	ev.Detail = strings.Join(details, "; ")
+	if err != nil {
+		ev.Error = git.Describe(err)
+	}
+	r.logEvent(ctx, ev)
+	if err != nil {
+		return rm, err
+	}
+	if err := git.RecordRemoval(ctx, r.runner, r.root, rm); err != nil {
+		return rm, fmt.Errorf("could not record the removal for undo: %w", err)
+	}
+	return rm, nil
+}
+
+// logEvent appends ev to the audit log. Logging is best effort: a failure to
+// write the log never fails the command.
+func (r *repository) logEvent(ctx context.Context, ev git.Event) {
+	_ = git.LogEvent(ctx, r.runner, r.root, ev)
+}
+
+// worktreeErrorMessage explains why a worktree could not be removed or moved
+// and, where possible, how to resolve it.
+func worktreeErrorMessage(err error) string {
+	var gitErr *git.GitError
+	if !errors.As(err, &gitErr) {
+		return err.Error()
+	}
+	switch gitErr.Kind {
+	case git.KindLocked:
+		return "worktree is locked; unlock it with 'git wt unlock' first"
+	case git.KindMissing:
+		return "not a registered worktree; run 'git worktree prune'"
+	case git.KindDirty:
+		return "worktree has local changes; use --force to discard them"
+	default:
+		return git.Describe(err)
+	}
+}
+
+// confirm asks a yes/no question on stdin. Anything but "y" or "yes" is a
+// no, and so is an interrupt while waiting for the answer.
+func confirm(ctx context.Context, question string) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+	fmt.Printf("  %s (y/N): ", question)
+	answers := make(chan string, 1)
+	go func() {
+		answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+		answers <- answer
+	}()
+	select {
+	case answer := <-answers:
+		answer = strings.TrimSpace(strings.ToLower(answer))
+		return answer == "y" || answer == "yes"
+	case <-ctx.Done():
+		// Ctrl+C at the prompt; the pending read is abandoned on exit.
+		fmt.Println()
+		return false
+	}
+}
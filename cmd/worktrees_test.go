@@ -0,0 +1,171 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/yasomaru/git-wt/internal/git"
+	"github.com/yasomaru/git-wt/internal/git/gittest"
+)
+
+// useFakeRunner makes commands issue their git calls to a FakeRunner for the
+// duration of the test.
+func useFakeRunner(t *testing.T) *gittest.FakeRunner {
+	t.Helper()
+	fake := gittest.NewFakeRunner()
+	orig := newRunner
+	newRunner = func(time.Duration) git.Runner { return fake }
+	t.Cleanup(func() { newRunner = orig })
+	return fake
+}
+
+func TestOpenRepo_NotARepo(t *testing.T) {
+	fake := useFakeRunner(t)
+	fake.Stub("rev-parse --git-common-dir", "", gittest.Fail(git.KindNotARepo,
+		"fatal: not a git repository (or any of the parent directories): .git",
+		"rev-parse", "--git-common-dir"))
+
+	_, err := openRepo(t.Context())
+	if err == nil || err.Error() != "not a git repository" {
+		t.Fatalf("openRepo() error = %v, want %q", err, "not a git repository")
+	}
+}
+
+func TestOpenRepo_OtherFailure(t *testing.T) {
+	fake := useFakeRunner(t)
+	fake.Stub("rev-parse --git-common-dir", "", gittest.Timeout("rev-parse", "--git-common-dir"))
+
+	_, err := openRepo(t.Context())
+	if git.ErrorKindOf(err) == git.KindNotARepo || err == nil {
+		t.Fatalf("openRepo() error = %v, want the underlying timeout", err)
+	}
+}
+
+func TestLoadWorktrees_ListFailure(t *testing.T) {
+	fake := useFakeRunner(t)
+	fake.Stub("rev-parse --git-common-dir", "/repo/.git", nil)
+	want := gittest.Fail(git.KindUnknown, "fatal: unable to read worktrees", "worktree", "list", "--porcelain", "-z")
+	fake.Stub("worktree list --porcelain -z", "", want)
+
+	repo, err := openRepo(t.Context())
+	if err != nil {
+		t.Fatalf("openRepo() error: %v", err)
+	}
+	if _, _, err := repo.loadWorktrees(t.Context()); !errors.Is(err, want) {
+		t.Fatalf("loadWorktrees() error = %v, want %v", err, want)
+	}
+}
+
+func TestLoadWorktrees_StatusTimeout(t *testing.T) {
+	fake := useFakeRunner(t)
+	wtPath := t.TempDir()
+	fake.Stub("rev-parse --git-common-dir", "/repo/.git", nil)
+	fake.Stub("worktree list --porcelain -z", "worktree "+wtPath+"\x00HEAD abc\x00branch refs/heads/feature\x00\x00", nil)
+	fake.Stub("remote", "origin", nil)
+	fake.Stub("symbolic-ref refs/remotes/origin/HEAD", "refs/remotes/origin/main", nil)
+	fake.Stub("status --porcelain=v2 --branch -z", "", gittest.Timeout("status", "--porcelain=v2", "--branch", "-z"))
+
+	repo, err := openRepo(t.Context())
+	if err != nil {
+		t.Fatalf("openRepo() error: %v", err)
+	}
+	worktrees, defaultBranch, err := repo.loadWorktrees(t.Context())
+	if err != nil {
+		t.Fatalf("loadWorktrees() error: %v", err)
+	}
+	if defaultBranch != "main" {
+		t.Errorf("defaultBranch = %q, want %q", defaultBranch, "main")
+	}
+	if len(worktrees) != 1 || worktrees[0].StatusText() != "status: timeout" {
+		t.Fatalf("expected a single worktree with status timeout, got %+v", worktrees)
+	}
+}
+
+func TestRepositoryDefaultBranch(t *testing.T) {
+	fake := useFakeRunner(t)
+	fake.Stub("rev-parse --git-common-dir", "/repo/.git", nil)
+	fake.Stub("symbolic-ref refs/remotes/upstream/HEAD", "refs/remotes/upstream/develop", nil)
+
+	repo, err := openRepo(t.Context())
+	if err != nil {
+		t.Fatalf("openRepo() error: %v", err)
+	}
+
+	repo.cfg.Git.Remotes = []string{"upstream"}
+	if got, err := repo.defaultBranch(t.Context()); err != nil || got != "develop" {
+		t.Errorf("defaultBranch() with remotes = %q, %v, want develop", got, err)
+	}
+	if fake.Called("symbolic-ref refs/remotes/origin/HEAD") {
+		t.Error("origin was consulted although git.remotes does not list it")
+	}
+
+	repo.cfg.Git.DefaultBranch = "trunk"
+	if got, err := repo.defaultBranch(t.Context()); err != nil || got != "trunk" {
+		t.Errorf("defaultBranch() with default_branch = %q, %v, want trunk", got, err)
+	}
+}
+
+func TestWorktreeErrorMessage(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want string
+	}{
+		{"locked", &git.GitError{Kind: git.KindLocked}, "unlock"},
+		{"missing", &git.GitError{Kind: git.KindMissing}, "prune"},
+		{"dirty", &git.GitError{Kind: git.KindDirty}, "--force"},
+		{"plain", errors.New("boom"), "boom"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := worktreeErrorMessage(tc.err); !strings.Contains(got, tc.want) {
+				t.Errorf("worktreeErrorMessage() = %q, want it to contain %q", got, tc.want)
+			}
+		})
+	}
+}
+
+// useStdin replaces os.Stdin with a pipe for the duration of the test and
+// returns its write end.
+func useStdin(t *testing.T) *os.File {
+	t.Helper()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	orig := os.Stdin
+	os.Stdin = r
+	t.Cleanup(func() {
+		os.Stdin = orig
+		w.Close()
+		r.Close()
+	})
+	return w
+}
+
+func TestConfirm(t *testing.T) {
+	w := useStdin(t)
+	if _, err := w.WriteString("Yes\n"); err != nil {
+		t.Fatal(err)
+	}
+	if !confirm(context.Background(), "Continue?") {
+		t.Error("confirm() = false for \"Yes\", want true")
+	}
+}
+
+func TestConfirm_Interrupted(t *testing.T) {
+	useStdin(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(10*time.Millisecond, cancel)
+	// Nothing is ever written to stdin, so only the interrupt can end the wait.
+	if confirm(ctx, "Continue?") {
+		t.Error("confirm() = true after an interrupt, want false")
+	}
+	if confirm(ctx, "Continue?") {
+		t.Error("confirm() = true with a cancelled context, want false")
+	}
+}
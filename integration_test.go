@@ -4,6 +4,7 @@ package main
 
 import (
 	"bytes"
+	"encoding/json"
 	"os"
 	"os/exec"
 	"path/filepath"
@@ -293,6 +294,272 @@ func TestAdd_OutsideGitRepo(t *testing.T) {
 	}
 }
 
+func TestAdd_BranchCheckedOutElsewhere(t *testing.T) {
+	repo := evalDir(t, testutil.InitTestRepo(t))
+
+	// master is checked out in the main worktree.
+	_, stderr, err := runBinary(t, binPath, repo, "add", "master")
+	if err == nil {
+		t.Fatal("expected error when adding a branch that is already checked out, got nil")
+	}
+	if !strings.Contains(stderr, "already checked out in another worktree") {
+		t.Errorf("expected checked-out message in stderr, got: %s", stderr)
+	}
+}
+
+func TestAdd_Submodules(t *testing.T) {
+	repo := evalDir(t, testutil.InitTestRepo(t))
+	testutil.AddSubmodule(t, repo, "libs/sub")
+
+	stdout, stderr, err := runBinary(t, binPath, repo, "add", "plain")
+	if err != nil {
+		t.Fatalf("add failed: %v\nstdout: %s\nstderr: %s", err, stdout, stderr)
+	}
+	plainPath := filepath.Join(filepath.Dir(repo), filepath.Base(repo)+"-plain")
+	if _, err := os.Stat(filepath.Join(plainPath, "libs/sub/README.md")); err == nil {
+		t.Error("expected submodules to be left alone without --submodules")
+	}
+
+	stdout, stderr, err = runBinary(t, binPath, repo, "add", "with-subs", "--submodules")
+	if err != nil {
+		t.Fatalf("add --submodules failed: %v\nstdout: %s\nstderr: %s", err, stdout, stderr)
+	}
+	if !strings.Contains(stdout, "Submodules: 1 updated") {
+		t.Errorf("expected submodule summary, got: %s", stdout)
+	}
+	wtPath := filepath.Join(filepath.Dir(repo), filepath.Base(repo)+"-with-subs")
+	subPath := filepath.Join(wtPath, "libs/sub")
+	if _, err := os.Stat(filepath.Join(subPath, "README.md")); err != nil {
+		t.Fatalf("expected submodule to be checked out: %v", err)
+	}
+
+	testutil.WriteFile(t, subPath, "README.md", "changed\n")
+	stdout, stderr, err = runBinary(t, binPath, repo, "ls")
+	if err != nil {
+		t.Fatalf("ls failed: %v\nstderr: %s", err, stderr)
+	}
+	if !strings.Contains(stdout, "1 dirty submodule") {
+		t.Errorf("expected ls to show the dirty submodule, got: %s", stdout)
+	}
+
+	gitRun(t, subPath, "checkout", "README.md")
+	stdout, stderr, err = runBinary(t, binPath, repo, "clean", "--merged", "--force")
+	if err != nil {
+		t.Fatalf("clean failed: %v\nstdout: %s\nstderr: %s", err, stdout, stderr)
+	}
+	if _, err := os.Stat(wtPath); !os.IsNotExist(err) {
+		t.Errorf("expected worktree with submodules to be removed, got: %s", stdout)
+	}
+}
+
+func TestAdd_SparseProfile(t *testing.T) {
+	repo := evalDir(t, testutil.InitTestRepo(t))
+	testutil.WriteFile(t, repo, "apps/web/index.html", "web\n")
+	testutil.WriteFile(t, repo, "apps/api/main.go", "package main\n")
+	gitRun(t, repo, "add", ".")
+	gitRun(t, repo, "commit", "-m", "apps")
+	writeLocalConfig(t, repo, `
+[sparse]
+web = ["apps/web"]
+`)
+
+	_, stderr, err := runBinary(t, binPath, repo, "add", "nope", "--sparse", "missing")
+	if err == nil || !strings.Contains(stderr, `unknown sparse-checkout profile "missing"`) {
+		t.Errorf("expected unknown profile error, got err=%v stderr=%s", err, stderr)
+	}
+	if branchExists(t, repo, "nope") {
+		t.Error("expected no branch to be created for an unknown profile")
+	}
+
+	stdout, stderr, err := runBinary(t, binPath, repo, "add", "feature-web", "--sparse", "web")
+	if err != nil {
+		t.Fatalf("add --sparse failed: %v\nstdout: %s\nstderr: %s", err, stdout, stderr)
+	}
+	wtPath := filepath.Join(filepath.Dir(repo), filepath.Base(repo)+"-feature-web")
+	if _, err := os.Stat(filepath.Join(wtPath, "apps/web/index.html")); err != nil {
+		t.Errorf("expected apps/web to be checked out: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(wtPath, "apps/api")); !os.IsNotExist(err) {
+		t.Error("expected apps/api not to be checked out")
+	}
+
+	stdout, stderr, err = runBinary(t, binPath, repo, "ls")
+	if err != nil {
+		t.Fatalf("ls failed: %v\nstderr: %s", err, stderr)
+	}
+	for _, line := range strings.Split(stdout, "\n") {
+		if strings.Contains(line, "feature-web") != strings.Contains(line, "(sparse)") {
+			t.Errorf("expected only feature-web to be marked sparse, got line: %s", line)
+		}
+	}
+}
+
+func TestAdd_FromLinkedWorktree(t *testing.T) {
+	repo := evalDir(t, testutil.InitTestRepo(t))
+	writeLocalConfig(t, repo, `
+[layout]
+strategy = "subdirectory"
+`)
+
+	stdout, stderr, err := runBinary(t, binPath, repo, "add", "feature")
+	if err != nil {
+		t.Fatalf("add failed: %v\nstdout: %s\nstderr: %s", err, stdout, stderr)
+	}
+	featurePath := filepath.Join(repo, ".worktrees", "feature")
+	testutil.MakeCommit(t, featurePath, "feature work")
+
+	// The main worktree's config and layout apply, and the new branch starts
+	// from the HEAD of the worktree add runs in.
+	stdout, stderr, err = runBinary(t, binPath, featurePath, "add", "followup")
+	if err != nil {
+		t.Fatalf("add from linked worktree failed: %v\nstdout: %s\nstderr: %s", err, stdout, stderr)
+	}
+	followupPath := filepath.Join(repo, ".worktrees", "followup")
+	if _, err := os.Stat(followupPath); err != nil {
+		t.Errorf("expected worktree at %s, not nested in the linked worktree: %v", followupPath, err)
+	}
+	if got, want := gitRun(t, repo, "rev-parse", "followup"), gitRun(t, repo, "rev-parse", "feature"); got != want {
+		t.Errorf("followup starts at %s, want the feature HEAD %s", got, want)
+	}
+
+	stdout, stderr, err = runBinary(t, binPath, featurePath, "ls")
+	if err != nil {
+		t.Fatalf("ls failed: %v\nstderr: %s", err, stderr)
+	}
+	if got := strings.Count(stdout, "* "); got != 1 || !strings.Contains(stdout, "* feature") {
+		t.Errorf("expected only the nested feature worktree to be current, got: %s", stdout)
+	}
+}
+
+// addOrigin adds a bare clone of repo as its origin remote and returns the
+// remote's path.
+func addOrigin(t *testing.T, repo string) string {
+	t.Helper()
+	remote := filepath.Join(t.TempDir(), "origin.git")
+	gitRun(t, repo, "clone", "--bare", repo, remote)
+	gitRun(t, repo, "remote", "add", "origin", remote)
+	gitRun(t, repo, "fetch", "origin")
+	return remote
+}
+
+// pushFromClone commits to branch in a fresh clone of remote and pushes it,
+// as a teammate would.
+func pushFromClone(t *testing.T, remote, branch string) {
+	t.Helper()
+	clone := filepath.Join(t.TempDir(), "clone")
+	gitRun(t, "", "clone", remote, clone)
+	gitRun(t, clone, "config", "user.email", "test@example.com")
+	gitRun(t, clone, "config", "user.name", "Test")
+	gitRun(t, clone, "checkout", "-B", branch)
+	testutil.MakeCommit(t, clone, "pushed to "+branch)
+	gitRun(t, clone, "push", "origin", branch)
+}
+
+func TestAdd_RemoteBranchTracks(t *testing.T) {
+	repo := evalDir(t, testutil.InitTestRepo(t))
+	remote := addOrigin(t, repo)
+	pushFromClone(t, remote, "remote-only")
+	gitRun(t, repo, "fetch", "origin")
+
+	stdout, stderr, err := runBinary(t, binPath, repo, "add", "remote-only")
+	if err != nil {
+		t.Fatalf("add failed: %v\nstdout: %s\nstderr: %s", err, stdout, stderr)
+	}
+	if !strings.Contains(stdout, "Tracking: origin/remote-only") {
+		t.Errorf("expected tracking info, got: %s", stdout)
+	}
+	if got, want := gitRun(t, repo, "rev-parse", "remote-only"), gitRun(t, repo, "rev-parse", "origin/remote-only"); got != want {
+		t.Errorf("remote-only = %s, want the remote branch %s", got, want)
+	}
+	if upstream := gitRun(t, repo, "rev-parse", "--abbrev-ref", "remote-only@{upstream}"); strings.TrimSpace(upstream) != "origin/remote-only" {
+		t.Errorf("upstream = %q, want origin/remote-only", upstream)
+	}
+}
+
+func TestAdd_FetchRemoteNoTrack(t *testing.T) {
+	repo := evalDir(t, testutil.InitTestRepo(t))
+	remote := addOrigin(t, repo)
+	pushFromClone(t, remote, "fresh")
+
+	stdout, stderr, err := runBinary(t, binPath, repo, "add", "fresh", "--fetch", "--remote", "origin", "--no-track")
+	if err != nil {
+		t.Fatalf("add --fetch failed: %v\nstdout: %s\nstderr: %s", err, stdout, stderr)
+	}
+	if got, want := gitRun(t, repo, "rev-parse", "fresh"), gitRun(t, repo, "rev-parse", "origin/fresh"); got != want {
+		t.Errorf("fresh = %s, want the fetched remote branch %s", got, want)
+	}
+	if strings.Contains(stdout, "Tracking:") {
+		t.Errorf("expected no tracking with --no-track, got: %s", stdout)
+	}
+	cmd := exec.Command("git", "rev-parse", "--abbrev-ref", "fresh@{upstream}")
+	cmd.Dir = repo
+	if err := cmd.Run(); err == nil {
+		t.Error("expected fresh to have no upstream")
+	}
+}
+
+func TestAdd_RemoteBranchNotFound(t *testing.T) {
+	repo := evalDir(t, testutil.InitTestRepo(t))
+	addOrigin(t, repo)
+
+	_, stderr, err := runBinary(t, binPath, repo, "add", "missing", "--remote", "origin")
+	if err == nil || !strings.Contains(stderr, "not found on remote") {
+		t.Errorf("expected add of a missing remote branch to fail, got err=%v stderr=%s", err, stderr)
+	}
+	if branchExists(t, repo, "missing") {
+		t.Error("expected no branch to be created")
+	}
+}
+
+func TestAdd_TrackExistingBranch(t *testing.T) {
+	repo := evalDir(t, testutil.InitTestRepo(t))
+	remote := addOrigin(t, repo)
+	pushFromClone(t, remote, "dev")
+	gitRun(t, repo, "fetch", "origin")
+	gitRun(t, repo, "branch", "--no-track", "dev", "origin/dev")
+	busy := testutil.AddWorktree(t, repo, "busy")
+	gitRun(t, busy, "checkout", "dev")
+
+	// A failed add must not leave the upstream configured.
+	if _, stderr, err := runBinary(t, binPath, repo, "add", "dev", "--track"); err == nil {
+		t.Fatalf("expected add of a checked-out branch to fail, stderr: %s", stderr)
+	}
+	cmd := exec.Command("git", "config", "--get", "branch.dev.remote")
+	cmd.Dir = repo
+	if out, err := cmd.Output(); err == nil {
+		t.Errorf("expected no upstream after the failed add, got branch.dev.remote=%s", out)
+	}
+
+	gitRun(t, busy, "checkout", "busy")
+	stdout, stderr, err := runBinary(t, binPath, repo, "add", "dev", "--track")
+	if err != nil {
+		t.Fatalf("add --track failed: %v\nstdout: %s\nstderr: %s", err, stdout, stderr)
+	}
+	if upstream := gitRun(t, repo, "rev-parse", "--abbrev-ref", "dev@{upstream}"); strings.TrimSpace(upstream) != "origin/dev" {
+		t.Errorf("upstream = %q, want origin/dev", upstream)
+	}
+}
+
+func TestAdd_DivergedWarning(t *testing.T) {
+	repo := evalDir(t, testutil.InitTestRepo(t))
+	remote := addOrigin(t, repo)
+	pushFromClone(t, remote, "shared")
+	gitRun(t, repo, "fetch", "origin")
+	gitRun(t, repo, "branch", "shared", "master")
+	wtPath := testutil.AddWorktree(t, repo, "scratch")
+	gitRun(t, wtPath, "checkout", "shared")
+	testutil.MakeCommit(t, wtPath, "local work")
+	gitRun(t, wtPath, "checkout", "scratch")
+
+	stdout, stderr, err := runBinary(t, binPath, repo, "add", "shared")
+	if err != nil {
+		t.Fatalf("add failed: %v\nstdout: %s\nstderr: %s", err, stdout, stderr)
+	}
+	if !strings.Contains(stdout, "shared and origin/shared have diverged (1 local and 1 remote commits)") {
+		t.Errorf("expected a divergence warning, got: %s", stdout)
+	}
+}
+
 // ===========================================================================
 // LS COMMAND TESTS
 // ===========================================================================
@@ -379,6 +646,40 @@ func TestLs_MergedBranch(t *testing.T) {
 	}
 }
 
+func TestLs_UnknownDefaultBranch(t *testing.T) {
+	repo := evalDir(t, testutil.InitTestRepo(t))
+	gitRun(t, repo, "branch", "-M", "develop")
+	wtPath := testutil.AddWorktree(t, repo, "feature")
+	testutil.MakeCommit(t, wtPath, "feature")
+	gitRun(t, repo, "merge", "feature")
+
+	stdout, stderr, err := runBinary(t, binPath, repo, "ls")
+	if err != nil {
+		t.Fatalf("ls failed: %v\nstderr: %s", err, stderr)
+	}
+	if !strings.Contains(stderr, "cannot determine the default branch") {
+		t.Errorf("expected a warning about the default branch, got stderr: %s", stderr)
+	}
+	if strings.Contains(stdout, "merged") {
+		t.Errorf("expected no merge status without a default branch, got: %s", stdout)
+	}
+
+	writeLocalConfig(t, repo, `
+[git]
+default_branch = "develop"
+`)
+	stdout, stderr, err = runBinary(t, binPath, repo, "ls")
+	if err != nil {
+		t.Fatalf("ls failed: %v\nstderr: %s", err, stderr)
+	}
+	if strings.Contains(stderr, "Warning") {
+		t.Errorf("expected no warning with git.default_branch, got stderr: %s", stderr)
+	}
+	if !strings.Contains(stdout, "merged") {
+		t.Errorf("expected feature to be merged into develop, got: %s", stdout)
+	}
+}
+
 func TestLs_DetachedHead(t *testing.T) {
 	repo := evalDir(t, testutil.InitTestRepo(t))
 
@@ -403,6 +704,32 @@ func TestLs_DetachedHead(t *testing.T) {
 	}
 }
 
+func TestLs_LockedAndPrunable(t *testing.T) {
+	repo := evalDir(t, testutil.InitTestRepo(t))
+
+	lockedPath := testutil.AddWorktree(t, repo, "locked-branch")
+	gitRun(t, repo, "worktree", "lock", "--reason", "usb drive", lockedPath)
+	t.Cleanup(func() {
+		exec.Command("git", "-C", repo, "worktree", "unlock", lockedPath).Run()
+	})
+	gonePath := testutil.AddWorktree(t, repo, "gone-branch")
+	if err := os.RemoveAll(gonePath); err != nil {
+		t.Fatal(err)
+	}
+
+	stdout, stderr, err := runBinary(t, binPath, repo, "ls")
+	if err != nil {
+		t.Fatalf("ls failed: %v\nstdout: %s\nstderr: %s", err, stdout, stderr)
+	}
+
+	if !strings.Contains(stdout, "(locked: usb drive)") {
+		t.Errorf("expected '(locked: usb drive)' in output, got: %s", stdout)
+	}
+	if !strings.Contains(stdout, "(prunable)") {
+		t.Errorf("expected '(prunable)' in output, got: %s", stdout)
+	}
+}
+
 // ===========================================================================
 // CLEAN COMMAND TESTS
 // ===========================================================================
@@ -430,6 +757,162 @@ func TestClean_MergedFlag(t *testing.T) {
 	}
 }
 
+func TestClean_SquashMergedWithDetection(t *testing.T) {
+	repo := evalDir(t, testutil.InitTestRepo(t))
+	writeLocalConfig(t, repo, `
+[cleanup]
+merge_detection = "squash"
+`)
+
+	wtPath := testutil.AddWorktree(t, repo, "squashed")
+	testutil.MakeCommit(t, wtPath, "first")
+	testutil.MakeCommit(t, wtPath, "second")
+	gitRun(t, repo, "merge", "--squash", "squashed")
+	gitRun(t, repo, "commit", "-m", "Squashed feature (#1)")
+
+	stdout, stderr, err := runBinary(t, binPath, repo, "clean", "--merged", "--force")
+	if err != nil {
+		t.Fatalf("clean failed: %v\nstdout: %s\nstderr: %s", err, stdout, stderr)
+	}
+	if !strings.Contains(stdout, "merged via squash") {
+		t.Errorf("expected 'merged via squash' reason, got: %s", stdout)
+	}
+	if _, err := os.Stat(wtPath); !os.IsNotExist(err) {
+		t.Error("expected squash-merged worktree to be removed")
+	}
+	if branchExists(t, repo, "squashed") {
+		t.Error("expected squash-merged branch to be deleted")
+	}
+}
+
+func TestClean_SquashMergedIgnoredByDefault(t *testing.T) {
+	repo := evalDir(t, testutil.InitTestRepo(t))
+
+	wtPath := testutil.AddWorktree(t, repo, "squashed")
+	testutil.MakeCommit(t, wtPath, "first")
+	gitRun(t, repo, "merge", "--squash", "squashed")
+	gitRun(t, repo, "commit", "-m", "Squashed feature (#1)")
+
+	stdout, _, err := runBinary(t, binPath, repo, "clean", "--merged", "--force")
+	if err != nil {
+		t.Fatalf("clean failed: %v", err)
+	}
+	if !strings.Contains(stdout, "No worktrees to clean up") {
+		t.Errorf("expected squash merge to be ignored without merge_detection, got: %s", stdout)
+	}
+}
+
+func TestClean_MergedIntoConfiguredTarget(t *testing.T) {
+	repo := evalDir(t, testutil.InitTestRepo(t))
+	writeLocalConfig(t, repo, `
+[cleanup]
+merge_targets = ["master", "release/*"]
+`)
+
+	wtPath := testutil.AddWorktree(t, repo, "hotfix")
+	testutil.MakeCommit(t, wtPath, "fix")
+	gitRun(t, repo, "branch", "release/1.0", "hotfix")
+	keepPath := testutil.AddWorktree(t, repo, "feature")
+	testutil.MakeCommit(t, keepPath, "feature")
+
+	stdout, stderr, err := runBinary(t, binPath, repo, "clean", "--merged", "--dry-run")
+	if err != nil {
+		t.Fatalf("clean failed: %v\nstdout: %s\nstderr: %s", err, stdout, stderr)
+	}
+	if !strings.Contains(stdout, "merged into release/1.0") {
+		t.Errorf("expected 'merged into release/1.0' reason, got: %s", stdout)
+	}
+	if strings.Contains(stdout, "feature") {
+		t.Errorf("expected unmerged feature to be kept, got: %s", stdout)
+	}
+}
+
+func TestLs_PreferRemoteMergeTarget(t *testing.T) {
+	repo := evalDir(t, testutil.InitTestRepo(t))
+	writeLocalConfig(t, repo, `
+[cleanup]
+prefer_remote = true
+`)
+	// The remote must share history with repo for the push below.
+	remote := filepath.Join(t.TempDir(), "remote.git")
+	gitRun(t, repo, "clone", "--bare", repo, remote)
+	gitRun(t, repo, "remote", "add", "origin", remote)
+	gitRun(t, repo, "fetch", "origin")
+
+	wtPath := testutil.AddWorktree(t, repo, "landed")
+	testutil.MakeCommit(t, wtPath, "landed upstream")
+	gitRun(t, wtPath, "push", "origin", "landed:master")
+	gitRun(t, repo, "fetch", "origin")
+
+	stdout, stderr, err := runBinary(t, binPath, repo, "ls")
+	if err != nil {
+		t.Fatalf("ls failed: %v\nstderr: %s", err, stderr)
+	}
+	if !strings.Contains(stdout, "merged into origin/master") {
+		t.Errorf("expected 'merged into origin/master', got: %s", stdout)
+	}
+}
+
+// pushAndDeleteUpstream gives branch an upstream on a new remote and then
+// deletes it there, as happens when a pull request is merged.
+func pushAndDeleteUpstream(t *testing.T, repo, wtPath, branch string) {
+	t.Helper()
+	remote := testutil.InitTestRepo(t)
+	gitRun(t, repo, "remote", "add", "origin", remote)
+	gitRun(t, wtPath, "push", "-u", "origin", branch)
+	gitRun(t, wtPath, "push", "origin", "--delete", branch)
+}
+
+func TestClean_GoneFlag(t *testing.T) {
+	repo := evalDir(t, testutil.InitTestRepo(t))
+	gonePath := testutil.AddWorktree(t, repo, "gone-branch")
+	testutil.MakeCommit(t, gonePath, "feature")
+	pushAndDeleteUpstream(t, repo, gonePath, "gone-branch")
+	keepPath := testutil.AddWorktree(t, repo, "local-only")
+	testutil.MakeCommit(t, keepPath, "local")
+
+	stdout, stderr, err := runBinary(t, binPath, repo, "ls")
+	if err != nil {
+		t.Fatalf("ls failed: %v\nstderr: %s", err, stderr)
+	}
+	if !strings.Contains(stdout, "(upstream gone)") {
+		t.Errorf("expected ls to show '(upstream gone)', got: %s", stdout)
+	}
+
+	stdout, stderr, err = runBinary(t, binPath, repo, "clean", "--gone", "--force")
+	if err != nil {
+		t.Fatalf("clean --gone failed: %v\nstdout: %s\nstderr: %s", err, stdout, stderr)
+	}
+	if !strings.Contains(stdout, "upstream gone") {
+		t.Errorf("expected 'upstream gone' reason, got: %s", stdout)
+	}
+	if _, err := os.Stat(gonePath); !os.IsNotExist(err) {
+		t.Error("expected worktree with gone upstream to be removed")
+	}
+	if _, err := os.Stat(keepPath); err != nil {
+		t.Error("expected worktree without upstream to be kept")
+	}
+}
+
+func TestClean_IncludeGoneConfig(t *testing.T) {
+	repo := evalDir(t, testutil.InitTestRepo(t))
+	writeLocalConfig(t, repo, `
+[cleanup]
+include_gone = true
+`)
+	gonePath := testutil.AddWorktree(t, repo, "gone-branch")
+	testutil.MakeCommit(t, gonePath, "feature")
+	pushAndDeleteUpstream(t, repo, gonePath, "gone-branch")
+
+	stdout, stderr, err := runBinary(t, binPath, repo, "clean", "--dry-run")
+	if err != nil {
+		t.Fatalf("clean --dry-run failed: %v\nstdout: %s\nstderr: %s", err, stdout, stderr)
+	}
+	if !strings.Contains(stdout, "gone-branch") || !strings.Contains(stdout, "upstream gone") {
+		t.Errorf("expected gone branch as a candidate, got: %s", stdout)
+	}
+}
+
 func TestClean_StaleFlagSkipsFresh(t *testing.T) {
 	repo := evalDir(t, testutil.InitTestRepo(t))
 
@@ -613,52 +1096,200 @@ func TestClean_MergedForceCombination(t *testing.T) {
 	}
 }
 
-// ===========================================================================
-// INIT COMMAND TESTS
-// ===========================================================================
-
-func TestInit_GlobalConfig(t *testing.T) {
+func TestClean_SkipsLocked(t *testing.T) {
 	repo := evalDir(t, testutil.InitTestRepo(t))
 
-	// Use a fake HOME directory to avoid polluting the real home.
-	fakeHome := t.TempDir()
+	wtPath := testutil.AddWorktree(t, repo, "locked-merged")
+	testutil.MakeCommit(t, wtPath, "feature")
+	gitRun(t, repo, "merge", "locked-merged")
+	gitRun(t, repo, "worktree", "lock", wtPath)
+	t.Cleanup(func() {
+		exec.Command("git", "-C", repo, "worktree", "unlock", wtPath).Run()
+	})
 
-	stdout, stderr, err := runBinaryWithHome(t, binPath, repo, fakeHome, "init")
+	stdout, _, err := runBinary(t, binPath, repo, "clean", "--merged", "--force")
 	if err != nil {
-		t.Fatalf("init failed: %v\nstdout: %s\nstderr: %s", err, stdout, stderr)
+		t.Fatalf("clean failed: %v", err)
 	}
 
-	expectedPath := filepath.Join(fakeHome, ".config", "git-wt", "config.toml")
-	if _, statErr := os.Stat(expectedPath); os.IsNotExist(statErr) {
-		t.Errorf("expected global config at %s", expectedPath)
+	if _, statErr := os.Stat(wtPath); os.IsNotExist(statErr) {
+		t.Error("expected locked worktree to be preserved")
 	}
-
-	if !strings.Contains(stdout, "Created config") {
-		t.Errorf("expected 'Created config' in output, got: %s", stdout)
+	if !strings.Contains(stdout, "No worktrees to clean up") {
+		t.Errorf("expected 'No worktrees to clean up', got: %s", stdout)
 	}
 }
 
-func TestInit_LocalConfig(t *testing.T) {
+func TestClean_IncludeLocked(t *testing.T) {
 	repo := evalDir(t, testutil.InitTestRepo(t))
 
-	stdout, stderr, err := runBinary(t, binPath, repo, "init", "--local")
+	wtPath := testutil.AddWorktree(t, repo, "locked-merged")
+	testutil.MakeCommit(t, wtPath, "feature")
+	gitRun(t, repo, "merge", "locked-merged")
+	gitRun(t, repo, "worktree", "lock", wtPath)
+
+	stdout, stderr, err := runBinary(t, binPath, repo, "clean", "--merged", "--include-locked", "--force")
 	if err != nil {
-		t.Fatalf("init --local failed: %v\nstdout: %s\nstderr: %s", err, stdout, stderr)
+		t.Fatalf("clean failed: %v\nstdout: %s\nstderr: %s", err, stdout, stderr)
 	}
 
-	expectedPath := filepath.Join(repo, ".git-wt.toml")
-	if _, statErr := os.Stat(expectedPath); os.IsNotExist(statErr) {
-		t.Errorf("expected local config at %s", expectedPath)
+	if _, statErr := os.Stat(wtPath); !os.IsNotExist(statErr) {
+		t.Error("expected locked worktree to be removed with --include-locked")
 	}
 }
 
-func TestInit_AlreadyExists(t *testing.T) {
+func TestClean_SkipsOperationInProgress(t *testing.T) {
 	repo := evalDir(t, testutil.InitTestRepo(t))
 
-	// Create the local config first.
-	writeLocalConfig(t, repo, "# existing config\n")
+	wtPath := testutil.AddWorktree(t, repo, "bisecting")
+	testutil.MakeCommit(t, wtPath, "feature")
+	gitRun(t, repo, "merge", "bisecting")
+	gitRun(t, wtPath, "bisect", "start")
 
-	_, stderr, err := runBinary(t, binPath, repo, "init", "--local")
+	stdout, stderr, err := runBinary(t, binPath, repo, "clean", "--merged", "--force")
+	if err != nil {
+		t.Fatalf("clean failed: %v\nstdout: %s\nstderr: %s", err, stdout, stderr)
+	}
+	if _, statErr := os.Stat(wtPath); statErr != nil {
+		t.Fatal("expected the worktree mid-bisect to be kept")
+	}
+	if !strings.Contains(stdout, "bisect in progress") {
+		t.Errorf("expected the skipped operation in output, got: %s", stdout)
+	}
+
+	stdout, _, err = runBinary(t, binPath, repo, "ls")
+	if err != nil || !strings.Contains(stdout, "bisect in progress") {
+		t.Errorf("expected ls to show the operation, got err=%v stdout=%s", err, stdout)
+	}
+}
+
+func TestClean_BacksUpDirtyWorktree(t *testing.T) {
+	repo := evalDir(t, testutil.InitTestRepo(t))
+
+	wtPath := testutil.AddWorktree(t, repo, "dirty-merged")
+	testutil.MakeCommit(t, wtPath, "feature")
+	gitRun(t, repo, "merge", "dirty-merged")
+	testutil.WriteFile(t, wtPath, "notes.txt", "keep me\n")
+
+	stdout, stderr, err := runBinary(t, binPath, repo, "clean", "--merged", "--force")
+	if err != nil {
+		t.Fatalf("clean failed: %v\nstdout: %s\nstderr: %s", err, stdout, stderr)
+	}
+	if _, statErr := os.Stat(wtPath); !os.IsNotExist(statErr) {
+		t.Error("expected dirty worktree to be removed")
+	}
+	if !strings.Contains(stdout, "refs/wt-backup/dirty-merged/") || !strings.Contains(stdout, "git stash apply") {
+		t.Errorf("expected backup ref and restore hint in output, got: %s", stdout)
+	}
+
+	ref := strings.TrimSpace(gitRun(t, repo, "for-each-ref", "--format=%(refname)", "refs/wt-backup/"))
+	gitRun(t, repo, "stash", "apply", ref)
+	if data, readErr := os.ReadFile(filepath.Join(repo, "notes.txt")); readErr != nil || string(data) != "keep me\n" {
+		t.Errorf("expected notes.txt to be restored, got %q (%v)", data, readErr)
+	}
+}
+
+func TestClean_OnDirtyRefuse(t *testing.T) {
+	repo := evalDir(t, testutil.InitTestRepo(t))
+	writeLocalConfig(t, repo, `
+[cleanup]
+on_dirty = "refuse"
+`)
+	wtPath := testutil.AddWorktree(t, repo, "dirty-merged")
+	testutil.MakeCommit(t, wtPath, "feature")
+	gitRun(t, repo, "merge", "dirty-merged")
+	testutil.WriteFile(t, wtPath, "notes.txt", "keep me\n")
+
+	stdout, stderr, err := runBinaryInput(t, binPath, repo, "y\n", "clean", "--merged")
+	if err != nil {
+		t.Fatalf("clean failed: %v\nstdout: %s\nstderr: %s", err, stdout, stderr)
+	}
+	if _, statErr := os.Stat(filepath.Join(wtPath, "notes.txt")); statErr != nil {
+		t.Fatalf("expected dirty worktree to be kept, got: %s", stdout)
+	}
+	if !strings.Contains(stdout, "--force") {
+		t.Errorf("expected a hint to use --force, got: %s", stdout)
+	}
+
+	stdout, stderr, err = runBinary(t, binPath, repo, "clean", "--merged", "--force")
+	if err != nil {
+		t.Fatalf("clean --force failed: %v\nstdout: %s\nstderr: %s", err, stdout, stderr)
+	}
+	if _, statErr := os.Stat(wtPath); !os.IsNotExist(statErr) {
+		t.Error("expected dirty worktree to be removed with --force")
+	}
+	if out := strings.TrimSpace(gitRun(t, repo, "for-each-ref", "refs/wt-backup/")); out != "" {
+		t.Errorf("expected no backup with --force in refuse mode, got %q", out)
+	}
+}
+
+func TestClean_PrunesMissingWorktree(t *testing.T) {
+	repo := evalDir(t, testutil.InitTestRepo(t))
+
+	gonePath := testutil.AddWorktree(t, repo, "gone-branch")
+	if err := os.RemoveAll(gonePath); err != nil {
+		t.Fatal(err)
+	}
+
+	stdout, stderr, err := runBinaryInput(t, binPath, repo, "y\n", "clean")
+	if err != nil {
+		t.Fatalf("clean failed: %v\nstdout: %s\nstderr: %s", err, stdout, stderr)
+	}
+
+	if !strings.Contains(stdout, "prunable") || !strings.Contains(stdout, "Pruned: gone-branch") {
+		t.Errorf("expected prunable candidate to be pruned, got: %s", stdout)
+	}
+	if out := gitRun(t, repo, "worktree", "list"); strings.Contains(out, "gone-branch") {
+		t.Errorf("expected gone-branch to be pruned, worktree list: %s", out)
+	}
+}
+
+// ===========================================================================
+// INIT COMMAND TESTS
+// ===========================================================================
+
+func TestInit_GlobalConfig(t *testing.T) {
+	repo := evalDir(t, testutil.InitTestRepo(t))
+
+	// Use a fake HOME directory to avoid polluting the real home.
+	fakeHome := t.TempDir()
+
+	stdout, stderr, err := runBinaryWithHome(t, binPath, repo, fakeHome, "init")
+	if err != nil {
+		t.Fatalf("init failed: %v\nstdout: %s\nstderr: %s", err, stdout, stderr)
+	}
+
+	expectedPath := filepath.Join(fakeHome, ".config", "git-wt", "config.toml")
+	if _, statErr := os.Stat(expectedPath); os.IsNotExist(statErr) {
+		t.Errorf("expected global config at %s", expectedPath)
+	}
+
+	if !strings.Contains(stdout, "Created config") {
+		t.Errorf("expected 'Created config' in output, got: %s", stdout)
+	}
+}
+
+func TestInit_LocalConfig(t *testing.T) {
+	repo := evalDir(t, testutil.InitTestRepo(t))
+
+	stdout, stderr, err := runBinary(t, binPath, repo, "init", "--local")
+	if err != nil {
+		t.Fatalf("init --local failed: %v\nstdout: %s\nstderr: %s", err, stdout, stderr)
+	}
+
+	expectedPath := filepath.Join(repo, ".git-wt.toml")
+	if _, statErr := os.Stat(expectedPath); os.IsNotExist(statErr) {
+		t.Errorf("expected local config at %s", expectedPath)
+	}
+}
+
+func TestInit_AlreadyExists(t *testing.T) {
+	repo := evalDir(t, testutil.InitTestRepo(t))
+
+	// Create the local config first.
+	writeLocalConfig(t, repo, "# existing config\n")
+
+	_, stderr, err := runBinary(t, binPath, repo, "init", "--local")
 	if err == nil {
 		t.Fatal("expected error when config already exists, got nil")
 	}
@@ -807,6 +1438,639 @@ func TestWorkflow_MultipleWorktrees(t *testing.T) {
 	}
 }
 
+// ===========================================================================
+// LOCK / UNLOCK COMMAND TESTS
+// ===========================================================================
+
+func TestLock_WithReason(t *testing.T) {
+	repo := evalDir(t, testutil.InitTestRepo(t))
+	wtPath := testutil.AddWorktree(t, repo, "experiment-long")
+	t.Cleanup(func() {
+		exec.Command("git", "-C", repo, "worktree", "unlock", wtPath).Run()
+	})
+
+	stdout, stderr, err := runBinary(t, binPath, repo, "lock", "experiment", "--reason", "usb drive")
+	if err != nil {
+		t.Fatalf("lock failed: %v\nstdout: %s\nstderr: %s", err, stdout, stderr)
+	}
+	if !strings.Contains(stdout, "Locked worktree") {
+		t.Errorf("expected 'Locked worktree' in output, got: %s", stdout)
+	}
+
+	out := gitRun(t, repo, "worktree", "list", "--porcelain")
+	if !strings.Contains(out, "locked usb drive") {
+		t.Errorf("expected worktree to be locked with reason, got: %s", out)
+	}
+
+	_, stderr, err = runBinary(t, binPath, repo, "lock", "experiment")
+	if err == nil {
+		t.Fatal("expected error when locking an already locked worktree")
+	}
+	if !strings.Contains(stderr, "already locked") {
+		t.Errorf("expected 'already locked' in stderr, got: %s", stderr)
+	}
+}
+
+func TestUnlock(t *testing.T) {
+	repo := evalDir(t, testutil.InitTestRepo(t))
+	wtPath := testutil.AddWorktree(t, repo, "usb-branch")
+	gitRun(t, repo, "worktree", "lock", wtPath)
+
+	stdout, stderr, err := runBinary(t, binPath, repo, "unlock", "usb")
+	if err != nil {
+		t.Fatalf("unlock failed: %v\nstdout: %s\nstderr: %s", err, stdout, stderr)
+	}
+	if !strings.Contains(stdout, "Unlocked worktree") {
+		t.Errorf("expected 'Unlocked worktree' in output, got: %s", stdout)
+	}
+	if out := gitRun(t, repo, "worktree", "list", "--porcelain"); strings.Contains(out, "locked") {
+		t.Errorf("expected worktree to be unlocked, got: %s", out)
+	}
+
+	_, stderr, err = runBinary(t, binPath, repo, "unlock", "usb")
+	if err == nil {
+		t.Fatal("expected error when unlocking a worktree that is not locked")
+	}
+	if !strings.Contains(stderr, "not locked") {
+		t.Errorf("expected 'not locked' in stderr, got: %s", stderr)
+	}
+}
+
+// ===========================================================================
+// MV COMMAND TESTS
+// ===========================================================================
+
+func TestMv_ExplicitPath(t *testing.T) {
+	repo := evalDir(t, testutil.InitTestRepo(t))
+	oldPath := testutil.AddWorktree(t, repo, "feature-move")
+	newPath := filepath.Join(evalDir(t, t.TempDir()), "elsewhere", "feature-move")
+
+	stdout, stderr, err := runBinary(t, binPath, repo, "mv", "feature-move", newPath)
+	if err != nil {
+		t.Fatalf("mv failed: %v\nstdout: %s\nstderr: %s", err, stdout, stderr)
+	}
+	if !strings.Contains(stdout, "Moved: feature-move") {
+		t.Errorf("expected 'Moved: feature-move', got: %s", stdout)
+	}
+	if _, err := os.Stat(oldPath); !os.IsNotExist(err) {
+		t.Error("expected old worktree path to be gone")
+	}
+	if out := gitRun(t, repo, "worktree", "list"); !strings.Contains(out, newPath) {
+		t.Errorf("expected worktree at %s, got: %s", newPath, out)
+	}
+}
+
+func TestMv_AllFollowsLayout(t *testing.T) {
+	repo := evalDir(t, testutil.InitTestRepo(t))
+	testutil.AddWorktree(t, repo, "alpha")
+	testutil.AddWorktree(t, repo, "beta")
+	writeLocalConfig(t, repo, `
+[layout]
+strategy = "subdirectory"
+`)
+
+	stdout, stderr, err := runBinary(t, binPath, repo, "mv", "--all", "--dry-run")
+	if err != nil {
+		t.Fatalf("mv --all --dry-run failed: %v\nstdout: %s\nstderr: %s", err, stdout, stderr)
+	}
+	if !strings.Contains(stdout, "Worktrees to move (2)") || !strings.Contains(stdout, "Dry run") {
+		t.Errorf("expected dry-run plan for 2 worktrees, got: %s", stdout)
+	}
+	if _, err := os.Stat(filepath.Join(repo, ".worktrees")); !os.IsNotExist(err) {
+		t.Error("dry run must not create the layout directory")
+	}
+
+	stdout, stderr, err = runBinary(t, binPath, repo, "mv", "--all")
+	if err != nil {
+		t.Fatalf("mv --all failed: %v\nstdout: %s\nstderr: %s", err, stdout, stderr)
+	}
+	for _, branch := range []string{"alpha", "beta"} {
+		if _, err := os.Stat(filepath.Join(repo, ".worktrees", branch)); err != nil {
+			t.Errorf("expected %s to be moved into .worktrees: %v", branch, err)
+		}
+	}
+
+	stdout, _, err = runBinary(t, binPath, repo, "mv", "--all")
+	if err != nil {
+		t.Fatalf("second mv --all failed: %v", err)
+	}
+	if !strings.Contains(stdout, "All worktrees match the configured layout") {
+		t.Errorf("expected nothing left to move, got: %s", stdout)
+	}
+}
+
+func TestMv_SkipsDirtyWithoutForce(t *testing.T) {
+	repo := evalDir(t, testutil.InitTestRepo(t))
+	wtPath := testutil.AddWorktree(t, repo, "dirty-move")
+	testutil.WriteFile(t, wtPath, "scratch.txt", "wip\n")
+	newPath := filepath.Join(evalDir(t, t.TempDir()), "dirty-move")
+
+	_, stderr, err := runBinary(t, binPath, repo, "mv", "dirty-move", newPath)
+	if err == nil {
+		t.Fatal("expected mv of a dirty worktree to fail without --force")
+	}
+	if !strings.Contains(stderr, "untracked") {
+		t.Errorf("expected dirty status in error, got: %s", stderr)
+	}
+	if _, err := os.Stat(wtPath); err != nil {
+		t.Error("expected dirty worktree to stay in place")
+	}
+
+	stdout, stderr, err := runBinary(t, binPath, repo, "mv", "dirty-move", newPath, "--force")
+	if err != nil {
+		t.Fatalf("mv --force failed: %v\nstdout: %s\nstderr: %s", err, stdout, stderr)
+	}
+	if _, err := os.Stat(filepath.Join(newPath, "scratch.txt")); err != nil {
+		t.Errorf("expected local changes to move with the worktree: %v", err)
+	}
+}
+
+// ===========================================================================
+// RENAME COMMAND TESTS
+// ===========================================================================
+
+func TestRename_BranchAndDirectory(t *testing.T) {
+	repo := evalDir(t, testutil.InitTestRepo(t))
+	oldPath := testutil.AddWorktree(t, repo, "feature-old")
+	gitRun(t, repo, "config", "branch.feature-old.remote", "origin")
+	gitRun(t, repo, "config", "branch.feature-old.merge", "refs/heads/feature-old")
+	gitRun(t, repo, "update-ref", "refs/remotes/origin/feature-new", "feature-old")
+
+	stdout, stderr, err := runBinary(t, binPath, repo, "rename", "feature-old", "feature-new", "--update-upstream")
+	if err != nil {
+		t.Fatalf("rename failed: %v\nstdout: %s\nstderr: %s", err, stdout, stderr)
+	}
+	t.Cleanup(func() {
+		exec.Command("git", "-C", repo, "worktree", "remove", "--force", repo+"-feature-new").Run()
+	})
+
+	if branchExists(t, repo, "feature-old") || !branchExists(t, repo, "feature-new") {
+		t.Error("expected feature-old to be renamed to feature-new")
+	}
+	if _, err := os.Stat(oldPath); !os.IsNotExist(err) {
+		t.Error("expected old worktree path to be gone")
+	}
+	if _, err := os.Stat(repo + "-feature-new"); err != nil {
+		t.Errorf("expected worktree at the new layout path: %v", err)
+	}
+	if merge := strings.TrimSpace(gitRun(t, repo, "config", "branch.feature-new.merge")); merge != "refs/heads/feature-new" {
+		t.Errorf("expected upstream merge ref to follow the rename, got %q", merge)
+	}
+}
+
+func TestRename_UpstreamNotOnRemote(t *testing.T) {
+	repo := evalDir(t, testutil.InitTestRepo(t))
+	addOrigin(t, repo)
+	testutil.AddWorktree(t, repo, "feature-old")
+	gitRun(t, repo, "push", "-u", "origin", "feature-old")
+
+	stdout, stderr, err := runBinary(t, binPath, repo, "rename", "feature-old", "feature-new", "--update-upstream")
+	if err != nil {
+		t.Fatalf("rename failed: %v\nstdout: %s\nstderr: %s", err, stdout, stderr)
+	}
+	t.Cleanup(func() {
+		exec.Command("git", "-C", repo, "worktree", "remove", "--force", repo+"-feature-new").Run()
+	})
+
+	if !strings.Contains(stdout, "git push -u origin feature-new") {
+		t.Errorf("expected a hint to push the new branch, got: %s", stdout)
+	}
+	if merge := strings.TrimSpace(gitRun(t, repo, "config", "branch.feature-new.merge")); merge != "refs/heads/feature-old" {
+		t.Errorf("expected the upstream to stay on feature-old, got %q", merge)
+	}
+	if status := gitRun(t, repo+"-feature-new", "status", "--branch", "--porcelain"); strings.Contains(status, "[gone]") {
+		t.Errorf("expected the upstream not to be gone, got: %s", status)
+	}
+}
+
+func TestRename_TargetBranchExists(t *testing.T) {
+	repo := evalDir(t, testutil.InitTestRepo(t))
+	oldPath := testutil.AddWorktree(t, repo, "feature-a")
+	testutil.CreateBranch(t, repo, "feature-b")
+
+	_, stderr, err := runBinary(t, binPath, repo, "rename", "feature-a", "feature-b")
+	if err == nil {
+		t.Fatal("expected rename onto an existing branch to fail")
+	}
+	if !strings.Contains(stderr, "already exists") {
+		t.Errorf("expected 'already exists' in stderr, got: %s", stderr)
+	}
+	if _, err := os.Stat(oldPath); err != nil {
+		t.Error("expected worktree to stay in place")
+	}
+}
+
+// ===========================================================================
+// DOCTOR COMMAND TESTS
+// ===========================================================================
+
+func TestDoctor_Healthy(t *testing.T) {
+	repo := evalDir(t, testutil.InitTestRepo(t))
+	testutil.AddWorktree(t, repo, "fine")
+
+	stdout, stderr, err := runBinary(t, binPath, repo, "doctor")
+	if err != nil {
+		t.Fatalf("doctor failed: %v\nstdout: %s\nstderr: %s", err, stdout, stderr)
+	}
+	if !strings.Contains(stdout, "No problems found") {
+		t.Errorf("expected 'No problems found', got: %s", stdout)
+	}
+}
+
+func TestDoctor_JSONReport(t *testing.T) {
+	repo := evalDir(t, testutil.InitTestRepo(t))
+	gone := testutil.AddWorktree(t, repo, "gone")
+	if err := os.RemoveAll(gone); err != nil {
+		t.Fatal(err)
+	}
+	stray := repo + "-stray"
+	if err := os.MkdirAll(stray, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(stray) })
+
+	stdout, stderr, err := runBinary(t, binPath, repo, "doctor", "--json")
+	if err != nil {
+		t.Fatalf("doctor --json failed: %v\nstdout: %s\nstderr: %s", err, stdout, stderr)
+	}
+
+	var problems []struct {
+		Kind string `json:"kind"`
+		Path string `json:"path"`
+		Fix  string `json:"fix"`
+	}
+	if err := json.Unmarshal([]byte(stdout), &problems); err != nil {
+		t.Fatalf("invalid JSON output: %v\n%s", err, stdout)
+	}
+	got := make(map[string]string)
+	for _, p := range problems {
+		got[p.Kind] = p.Path
+	}
+	if got["missing-path"] != gone {
+		t.Errorf("expected missing-path for %s, got %+v", gone, problems)
+	}
+	if got["unregistered-dir"] != stray {
+		t.Errorf("expected unregistered-dir for %s, got %+v", stray, problems)
+	}
+	if out := gitRun(t, repo, "worktree", "list"); !strings.Contains(out, "gone") {
+		t.Error("--json must not prune anything")
+	}
+}
+
+func TestDoctor_FixRepairsMovedRepository(t *testing.T) {
+	orig := evalDir(t, testutil.InitTestRepo(t))
+	wtPath := testutil.AddWorktree(t, orig, "linked")
+	gone := testutil.AddWorktree(t, orig, "gone")
+	if err := os.RemoveAll(gone); err != nil {
+		t.Fatal(err)
+	}
+	moved := filepath.Join(filepath.Dir(orig), "moved")
+	if err := os.Rename(orig, moved); err != nil {
+		t.Fatal(err)
+	}
+
+	stdout, stderr, err := runBinary(t, binPath, moved, "doctor", "--fix")
+	if err != nil {
+		t.Fatalf("doctor --fix failed: %v\nstdout: %s\nstderr: %s", err, stdout, stderr)
+	}
+	if !strings.Contains(stdout, "gitdir-mismatch") || !strings.Contains(stdout, "Repaired: "+wtPath) {
+		t.Errorf("expected the linked worktree to be repaired, got: %s", stdout)
+	}
+	if !strings.Contains(stdout, "Pruned") {
+		t.Errorf("expected the missing worktree to be pruned, got: %s", stdout)
+	}
+
+	// The linked worktree works again.
+	if out := gitRun(t, wtPath, "rev-parse", "--abbrev-ref", "HEAD"); strings.TrimSpace(out) != "linked" {
+		t.Errorf("expected linked worktree on branch linked, got %q", out)
+	}
+	stdout, _, err = runBinary(t, binPath, moved, "doctor")
+	if err != nil || !strings.Contains(stdout, "No problems found") {
+		t.Errorf("expected no problems after --fix, got: %s (err %v)", stdout, err)
+	}
+}
+
+// ===========================================================================
+// UNDO / RESTORE COMMAND TESTS
+// ===========================================================================
+
+func TestUndo_RestoresCleanedWorktree(t *testing.T) {
+	repo := evalDir(t, testutil.InitTestRepo(t))
+
+	wtPath := testutil.AddWorktree(t, repo, "to-undo")
+	testutil.MakeCommit(t, wtPath, "feature")
+	gitRun(t, repo, "merge", "to-undo")
+	testutil.WriteFile(t, wtPath, ".env.local", "SECRET=1\n")
+	tip := strings.TrimSpace(gitRun(t, repo, "rev-parse", "to-undo"))
+
+	if stdout, stderr, err := runBinary(t, binPath, repo, "clean", "--merged", "--force"); err != nil {
+		t.Fatalf("clean failed: %v\nstdout: %s\nstderr: %s", err, stdout, stderr)
+	}
+	if branchExists(t, repo, "to-undo") {
+		t.Fatal("expected clean to delete the merged branch")
+	}
+
+	stdout, stderr, err := runBinary(t, binPath, repo, "undo")
+	if err != nil {
+		t.Fatalf("undo failed: %v\nstdout: %s\nstderr: %s", err, stdout, stderr)
+	}
+	if !strings.Contains(stdout, "Restored worktree") {
+		t.Errorf("expected restore confirmation, got: %s", stdout)
+	}
+	if got := strings.TrimSpace(gitRun(t, wtPath, "rev-parse", "HEAD")); got != tip {
+		t.Errorf("restored HEAD = %s, want %s", got, tip)
+	}
+	if data, readErr := os.ReadFile(filepath.Join(wtPath, ".env.local")); readErr != nil || string(data) != "SECRET=1\n" {
+		t.Errorf("expected .env.local to be restored, got %q (%v)", data, readErr)
+	}
+
+	if _, _, err := runBinary(t, binPath, repo, "undo"); err == nil {
+		t.Error("expected a second undo to fail with nothing left to restore")
+	}
+}
+
+func TestUndo_RestoresIgnoredFiles(t *testing.T) {
+	repo := evalDir(t, testutil.InitTestRepo(t))
+	testutil.WriteFile(t, repo, ".gitignore", ".env\n")
+	gitRun(t, repo, "add", ".gitignore")
+	gitRun(t, repo, "commit", "-m", "ignore .env")
+
+	wtPath := testutil.AddWorktree(t, repo, "ignored")
+	testutil.MakeCommit(t, wtPath, "feature")
+	gitRun(t, repo, "merge", "ignored")
+	testutil.WriteFile(t, wtPath, ".env", "SECRET=1\n")
+
+	stdout, stderr, err := runBinary(t, binPath, repo, "clean", "--merged", "--force")
+	if err != nil {
+		t.Fatalf("clean failed: %v\nstdout: %s\nstderr: %s", err, stdout, stderr)
+	}
+	if !strings.Contains(stdout, "refs/wt-backup/ignored/") {
+		t.Errorf("expected the ignored file to be backed up, got: %s", stdout)
+	}
+
+	if stdout, stderr, err := runBinary(t, binPath, repo, "undo"); err != nil {
+		t.Fatalf("undo failed: %v\nstdout: %s\nstderr: %s", err, stdout, stderr)
+	}
+	if data, readErr := os.ReadFile(filepath.Join(wtPath, ".env")); readErr != nil || string(data) != "SECRET=1\n" {
+		t.Errorf("expected .env to be restored, got %q (%v)", data, readErr)
+	}
+}
+
+func TestRestore_ByBranch(t *testing.T) {
+	repo := evalDir(t, testutil.InitTestRepo(t))
+
+	first := testutil.AddWorktree(t, repo, "first")
+	second := testutil.AddWorktree(t, repo, "second")
+	gitRun(t, repo, "worktree", "lock", second)
+	if stdout, stderr, err := runBinary(t, binPath, repo, "clean", "--merged", "--force", "--include-locked"); err != nil {
+		t.Fatalf("clean failed: %v\nstdout: %s\nstderr: %s", err, stdout, stderr)
+	}
+
+	stdout, stderr, err := runBinary(t, binPath, repo, "restore", "first")
+	if err != nil {
+		t.Fatalf("restore failed: %v\nstdout: %s\nstderr: %s", err, stdout, stderr)
+	}
+	if _, statErr := os.Stat(first); statErr != nil {
+		t.Errorf("expected worktree 'first' to be restored: %v", statErr)
+	}
+	if _, statErr := os.Stat(second); !os.IsNotExist(statErr) {
+		t.Error("expected worktree 'second' to stay removed")
+	}
+
+	_, stderr, err = runBinary(t, binPath, repo, "restore", "missing")
+	if err == nil || !strings.Contains(stderr, "second") {
+		t.Errorf("expected restore of an unknown branch to fail listing 'second', got err=%v stderr=%s", err, stderr)
+	}
+
+	if stdout, stderr, err := runBinary(t, binPath, repo, "restore", "second"); err != nil {
+		t.Fatalf("restore failed: %v\nstdout: %s\nstderr: %s", err, stdout, stderr)
+	}
+	if out := gitRun(t, repo, "worktree", "list", "--porcelain"); !strings.Contains(out, "locked") {
+		t.Errorf("expected restored worktree 'second' to be locked again, got: %s", out)
+	}
+	gitRun(t, repo, "worktree", "unlock", second)
+}
+
+// ===========================================================================
+// LOG COMMAND TESTS
+// ===========================================================================
+
+func TestLog_RecordsAddAndClean(t *testing.T) {
+	repo := evalDir(t, testutil.InitTestRepo(t))
+	writeLocalConfig(t, repo, `
+[hooks]
+post_add = "true"
+`)
+
+	if stdout, stderr, err := runBinary(t, binPath, repo, "add", "logged"); err != nil {
+		t.Fatalf("add failed: %v\nstdout: %s\nstderr: %s", err, stdout, stderr)
+	}
+	if stdout, stderr, err := runBinary(t, binPath, repo, "add", "other"); err != nil {
+		t.Fatalf("add failed: %v\nstdout: %s\nstderr: %s", err, stdout, stderr)
+	}
+	if stdout, stderr, err := runBinary(t, binPath, repo, "clean", "--merged", "--force"); err != nil {
+		t.Fatalf("clean failed: %v\nstdout: %s\nstderr: %s", err, stdout, stderr)
+	}
+
+	stdout, stderr, err := runBinary(t, binPath, repo, "log", "--json")
+	if err != nil {
+		t.Fatalf("log failed: %v\nstdout: %s\nstderr: %s", err, stdout, stderr)
+	}
+	var actions []string
+	for _, line := range strings.Split(strings.TrimSpace(stdout), "\n") {
+		var ev struct {
+			Action string `json:"action"`
+			Detail string `json:"detail"`
+		}
+		if err := json.Unmarshal([]byte(line), &ev); err != nil {
+			t.Fatalf("invalid JSON line %q: %v", line, err)
+		}
+		actions = append(actions, ev.Action)
+		if ev.Action == "remove" && !strings.Contains(ev.Detail, "git branch -d") {
+			t.Errorf("expected remove event to record the branch deletion, got %q", ev.Detail)
+		}
+	}
+	want := []string{"clean", "remove", "remove", "hook", "add", "hook", "add"}
+	if strings.Join(actions, " ") != strings.Join(want, " ") {
+		t.Errorf("logged actions = %v, want %v (newest first)", actions, want)
+	}
+
+	stdout, _, err = runBinary(t, binPath, repo, "log", "--branch", "logged", "--action", "add")
+	if err != nil {
+		t.Fatalf("log with filters failed: %v", err)
+	}
+	if strings.Count(strings.TrimSpace(stdout), "\n") != 0 || !strings.Contains(stdout, "logged") {
+		t.Errorf("expected a single add event for 'logged', got: %s", stdout)
+	}
+
+	stdout, _, err = runBinary(t, binPath, repo, "log", "--until", "2000-01-01")
+	if err != nil || !strings.Contains(stdout, "No events") {
+		t.Errorf("expected no events before 2000, got err=%v stdout=%s", err, stdout)
+	}
+
+	if _, _, err := runBinary(t, binPath, repo, "log", "--action", "explode"); err == nil {
+		t.Error("expected an unknown action to be rejected")
+	}
+}
+
+// ===========================================================================
+// CLONE COMMAND TESTS
+// ===========================================================================
+
+func TestClone_BareLayout(t *testing.T) {
+	src := evalDir(t, testutil.InitTestRepo(t))
+	testutil.CreateBranch(t, src, "feature")
+	parent := evalDir(t, t.TempDir())
+
+	stdout, stderr, err := runBinary(t, binPath, parent, "clone", src, "proj")
+	if err != nil {
+		t.Fatalf("clone failed: %v\nstdout: %s\nstderr: %s", err, stdout, stderr)
+	}
+	container := filepath.Join(parent, "proj")
+	mainPath := filepath.Join(container, "master")
+	for _, path := range []string{".bare", ".git", ".git-wt.toml", "master/README.md"} {
+		if _, err := os.Stat(filepath.Join(container, path)); err != nil {
+			t.Errorf("expected %s in the container: %v", path, err)
+		}
+	}
+
+	// Commands work from the container and from any worktree.
+	stdout, stderr, err = runBinary(t, binPath, container, "add", "feature")
+	if err != nil {
+		t.Fatalf("add from container failed: %v\nstdout: %s\nstderr: %s", err, stdout, stderr)
+	}
+	featurePath := filepath.Join(container, "feature")
+	if _, err := os.Stat(featurePath); err != nil {
+		t.Errorf("expected worktree inside the container at %s: %v", featurePath, err)
+	}
+
+	for _, dir := range []string{container, mainPath} {
+		stdout, stderr, err = runBinary(t, binPath, dir, "ls")
+		if err != nil {
+			t.Fatalf("ls from %s failed: %v\nstderr: %s", dir, err, stderr)
+		}
+		if !strings.Contains(stdout, "master") || !strings.Contains(stdout, "feature") {
+			t.Errorf("expected ls from %s to list both worktrees, got: %s", dir, stdout)
+		}
+	}
+
+	stdout, stderr, err = runBinary(t, binPath, mainPath, "switch", "feature")
+	if err != nil {
+		t.Fatalf("switch failed: %v\nstderr: %s", err, stderr)
+	}
+	if got := filepath.Clean(strings.TrimSpace(stdout)); got != featurePath {
+		t.Errorf("switch = %q, want %q", got, featurePath)
+	}
+
+	stdout, stderr, err = runBinary(t, binPath, container, "doctor")
+	if err != nil {
+		t.Fatalf("doctor failed: %v\nstderr: %s", err, stderr)
+	}
+	if !strings.Contains(stdout, "No problems found") {
+		t.Errorf("expected a healthy bare layout, got: %s", stdout)
+	}
+}
+
+func TestClone_ExistingDirectory(t *testing.T) {
+	src := evalDir(t, testutil.InitTestRepo(t))
+	parent := evalDir(t, t.TempDir())
+	if err := os.Mkdir(filepath.Join(parent, "proj"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	_, stderr, err := runBinary(t, binPath, parent, "clone", src, "proj")
+	if err == nil || !strings.Contains(stderr, "already exists") {
+		t.Errorf("expected clone into an existing directory to fail, got err=%v stderr=%s", err, stderr)
+	}
+}
+
+// ===========================================================================
+// CONVERT COMMAND TESTS
+// ===========================================================================
+
+func TestConvert_BareLayout(t *testing.T) {
+	dir := evalDir(t, testutil.InitTestRepo(t))
+	testutil.WriteFile(t, dir, "wip.txt", "work in progress\n")
+	gitRun(t, dir, "stash", "push", "--include-untracked")
+	testutil.WriteFile(t, dir, "README.md", "# changed\n")
+
+	stdout, stderr, err := runBinary(t, binPath, dir, "convert", "--dry-run")
+	if err != nil {
+		t.Fatalf("convert --dry-run failed: %v\nstderr: %s", err, stderr)
+	}
+	if !strings.Contains(stdout, "Dry run") {
+		t.Errorf("expected dry run notice, got: %s", stdout)
+	}
+	if info, err := os.Stat(filepath.Join(dir, ".git")); err != nil || !info.IsDir() {
+		t.Fatal("dry run must not move .git")
+	}
+
+	stdout, stderr, err = runBinaryInput(t, binPath, dir, "y\n", "convert")
+	if err != nil {
+		t.Fatalf("convert failed: %v\nstdout: %s\nstderr: %s", err, stdout, stderr)
+	}
+	mainPath := filepath.Join(dir, "master")
+	if data, err := os.ReadFile(filepath.Join(mainPath, "README.md")); err != nil || string(data) != "# changed\n" {
+		t.Errorf("expected the modified checkout in %s, got %q, %v", mainPath, data, err)
+	}
+	if stashes := gitRun(t, mainPath, "stash", "list"); !strings.Contains(stashes, "stash@{0}") {
+		t.Errorf("expected the stash to be preserved, got: %s", stashes)
+	}
+
+	stdout, stderr, err = runBinary(t, binPath, dir, "add", "feature")
+	if err != nil {
+		t.Fatalf("add after convert failed: %v\nstdout: %s\nstderr: %s", err, stdout, stderr)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "feature")); err != nil {
+		t.Errorf("expected the new worktree inside the container: %v", err)
+	}
+	stdout, _, err = runBinary(t, binPath, mainPath, "ls")
+	if err != nil || !strings.Contains(stdout, "feature") || !strings.Contains(stdout, "1 modified") {
+		t.Errorf("expected ls to list both worktrees and the local change, got: %s (%v)", stdout, err)
+	}
+
+	_, stderr, err = runBinary(t, binPath, dir, "convert", "--yes")
+	if err == nil || !strings.Contains(stderr, "already a bare repository") {
+		t.Errorf("expected a second conversion to be refused, got err=%v stderr=%s", err, stderr)
+	}
+}
+
+func TestConvert_KeepsLocalConfig(t *testing.T) {
+	dir := evalDir(t, testutil.InitTestRepo(t))
+	writeLocalConfig(t, dir, `
+[layout]
+strategy = "adjacent"
+
+[hooks]
+post_add = "touch hook-ran"
+`)
+
+	stdout, stderr, err := runBinary(t, binPath, dir, "convert", "--dry-run")
+	if err != nil {
+		t.Fatalf("convert --dry-run failed: %v\nstderr: %s", err, stderr)
+	}
+	if !strings.Contains(stdout, "existing settings kept") {
+		t.Errorf("expected the config step in the plan, got: %s", stdout)
+	}
+
+	stdout, stderr, err = runBinary(t, binPath, dir, "convert", "--yes")
+	if err != nil {
+		t.Fatalf("convert failed: %v\nstdout: %s\nstderr: %s", err, stdout, stderr)
+	}
+	mainPath := filepath.Join(dir, "master")
+	if status := gitRun(t, mainPath, "status", "--porcelain"); strings.Contains(status, ".git-wt.toml") {
+		t.Errorf("expected the untracked config to leave the worktree, got status: %s", status)
+	}
+
+	stdout, stderr, err = runBinary(t, binPath, dir, "add", "feature")
+	if err != nil {
+		t.Fatalf("add after convert failed: %v\nstdout: %s\nstderr: %s", err, stdout, stderr)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "feature", "hook-ran")); err != nil {
+		t.Errorf("expected the post_add hook to still run in the bare layout: %v", err)
+	}
+}
+
 // ===========================================================================
 // SWITCH COMMAND TESTS
 // ===========================================================================
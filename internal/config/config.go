@@ -5,6 +5,7 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/BurntSushi/toml"
 )
@@ -14,12 +15,21 @@ type LayoutStrategy string
 const (
 	LayoutAdjacent     LayoutStrategy = "adjacent"
 	LayoutSubdirectory LayoutStrategy = "subdirectory"
+	// LayoutBare places worktrees directly inside the container directory
+	// of a bare repository cloned with "git wt clone".
+	LayoutBare LayoutStrategy = "bare"
 )
 
 type Config struct {
-	Layout  LayoutConfig  `toml:"layout"`
-	Cleanup CleanupConfig `toml:"cleanup"`
-	Hooks   HooksConfig   `toml:"hooks"`
+	Layout     LayoutConfig     `toml:"layout"`
+	Cleanup    CleanupConfig    `toml:"cleanup"`
+	Hooks      HooksConfig      `toml:"hooks"`
+	Submodules SubmodulesConfig `toml:"submodules"`
+	Git        GitConfig        `toml:"git"`
+
+	// Sparse maps the names of sparse-checkout profiles to their cone-mode
+	// patterns, i.e. the directories to check out.
+	Sparse map[string][]string `toml:"sparse"`
 }
 
 type LayoutConfig struct {
@@ -30,12 +40,64 @@ type LayoutConfig struct {
 type CleanupConfig struct {
 	StaleDays int  `toml:"stale_days"`
 	AutoPrune bool `toml:"auto_prune"`
+
+	// MergeDetection is "ancestry" (branch tip reachable from the default
+	// branch) or "squash", which also recognises squash and rebase merges.
+	MergeDetection string `toml:"merge_detection"`
+
+	// MergeTargets are the refs branches are checked for being merged into,
+	// in order, e.g. "origin/main" or "release/*". Globs match local and
+	// remote-tracking branches. Empty means the default branch.
+	MergeTargets []string `toml:"merge_targets"`
+
+	// PreferRemote checks against the remote-tracking ref of the default
+	// branch (e.g. origin/main) instead of the local branch when it exists
+	// and no MergeTargets are set.
+	PreferRemote bool `toml:"prefer_remote"`
+
+	// IncludeGone makes clean without flags also offer worktrees whose
+	// branch's upstream was deleted on the remote.
+	IncludeGone bool `toml:"include_gone"`
+
+	// OnDirty is "backup" to save local changes under refs/wt-backup before
+	// removing a worktree, or "refuse" to keep dirty worktrees unless
+	// removal is forced.
+	OnDirty string `toml:"on_dirty"`
 }
 
 type HooksConfig struct {
 	PostAdd string `toml:"post_add"`
 }
 
+type SubmodulesConfig struct {
+	// Update initialises and updates submodules recursively in worktrees
+	// created by add.
+	Update bool `toml:"update"`
+
+	// ReuseObjects clones submodules from the module repositories of the
+	// main worktree instead of from their remotes when they exist there.
+	ReuseObjects bool `toml:"reuse_objects"`
+}
+
+type GitConfig struct {
+	// Parallelism is the number of worktrees enriched concurrently.
+	// Zero means one worker per CPU.
+	Parallelism int `toml:"parallelism"`
+
+	// Timeout limits each individual git invocation, e.g. "10s".
+	// Zero disables the limit.
+	Timeout time.Duration `toml:"timeout"`
+
+	// Remotes are the remotes whose HEAD names the default branch, tried in
+	// order, e.g. ["upstream", "origin"]. Empty means all remotes, origin
+	// first.
+	Remotes []string `toml:"remotes"`
+
+	// DefaultBranch names the default branch explicitly instead of
+	// detecting it from the remotes.
+	DefaultBranch string `toml:"default_branch"`
+}
+
 func Default() *Config {
 	return &Config{
 		Layout: LayoutConfig{
@@ -43,8 +105,13 @@ func Default() *Config {
 			Pattern:  "{repo}-{branch}",
 		},
 		Cleanup: CleanupConfig{
-			StaleDays: 30,
-			AutoPrune: true,
+			StaleDays:      30,
+			AutoPrune:      true,
+			MergeDetection: "ancestry",
+			OnDirty:        "backup",
+		},
+		Submodules: SubmodulesConfig{
+			ReuseObjects: true,
 		},
 	}
 }
@@ -97,6 +164,8 @@ func (c *Config) WorktreePath(repoRoot, branch string) string {
 	switch c.Layout.Strategy {
 	case LayoutSubdirectory:
 		return filepath.Join(repoRoot, ".worktrees", safeBranch)
+	case LayoutBare:
+		return filepath.Join(repoRoot, safeBranch)
 	default: // adjacent
 		pattern := c.Layout.Pattern
 		if pattern == "" {
@@ -108,6 +177,41 @@ func (c *Config) WorktreePath(repoRoot, branch string) string {
 	}
 }
 
+// WorktreeGlob returns a filepath.Glob pattern matching every path that
+// WorktreePath can return for repoRoot under the current layout.
+func (c *Config) WorktreeGlob(repoRoot string) string {
+	switch c.Layout.Strategy {
+	case LayoutSubdirectory:
+		return filepath.Join(globEscape(repoRoot), ".worktrees", "*")
+	case LayoutBare:
+		// The bare repository itself is a hidden directory.
+		return filepath.Join(globEscape(repoRoot), "[^.]*")
+	default: // adjacent
+		pattern := c.Layout.Pattern
+		if pattern == "" {
+			pattern = "{repo}-{branch}"
+		}
+		dirName := globEscape(pattern)
+		dirName = strings.ReplaceAll(dirName, "{repo}", globEscape(filepath.Base(repoRoot)))
+		dirName = strings.ReplaceAll(dirName, "{branch}", "*")
+		return filepath.Join(globEscape(filepath.Dir(repoRoot)), dirName)
+	}
+}
+
+// globEscape quotes the characters filepath.Match treats specially. Windows
+// has no escape character, so names are used as is there.
+func globEscape(s string) string {
+	if os.PathSeparator == '\\' {
+		return s
+	}
+	return strings.NewReplacer(
+		"\\", "\\\\",
+		"*", "\\*",
+		"?", "\\?",
+		"[", "\\[",
+	).Replace(s)
+}
+
 func sanitizeBranch(branch string) string {
 	r := strings.NewReplacer(
 		"/", "-",
@@ -125,6 +229,53 @@ func sanitizeBranch(branch string) string {
 	return r.Replace(branch)
 }
 
+// GenerateBareConfig returns the local config "git wt clone" writes to the
+// container directory of a bare layout.
+func GenerateBareConfig() string {
+	return `# git-wt configuration for a bare repository with sibling worktrees
+
+[layout]
+strategy = "bare"
+`
+}
+
+// SetBareLayout returns the TOML config data with layout.strategy set to
+// "bare". Everything else, including comments, is kept as is, so that
+// "git wt convert" can carry a clone's local config over to the container.
+func SetBareLayout(data string) string {
+	const strategy = `strategy = "bare"` + "\n"
+	if strings.TrimSpace(data) == "" {
+		return GenerateBareConfig()
+	}
+	if !strings.HasSuffix(data, "\n") {
+		data += "\n"
+	}
+
+	lines := strings.SplitAfter(data, "\n")
+	layoutAt := -1
+	inLayout := false
+	for i, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, "[") {
+			header, _, _ := strings.Cut(trimmed, "#")
+			inLayout = strings.TrimSpace(header) == "[layout]"
+			if inLayout {
+				layoutAt = i
+			}
+			continue
+		}
+		if key, _, ok := strings.Cut(trimmed, "="); inLayout && ok && strings.TrimSpace(key) == "strategy" {
+			lines[i] = strategy
+			return strings.Join(lines, "")
+		}
+	}
+	if layoutAt < 0 {
+		return data + "\n[layout]\n" + strategy
+	}
+	lines = append(lines[:layoutAt+1], append([]string{strategy}, lines[layoutAt+1:]...)...)
+	return strings.Join(lines, "")
+}
+
 // GenerateDefaultConfig returns the default config as TOML string.
 func GenerateDefaultConfig() string {
 	return `# git-wt configuration
@@ -132,6 +283,7 @@ func GenerateDefaultConfig() string {
 [layout]
 # "adjacent" places worktrees next to the repo: ../repo-branch/
 # "subdirectory" places them inside: .worktrees/branch/
+# "bare" places them inside the container of "git wt clone": repo/branch/
 strategy = "adjacent"
 
 # Directory naming pattern. Available variables: {repo}, {branch}
@@ -144,9 +296,61 @@ stale_days = 30
 # Automatically prune stale worktree references
 auto_prune = true
 
+# How merged branches are detected:
+# "ancestry" only finds branches whose commits are on the default branch.
+# "squash" also finds branches landed by squash or rebase merge.
+merge_detection = "ancestry"
+
+# Refs that branches are checked for being merged into, in order. Globs
+# match local and remote-tracking branches. Empty means the default branch.
+# merge_targets = ["origin/main", "release/*"]
+merge_targets = []
+
+# Compare against the remote-tracking default branch (e.g. origin/main)
+# instead of the local one when merge_targets is empty
+prefer_remote = false
+
+# Also offer worktrees whose upstream branch was deleted on the remote
+include_gone = false
+
+# What happens to local changes when a worktree is removed:
+# "backup" saves them under refs/wt-backup/ first, "refuse" keeps dirty
+# worktrees unless --force is given.
+on_dirty = "backup"
+
 [hooks]
 # Command to run after creating a new worktree
 # post_add = "npm install"
+
+[submodules]
+# Initialise and update submodules recursively in new worktrees
+update = false
+
+# Clone submodules from the main worktree's module repositories instead of
+# from their remotes when the main worktree has them
+reuse_objects = true
+
+[git]
+# Number of worktrees whose status is collected in parallel (0 = CPU count)
+parallelism = 0
+
+# Maximum duration of a single git command, e.g. "10s" (0 = no limit).
+# Worktrees whose status cannot be read in time are shown as "status: timeout".
+timeout = "0s"
+
+# Remotes whose HEAD names the default branch, tried in order, e.g.
+# ["upstream", "origin"] for a fork. Empty means all remotes, origin first.
+remotes = []
+
+# The default branch, e.g. "develop". Empty detects it from the remotes, then
+# falls back to a local or remote main or master branch.
+default_branch = ""
+
+[sparse]
+# Named sparse-checkout profiles for "git wt add --sparse <profile>". Each
+# lists the directories to check out (cone mode); files at the top level are
+# always included.
+# frontend = ["apps/web", "packages/ui"]
 `
 }
 
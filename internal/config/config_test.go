@@ -4,8 +4,10 @@ import (
 	"os"
 	"path/filepath"
 	"runtime"
+	"slices"
 	"strings"
 	"testing"
+	"time"
 )
 
 func TestDefault(t *testing.T) {
@@ -23,9 +25,39 @@ func TestDefault(t *testing.T) {
 	if cfg.Cleanup.AutoPrune != true {
 		t.Error("expected auto_prune true, got false")
 	}
+	if cfg.Cleanup.MergeDetection != "ancestry" {
+		t.Errorf("expected merge_detection %q, got %q", "ancestry", cfg.Cleanup.MergeDetection)
+	}
+	if cfg.Cleanup.IncludeGone {
+		t.Error("expected include_gone false, got true")
+	}
+	if cfg.Cleanup.OnDirty != "backup" {
+		t.Errorf("expected on_dirty %q, got %q", "backup", cfg.Cleanup.OnDirty)
+	}
+	if len(cfg.Cleanup.MergeTargets) != 0 {
+		t.Errorf("expected no merge_targets, got %v", cfg.Cleanup.MergeTargets)
+	}
+	if cfg.Cleanup.PreferRemote {
+		t.Error("expected prefer_remote false, got true")
+	}
 	if cfg.Hooks.PostAdd != "" {
 		t.Errorf("expected empty post_add hook, got %q", cfg.Hooks.PostAdd)
 	}
+	if cfg.Submodules.Update {
+		t.Error("expected submodules.update false, got true")
+	}
+	if !cfg.Submodules.ReuseObjects {
+		t.Error("expected submodules.reuse_objects true, got false")
+	}
+	if cfg.Git.Parallelism != 0 {
+		t.Errorf("expected parallelism 0, got %d", cfg.Git.Parallelism)
+	}
+	if cfg.Git.Timeout != 0 {
+		t.Errorf("expected timeout 0, got %v", cfg.Git.Timeout)
+	}
+	if len(cfg.Git.Remotes) != 0 || cfg.Git.DefaultBranch != "" {
+		t.Errorf("expected no remotes and default_branch, got %v and %q", cfg.Git.Remotes, cfg.Git.DefaultBranch)
+	}
 }
 
 func TestSanitizeBranch(t *testing.T) {
@@ -150,6 +182,83 @@ func TestWorktreePath_Subdirectory(t *testing.T) {
 	}
 }
 
+func TestWorktreePath_Bare(t *testing.T) {
+	cfg := Default()
+	cfg.Layout.Strategy = LayoutBare
+	repoRoot := filepath.Join("/home", "user", "projects", "myrepo")
+	got := cfg.WorktreePath(repoRoot, "feature/auth")
+
+	want := filepath.Join("/home", "user", "projects", "myrepo", "feature-auth")
+	if got != want {
+		t.Errorf("WorktreePath() = %q, want %q", got, want)
+	}
+	if ok, _ := filepath.Match(cfg.WorktreeGlob(repoRoot), filepath.Join(repoRoot, ".bare")); ok {
+		t.Error("bare layout glob must not match the bare repository")
+	}
+}
+
+func TestGenerateBareConfig(t *testing.T) {
+	tmpDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(tmpDir, ".git-wt.toml"), []byte(GenerateBareConfig()), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if cfg := LoadForRepo(tmpDir); cfg.Layout.Strategy != LayoutBare {
+		t.Errorf("expected strategy %q, got %q", LayoutBare, cfg.Layout.Strategy)
+	}
+}
+
+func TestSetBareLayout(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want string
+	}{
+		{"empty", "", GenerateBareConfig()},
+		{
+			"replaces strategy",
+			"[layout]\n# where worktrees go\nstrategy = \"adjacent\"\npattern = \"{repo}-{branch}\"\n",
+			"[layout]\n# where worktrees go\nstrategy = \"bare\"\npattern = \"{repo}-{branch}\"\n",
+		},
+		{
+			"adds strategy to layout",
+			"[layout] # naming\npattern = \"wt-{branch}\"\n\n[hooks]\npost_add = \"make\"\n",
+			"[layout] # naming\nstrategy = \"bare\"\npattern = \"wt-{branch}\"\n\n[hooks]\npost_add = \"make\"\n",
+		},
+		{
+			"adds layout table",
+			"[hooks]\npost_add = \"make\"",
+			"[hooks]\npost_add = \"make\"\n\n[layout]\nstrategy = \"bare\"\n",
+		},
+		{
+			"ignores strategy of other tables",
+			"[other]\nstrategy = \"x\"\n",
+			"[other]\nstrategy = \"x\"\n\n[layout]\nstrategy = \"bare\"\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := SetBareLayout(tt.data); got != tt.want {
+				t.Errorf("SetBareLayout() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSetBareLayout_KeepsSettings(t *testing.T) {
+	tmpDir := t.TempDir()
+	data := SetBareLayout(strings.Replace(GenerateDefaultConfig(), "# post_add", "post_add", 1))
+	if err := os.WriteFile(filepath.Join(tmpDir, ".git-wt.toml"), []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	cfg := LoadForRepo(tmpDir)
+	if cfg.Layout.Strategy != LayoutBare {
+		t.Errorf("expected strategy %q, got %q", LayoutBare, cfg.Layout.Strategy)
+	}
+	if cfg.Hooks.PostAdd != "npm install" {
+		t.Errorf("expected post_add to be kept, got %q", cfg.Hooks.PostAdd)
+	}
+}
+
 func TestWorktreePath_EmptyPattern(t *testing.T) {
 	cfg := Default()
 	cfg.Layout.Pattern = ""
@@ -163,6 +272,38 @@ func TestWorktreePath_EmptyPattern(t *testing.T) {
 	}
 }
 
+func TestWorktreeGlob(t *testing.T) {
+	repoRoot := filepath.Join("/home", "user", "projects", "my[repo]")
+	tests := []struct {
+		name     string
+		strategy LayoutStrategy
+		pattern  string
+	}{
+		{"adjacent", LayoutAdjacent, "{repo}-{branch}"},
+		{"custom pattern", LayoutAdjacent, "wt.{branch}.{repo}"},
+		{"subdirectory", LayoutSubdirectory, ""},
+		{"bare", LayoutBare, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := Default()
+			cfg.Layout.Strategy = tt.strategy
+			cfg.Layout.Pattern = tt.pattern
+			glob := cfg.WorktreeGlob(repoRoot)
+
+			for _, branch := range []string{"develop", "feature/auth"} {
+				path := cfg.WorktreePath(repoRoot, branch)
+				if ok, err := filepath.Match(glob, path); err != nil || !ok {
+					t.Errorf("glob %q does not match %q (err %v)", glob, path, err)
+				}
+			}
+			if ok, _ := filepath.Match(glob, repoRoot); ok {
+				t.Errorf("glob %q must not match the repository itself", glob)
+			}
+		})
+	}
+}
+
 func TestGenerateDefaultConfig(t *testing.T) {
 	output := GenerateDefaultConfig()
 
@@ -170,6 +311,9 @@ func TestGenerateDefaultConfig(t *testing.T) {
 		"[layout]",
 		"[cleanup]",
 		"[hooks]",
+		"[submodules]",
+		"[git]",
+		"[sparse]",
 	}
 	for _, section := range requiredSections {
 		if !strings.Contains(output, section) {
@@ -183,6 +327,10 @@ func TestGenerateDefaultConfig(t *testing.T) {
 		"stale_days = 30",
 		"auto_prune = true",
 		"post_add",
+		"parallelism = 0",
+		`timeout = "0s"`,
+		"reuse_objects = true",
+		`default_branch = ""`,
 	}
 	for _, key := range requiredKeys {
 		if !strings.Contains(output, key) {
@@ -269,9 +417,27 @@ pattern = "wt-{branch}"
 [cleanup]
 stale_days = 14
 auto_prune = false
+merge_detection = "squash"
+include_gone = true
+on_dirty = "refuse"
+merge_targets = ["origin/main", "release/*"]
+prefer_remote = true
 
 [hooks]
 post_add = "make setup"
+
+[submodules]
+update = true
+reuse_objects = false
+
+[git]
+parallelism = 4
+timeout = "15s"
+remotes = ["upstream", "origin"]
+default_branch = "develop"
+
+[sparse]
+frontend = ["apps/web", "packages/ui"]
 `
 	cfgPath := filepath.Join(tmpDir, ".git-wt.toml")
 	if err := os.WriteFile(cfgPath, []byte(configContent), 0o644); err != nil {
@@ -292,9 +458,45 @@ post_add = "make setup"
 	if cfg.Cleanup.AutoPrune != false {
 		t.Error("expected auto_prune false, got true")
 	}
+	if cfg.Cleanup.MergeDetection != "squash" {
+		t.Errorf("expected merge_detection %q, got %q", "squash", cfg.Cleanup.MergeDetection)
+	}
+	if !cfg.Cleanup.IncludeGone {
+		t.Error("expected include_gone true, got false")
+	}
+	if cfg.Cleanup.OnDirty != "refuse" {
+		t.Errorf("expected on_dirty %q, got %q", "refuse", cfg.Cleanup.OnDirty)
+	}
+	if want := []string{"origin/main", "release/*"}; !slices.Equal(cfg.Cleanup.MergeTargets, want) {
+		t.Errorf("expected merge_targets %v, got %v", want, cfg.Cleanup.MergeTargets)
+	}
+	if !cfg.Cleanup.PreferRemote {
+		t.Error("expected prefer_remote true, got false")
+	}
 	if cfg.Hooks.PostAdd != "make setup" {
 		t.Errorf("expected post_add %q, got %q", "make setup", cfg.Hooks.PostAdd)
 	}
+	if !cfg.Submodules.Update {
+		t.Error("expected submodules.update true, got false")
+	}
+	if cfg.Submodules.ReuseObjects {
+		t.Error("expected submodules.reuse_objects false, got true")
+	}
+	if cfg.Git.Parallelism != 4 {
+		t.Errorf("expected parallelism 4, got %d", cfg.Git.Parallelism)
+	}
+	if cfg.Git.Timeout != 15*time.Second {
+		t.Errorf("expected timeout 15s, got %v", cfg.Git.Timeout)
+	}
+	if want := []string{"upstream", "origin"}; !slices.Equal(cfg.Git.Remotes, want) {
+		t.Errorf("expected remotes %v, got %v", want, cfg.Git.Remotes)
+	}
+	if cfg.Git.DefaultBranch != "develop" {
+		t.Errorf("expected default_branch %q, got %q", "develop", cfg.Git.DefaultBranch)
+	}
+	if want := []string{"apps/web", "packages/ui"}; !slices.Equal(cfg.Sparse["frontend"], want) {
+		t.Errorf("expected sparse profile frontend %v, got %v", want, cfg.Sparse["frontend"])
+	}
 }
 
 func TestLoadForRepo_WithoutLocalConfig(t *testing.T) {
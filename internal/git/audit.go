@@ -0,0 +1,75 @@
+package git
+
+import (
+	"context"
+	"path/filepath"
+	"time"
+)
+
+// auditLog is the file, relative to the git common dir, to which git-wt
+// appends an Event as a JSON line for every change it makes.
+const auditLog = "git-wt/log.jsonl"
+
+// Action names the kind of change an Event records.
+type Action string
+
+const (
+	ActionAdd     Action = "add"
+	ActionRemove  Action = "remove"
+	ActionMove    Action = "move"
+	ActionRename  Action = "rename"
+	ActionRestore Action = "restore"
+	ActionClean   Action = "clean"
+	ActionHook    Action = "hook"
+)
+
+// Actions lists every Action in the order they are documented.
+var Actions = []Action{ActionAdd, ActionRemove, ActionMove, ActionRename, ActionRestore, ActionClean, ActionHook}
+
+// Event is an entry of the audit log.
+type Event struct {
+	Time   time.Time `json:"time"`
+	Action Action    `json:"action"`
+	Branch string    `json:"branch,omitempty"`
+	Path   string    `json:"path,omitempty"`
+	// Target is the new path of a move or the new branch of a rename.
+	Target string `json:"target,omitempty"`
+	// Detail describes the change, e.g. the hook command or the git
+	// command that deleted a branch.
+	Detail string `json:"detail,omitempty"`
+	// Error is set when the change failed.
+	Error string `json:"error,omitempty"`
+}
+
+// AuditLogPath returns the path of the audit log of the repository at dir.
+// Like the removal journal, it lives in the common dir.
+func AuditLogPath(ctx context.Context, r Runner, dir string) (string, error) {
+	common, err := GitCommonDir(ctx, r, dir)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(common, auditLog), nil
+}
+
+// LogEvent appends ev to the audit log of the repository at dir. A zero
+// ev.Time is set to the current time.
+func LogEvent(ctx context.Context, r Runner, dir string, ev Event) error {
+	if ev.Time.IsZero() {
+		ev.Time = time.Now()
+	}
+	path, err := AuditLogPath(ctx, r, dir)
+	if err != nil {
+		return err
+	}
+	return appendJSONLine(path, ev)
+}
+
+// Events returns the audit log of the repository at dir, oldest first. A
+// missing log has no events.
+func Events(ctx context.Context, r Runner, dir string) ([]Event, error) {
+	path, err := AuditLogPath(ctx, r, dir)
+	if err != nil {
+		return nil, err
+	}
+	return readJSONLines[Event](path)
+}
@@ -0,0 +1,39 @@
+package git
+
+import (
+	"testing"
+	"time"
+
+	"github.com/yasomaru/git-wt/testutil"
+)
+
+func TestLogEvent_AppendsInOrder(t *testing.T) {
+	dir := testutil.InitTestRepo(t)
+
+	events, err := Events(t.Context(), testRunner, dir)
+	if err != nil || len(events) != 0 {
+		t.Fatalf("Events() on a new repo = %v, %v; want none", events, err)
+	}
+
+	before := time.Now().Add(-time.Second)
+	if err := LogEvent(t.Context(), testRunner, dir, Event{Action: ActionAdd, Branch: "feature", Path: "/tmp/feature"}); err != nil {
+		t.Fatalf("LogEvent() error: %v", err)
+	}
+	if err := LogEvent(t.Context(), testRunner, dir, Event{Action: ActionHook, Branch: "feature", Detail: "post_add: make", Error: "exit status 2"}); err != nil {
+		t.Fatalf("LogEvent() error: %v", err)
+	}
+
+	events, err = Events(t.Context(), testRunner, dir)
+	if err != nil {
+		t.Fatalf("Events() error: %v", err)
+	}
+	if len(events) != 2 || events[0].Action != ActionAdd || events[1].Action != ActionHook {
+		t.Fatalf("Events() = %+v, want add then hook", events)
+	}
+	if events[0].Time.Before(before) {
+		t.Errorf("event time = %v, want it set to now", events[0].Time)
+	}
+	if events[1].Error != "exit status 2" {
+		t.Errorf("event error = %q, want %q", events[1].Error, "exit status 2")
+	}
+}
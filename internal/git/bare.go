@@ -0,0 +1,237 @@
+package git
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// BareDir is the name of the bare git dir in the container directory of the
+// bare layout: container/.bare holds the repository, container/.git points
+// to it, and every worktree is a subdirectory of container.
+const BareDir = ".bare"
+
+// CloneBare clones url into the bare layout at container, which must not
+// exist yet. Only the remote's default branch becomes a local branch; all
+// remote branches are fetched as remote-tracking refs, as in a normal clone.
+// It returns the default branch. On failure, container is removed again.
+func CloneBare(ctx context.Context, r Runner, url, container string) (branch string, err error) {
+	if _, err := os.Stat(container); err == nil {
+		return "", fmt.Errorf("path already exists: %s", container)
+	}
+	defer func() {
+		if err != nil {
+			_ = os.RemoveAll(container)
+		}
+	}()
+
+	if _, err := r.Run(ctx, "", "clone", "--bare", "--single-branch", url, filepath.Join(container, BareDir)); err != nil {
+		return "", err
+	}
+	if err := writeGitFile(container, BareDir); err != nil {
+		return "", err
+	}
+	// A bare clone has no fetch refspec and so no remote-tracking refs.
+	if _, err := r.Run(ctx, container, "config", "remote.origin.fetch", "+refs/heads/*:refs/remotes/origin/*"); err != nil {
+		return "", err
+	}
+	if _, err := r.Run(ctx, container, "fetch", "origin"); err != nil {
+		return "", err
+	}
+	branch, err = r.Run(ctx, container, "symbolic-ref", "--short", "HEAD")
+	if err != nil {
+		return "", err
+	}
+	if _, err := r.Run(ctx, container, "symbolic-ref", "refs/remotes/origin/HEAD", "refs/remotes/origin/"+branch); err != nil {
+		return "", err
+	}
+	if err := SetBranchUpstream(ctx, r, container, branch, "origin", "refs/heads/"+branch); err != nil {
+		return "", err
+	}
+	return branch, nil
+}
+
+// writeGitFile writes a .git file in dir that points to gitDir, which is
+// relative to dir.
+func writeGitFile(dir, gitDir string) error {
+	return os.WriteFile(filepath.Join(dir, ".git"), []byte("gitdir: ./"+filepath.ToSlash(gitDir)+"\n"), 0o644)
+}
+
+// convertStaging is the directory, relative to the container, in which
+// ConvertToBare assembles the new worktree before moving it into place.
+const convertStaging = ".git-wt-convert"
+
+// Conversion describes how ConvertToBare turns a clone into the bare layout.
+type Conversion struct {
+	// Root is the top level of the clone. It becomes the container.
+	Root string
+	// Branch is the branch checked out in Root.
+	Branch string
+	// WorktreePath is where the checkout of Root is moved, directly inside
+	// Root.
+	WorktreePath string
+	// Entries are the names in Root that are moved to WorktreePath.
+	Entries []string
+	// Worktrees are the paths of the linked worktrees, whose links to the
+	// repository are repaired.
+	Worktrees []string
+}
+
+// PlanConversion checks that the clone whose main worktree is root can be
+// converted to the bare layout with its checkout at the path worktreePath
+// returns for its branch, and returns the plan. Clones with a detached HEAD,
+// an operation in progress or submodules are refused.
+func PlanConversion(ctx context.Context, r Runner, root string, worktreePath func(branch string) string) (*Conversion, error) {
+	if info, err := os.Stat(filepath.Join(root, ".git")); err != nil || !info.IsDir() {
+		return nil, fmt.Errorf("%s is not the main worktree of a clone", root)
+	}
+	if op := detectOperation(root); op != OpNone {
+		return nil, fmt.Errorf("a %s is in progress; finish or abort it first", op)
+	}
+	branch, err := r.Run(ctx, root, "symbolic-ref", "--short", "-q", "HEAD")
+	if err != nil {
+		return nil, fmt.Errorf("HEAD is detached; check out a branch first")
+	}
+	// Submodules link to their repositories in .git/modules by relative
+	// paths, which would no longer resolve.
+	if _, err := os.Stat(filepath.Join(root, ".git", "modules")); err == nil {
+		return nil, fmt.Errorf("converting a clone with submodules is not supported")
+	}
+
+	c := &Conversion{Root: root, Branch: branch, WorktreePath: worktreePath(branch)}
+	if filepath.Dir(c.WorktreePath) != filepath.Clean(root) {
+		return nil, fmt.Errorf("worktree path %s is not directly inside %s", c.WorktreePath, root)
+	}
+	entries, err := os.ReadDir(root)
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range entries {
+		switch e.Name() {
+		case ".git":
+		case BareDir, convertStaging:
+			return nil, fmt.Errorf("%s already exists", filepath.Join(root, e.Name()))
+		default:
+			c.Entries = append(c.Entries, e.Name())
+		}
+	}
+
+	worktrees, err := ListWorktrees(ctx, r, root)
+	if err != nil {
+		return nil, err
+	}
+	for _, wt := range worktrees[1:] {
+		if !wt.IsPrunable {
+			c.Worktrees = append(c.Worktrees, wt.Path)
+		}
+	}
+	return c, nil
+}
+
+// ConvertToBare carries out c: the git dir is renamed to BareDir with a .git
+// file pointing to it, the repository is made bare and the checkout, with
+// its index and local changes, becomes a linked worktree at c.WorktreePath.
+// Stashes, hooks, config and refs stay in the repository. If a step fails,
+// the steps already taken are undone.
+func ConvertToBare(ctx context.Context, r Runner, c *Conversion) (err error) {
+	root := c.Root
+	gitDir := filepath.Join(root, ".git")
+	bareDir := filepath.Join(root, BareDir)
+	staging := filepath.Join(root, convertStaging)
+	staged := filepath.Join(staging, filepath.Base(c.WorktreePath))
+
+	var undo []func() error
+	defer func() {
+		if err == nil {
+			return
+		}
+		for i := len(undo) - 1; i >= 0; i-- {
+			if undoErr := undo[i](); undoErr != nil {
+				err = fmt.Errorf("%w; rollback failed: %s", err, Describe(undoErr))
+				return
+			}
+		}
+		err = fmt.Errorf("%w (changes rolled back)", err)
+	}()
+	// move renames from to to and registers the reverse rename.
+	move := func(from, to string) error {
+		if err := os.Rename(from, to); err != nil {
+			return err
+		}
+		undo = append(undo, func() error { return os.Rename(to, from) })
+		return nil
+	}
+	bgCtx := context.WithoutCancel(ctx)
+	run := func(args ...string) error {
+		_, err := r.Run(ctx, root, args...)
+		return err
+	}
+
+	// Linked worktrees point to the old git dir again once it is back.
+	undo = append(undo, func() error { return RepairWorktrees(bgCtx, r, root) })
+	if err := move(gitDir, bareDir); err != nil {
+		return err
+	}
+	if err := writeGitFile(root, BareDir); err != nil {
+		return err
+	}
+	undo = append(undo, func() error { return os.Remove(gitDir) })
+
+	// Bare repositories do not keep reflogs by default.
+	if _, err := r.Run(ctx, root, "config", "core.logAllRefUpdates"); err != nil {
+		if err := run("config", "core.logAllRefUpdates", "true"); err != nil {
+			return err
+		}
+		undo = append(undo, func() error {
+			_, err := r.Run(bgCtx, root, "config", "--unset", "core.logAllRefUpdates")
+			return err
+		})
+	}
+	if err := run("config", "core.bare", "true"); err != nil {
+		return err
+	}
+	undo = append(undo, func() error {
+		_, err := r.Run(bgCtx, root, "config", "core.bare", "false")
+		return err
+	})
+
+	if err := os.Mkdir(staging, 0o755); err != nil {
+		return err
+	}
+	undo = append(undo, func() error { return os.RemoveAll(staging) })
+	if err := run("worktree", "add", "--no-checkout", staged, c.Branch); err != nil {
+		return err
+	}
+	adminDir, err := readGitFile(staged)
+	if err != nil {
+		return err
+	}
+	undo = append(undo, func() error { return os.RemoveAll(adminDir) })
+
+	// The index and HEAD reflog of the checkout belong to the worktree now.
+	if err := move(filepath.Join(bareDir, "index"), filepath.Join(adminDir, "index")); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Join(adminDir, "logs"), 0o755); err != nil {
+		return err
+	}
+	if err := move(filepath.Join(bareDir, "logs", "HEAD"), filepath.Join(adminDir, "logs", "HEAD")); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	for _, name := range c.Entries {
+		if err := move(filepath.Join(root, name), filepath.Join(staged, name)); err != nil {
+			return err
+		}
+	}
+	if err := move(staged, c.WorktreePath); err != nil {
+		return err
+	}
+	if err := os.Remove(staging); err != nil {
+		return err
+	}
+	undo = append(undo, func() error { return os.Mkdir(staging, 0o755) })
+
+	return RepairWorktrees(ctx, r, root, c.WorktreePath)
+}
@@ -0,0 +1,213 @@
+package git
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/yasomaru/git-wt/testutil"
+)
+
+func TestCloneBare(t *testing.T) {
+	src := testutil.InitTestRepo(t)
+	testutil.CreateBranch(t, src, "feature")
+	container := filepath.Join(t.TempDir(), "repo")
+
+	branch, err := CloneBare(t.Context(), testRunner, src, container)
+	if err != nil {
+		t.Fatalf("CloneBare() error: %v", err)
+	}
+	if branch != "master" {
+		t.Errorf("CloneBare() branch = %q, want master", branch)
+	}
+	if info, err := os.Stat(filepath.Join(container, BareDir)); err != nil || !info.IsDir() {
+		t.Fatalf("expected bare repository in %s: %v", BareDir, err)
+	}
+
+	if BranchExists(t.Context(), testRunner, container, "feature") {
+		t.Error("expected only the default branch to be a local branch")
+	}
+	if _, ok := RemoteTrackingRef(t.Context(), testRunner, container, "origin", "feature"); !ok {
+		t.Error("expected origin/feature to be fetched")
+	}
+	if got, err := DefaultBranch(t.Context(), testRunner, container, nil); err != nil || got != "master" {
+		t.Errorf("DefaultBranch() = %q, %v, want master from origin/HEAD", got, err)
+	}
+	if remote, merge := BranchUpstream(t.Context(), testRunner, container, "master"); remote != "origin" || merge != "refs/heads/master" {
+		t.Errorf("upstream of master = %s %s, want origin refs/heads/master", remote, merge)
+	}
+}
+
+func TestCloneBare_ExistingPath(t *testing.T) {
+	src := testutil.InitTestRepo(t)
+	container := t.TempDir()
+
+	if _, err := CloneBare(t.Context(), testRunner, src, container); err == nil {
+		t.Fatal("CloneBare() into an existing directory succeeded, want an error")
+	}
+	if _, err := os.Stat(container); err != nil {
+		t.Error("an existing directory must not be removed")
+	}
+}
+
+func TestCloneBare_FailureRemovesContainer(t *testing.T) {
+	container := filepath.Join(t.TempDir(), "repo")
+
+	if _, err := CloneBare(t.Context(), testRunner, filepath.Join(t.TempDir(), "missing"), container); err == nil {
+		t.Fatal("CloneBare() of a missing repository succeeded, want an error")
+	}
+	if _, err := os.Stat(container); !os.IsNotExist(err) {
+		t.Error("expected the container to be removed after a failed clone")
+	}
+}
+
+func TestRepoRoot_BareLayout(t *testing.T) {
+	src := testutil.InitTestRepo(t)
+	container := filepath.Join(t.TempDir(), "repo")
+	if _, err := CloneBare(t.Context(), testRunner, src, container); err != nil {
+		t.Fatalf("CloneBare() error: %v", err)
+	}
+	wtPath := filepath.Join(container, "master")
+	if err := AddWorktree(t.Context(), testRunner, container, wtPath, "master", ""); err != nil {
+		t.Fatalf("AddWorktree() error: %v", err)
+	}
+
+	for _, dir := range []string{container, wtPath, filepath.Join(container, BareDir)} {
+		got, err := RepoRoot(t.Context(), testRunner, dir)
+		if err != nil {
+			t.Errorf("RepoRoot(%q) error: %v", dir, err)
+			continue
+		}
+		if cleanPath(got) != cleanPath(container) {
+			t.Errorf("RepoRoot(%q) = %q, want the container %q", dir, got, container)
+		}
+	}
+}
+
+func TestRepoRoot_PlainBareRepository(t *testing.T) {
+	src := testutil.InitTestRepo(t)
+	bare := filepath.Join(t.TempDir(), "repo.git")
+	runGitHelper(t, src, "clone", "--bare", src, bare)
+
+	got, err := RepoRoot(t.Context(), testRunner, bare)
+	if err != nil {
+		t.Fatalf("RepoRoot() error: %v", err)
+	}
+	if cleanPath(got) != cleanPath(bare) {
+		t.Errorf("RepoRoot() = %q, want the git dir %q", got, bare)
+	}
+}
+
+func TestConvertToBare(t *testing.T) {
+	ctx := t.Context()
+	root := testutil.InitTestRepo(t)
+	linked := testutil.AddWorktree(t, root, "feature")
+	testutil.WriteFile(t, root, "stashed.txt", "stash me\n")
+	if _, err := testRunner.Run(ctx, root, "stash", "push", "--include-untracked"); err != nil {
+		t.Fatal(err)
+	}
+	testutil.WriteFile(t, root, filepath.Join(".git", "hooks", "pre-commit"), "#!/bin/sh\n")
+	testutil.WriteFile(t, root, "staged.txt", "staged\n")
+	if _, err := testRunner.Run(ctx, root, "add", "staged.txt"); err != nil {
+		t.Fatal(err)
+	}
+	testutil.WriteFile(t, root, "README.md", "# changed\n")
+	testutil.WriteFile(t, root, "untracked.txt", "new\n")
+	before, _ := testRunner.Run(ctx, root, "status", "--porcelain")
+
+	wtPath := filepath.Join(root, "master")
+	c, err := PlanConversion(ctx, testRunner, root, func(branch string) string { return filepath.Join(root, branch) })
+	if err != nil {
+		t.Fatalf("PlanConversion() error: %v", err)
+	}
+	if c.Branch != "master" || len(c.Worktrees) != 1 {
+		t.Errorf("PlanConversion() = branch %q, worktrees %v, want master and the linked worktree", c.Branch, c.Worktrees)
+	}
+	if err := ConvertToBare(ctx, testRunner, c); err != nil {
+		t.Fatalf("ConvertToBare() error: %v", err)
+	}
+
+	if got, err := RepoRoot(ctx, testRunner, wtPath); err != nil || cleanPath(got) != cleanPath(root) {
+		t.Errorf("RepoRoot() from the worktree = %q, %v, want %q", got, err, root)
+	}
+	if after, _ := testRunner.Run(ctx, wtPath, "status", "--porcelain"); after != before {
+		t.Errorf("status after conversion = %q, want %q", after, before)
+	}
+	if stashes, _ := testRunner.Run(ctx, wtPath, "stash", "list"); stashes == "" {
+		t.Error("expected the stash to be preserved")
+	}
+	if _, err := os.Stat(filepath.Join(root, BareDir, "hooks", "pre-commit")); err != nil {
+		t.Errorf("expected the hook to be preserved: %v", err)
+	}
+	if branch, err := testRunner.Run(ctx, linked, "symbolic-ref", "--short", "HEAD"); err != nil || branch != "feature" {
+		t.Errorf("linked worktree HEAD = %q, %v, want feature", branch, err)
+	}
+
+	worktrees, err := ListWorktrees(ctx, testRunner, root)
+	if err != nil {
+		t.Fatalf("ListWorktrees() error: %v", err)
+	}
+	if len(worktrees) != 3 || !worktrees[0].IsBare {
+		t.Fatalf("ListWorktrees() = %+v, want the bare repository and two worktrees", worktrees)
+	}
+}
+
+func TestConvertToBare_RollsBack(t *testing.T) {
+	ctx := t.Context()
+	root := testutil.InitTestRepo(t)
+	testutil.WriteFile(t, root, "README.md", "# changed\n")
+	before, _ := testRunner.Run(ctx, root, "status", "--porcelain")
+
+	c, err := PlanConversion(ctx, testRunner, root, func(string) string { return filepath.Join(root, "master") })
+	if err != nil {
+		t.Fatalf("PlanConversion() error: %v", err)
+	}
+	// An entry that vanished after planning makes the move fail.
+	c.Entries = append(c.Entries, "missing")
+	if err := ConvertToBare(ctx, testRunner, c); err == nil {
+		t.Fatal("ConvertToBare() succeeded, want an error")
+	}
+
+	if info, err := os.Stat(filepath.Join(root, ".git")); err != nil || !info.IsDir() {
+		t.Fatalf("expected .git to be a directory again: %v", err)
+	}
+	for _, name := range []string{BareDir, "master", convertStaging} {
+		if _, err := os.Stat(filepath.Join(root, name)); !os.IsNotExist(err) {
+			t.Errorf("expected %s to be removed", name)
+		}
+	}
+	if bare, _ := testRunner.Run(ctx, root, "config", "--bool", "core.bare"); bare != "false" {
+		t.Errorf("core.bare = %q, want false", bare)
+	}
+	if after, _ := testRunner.Run(ctx, root, "status", "--porcelain"); after != before {
+		t.Errorf("status after rollback = %q, want %q", after, before)
+	}
+	if worktrees, err := ListWorktrees(ctx, testRunner, root); err != nil || len(worktrees) != 1 {
+		t.Errorf("ListWorktrees() = %d worktrees, %v, want only the main worktree", len(worktrees), err)
+	}
+}
+
+func TestPlanConversion_Refusals(t *testing.T) {
+	ctx := t.Context()
+
+	detached := testutil.InitTestRepo(t)
+	if _, err := testRunner.Run(ctx, detached, "checkout", "--detach"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := PlanConversion(ctx, testRunner, detached, func(string) string { return filepath.Join(detached, "master") }); err == nil {
+		t.Error("expected a detached HEAD to be refused")
+	}
+
+	root := testutil.InitTestRepo(t)
+	if _, err := PlanConversion(ctx, testRunner, root, func(string) string { return filepath.Join(t.TempDir(), "master") }); err == nil {
+		t.Error("expected a worktree path outside the clone to be refused")
+	}
+
+	container := filepath.Join(t.TempDir(), "repo")
+	if _, err := CloneBare(ctx, testRunner, root, container); err != nil {
+		t.Fatalf("CloneBare() error: %v", err)
+	}
+	if _, err := PlanConversion(ctx, testRunner, container, func(string) string { return filepath.Join(container, "master") }); err == nil {
+		t.Error("expected a bare layout to be refused")
+	}
+}
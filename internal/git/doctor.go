@@ -0,0 +1,198 @@
+package git
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ProblemKind identifies a kind of broken worktree metadata.
+type ProblemKind string
+
+const (
+	// ProblemMissingPath is a registered worktree whose directory is gone.
+	ProblemMissingPath ProblemKind = "missing-path"
+	// ProblemDanglingEntry is an entry under .git/worktrees that no longer
+	// records where its worktree lives.
+	ProblemDanglingEntry ProblemKind = "dangling-entry"
+	// ProblemUnregistered is a directory in the worktree layout that git does
+	// not know as a worktree.
+	ProblemUnregistered ProblemKind = "unregistered-dir"
+	// ProblemGitdirMismatch is a worktree whose .git file does not point back
+	// to its entry under .git/worktrees, e.g. after the main clone moved.
+	ProblemGitdirMismatch ProblemKind = "gitdir-mismatch"
+)
+
+// Fix is the action that resolves a Problem.
+type Fix string
+
+const (
+	// FixNone means the problem has to be resolved by hand.
+	FixNone Fix = "none"
+	// FixRepair is resolved by `git worktree repair`.
+	FixRepair Fix = "repair"
+	// FixPrune is resolved by `git worktree prune`.
+	FixPrune Fix = "prune"
+)
+
+// Problem describes one inconsistency between the worktrees on disk and the
+// repository's administrative files.
+type Problem struct {
+	Kind   ProblemKind `json:"kind"`
+	Path   string      `json:"path"`
+	Entry  string      `json:"entry,omitempty"` // directory under .git/worktrees
+	Detail string      `json:"detail"`
+	Fix    Fix         `json:"fix"`
+}
+
+// GitCommonDir returns the absolute path of the repository's common git
+// directory, which is shared by all worktrees.
+func GitCommonDir(ctx context.Context, r Runner, dir string) (string, error) {
+	out, err := r.Run(ctx, dir, "rev-parse", "--git-common-dir")
+	if err != nil {
+		return "", err
+	}
+	if !filepath.IsAbs(out) {
+		if dir == "" {
+			dir, _ = os.Getwd()
+		}
+		out = filepath.Join(dir, out)
+	}
+	return filepath.Clean(out), nil
+}
+
+// Diagnose checks the worktrees of the repository at repoDir for broken
+// metadata. candidates are directories where worktrees are expected to live,
+// typically everything matching the configured layout; those that are not
+// registered worktrees are reported too.
+func Diagnose(ctx context.Context, r Runner, repoDir string, candidates []string) ([]Problem, error) {
+	commonDir, err := GitCommonDir(ctx, r, repoDir)
+	if err != nil {
+		return nil, err
+	}
+	worktrees, err := ListWorktrees(ctx, r, repoDir)
+	if err != nil {
+		return nil, err
+	}
+
+	// Map each administrative entry to the worktree it records.
+	entries := make(map[string]string) // worktree path -> entry
+	var dangling []string
+	adminDirs, _ := filepath.Glob(filepath.Join(commonDir, "worktrees", "*"))
+	for _, entry := range adminDirs {
+		data, err := os.ReadFile(filepath.Join(entry, "gitdir"))
+		gitdir := strings.TrimSpace(string(data))
+		if err != nil || gitdir == "" {
+			dangling = append(dangling, entry)
+			continue
+		}
+		entries[cleanPath(filepath.Dir(gitdir))] = entry
+	}
+
+	var problems []Problem
+	registered := make(map[string]bool)
+	for i, wt := range worktrees {
+		registered[cleanPath(wt.Path)] = true
+		if i == 0 || wt.IsBare {
+			continue
+		}
+		entry := entries[cleanPath(wt.Path)]
+		if _, err := os.Stat(wt.Path); os.IsNotExist(err) {
+			p := Problem{Kind: ProblemMissingPath, Path: wt.Path, Entry: entry,
+				Detail: "worktree directory does not exist", Fix: FixPrune}
+			if wt.IsLocked {
+				// Locked worktrees may live on media that is not mounted.
+				p.Detail += " (locked, not pruned)"
+				p.Fix = FixNone
+			}
+			problems = append(problems, p)
+			continue
+		}
+		target, err := readGitFile(wt.Path)
+		if err != nil {
+			problems = append(problems, Problem{Kind: ProblemGitdirMismatch, Path: wt.Path, Entry: entry,
+				Detail: err.Error(), Fix: FixRepair})
+			continue
+		}
+		if entry != "" && cleanPath(target) != cleanPath(entry) {
+			problems = append(problems, Problem{Kind: ProblemGitdirMismatch, Path: wt.Path, Entry: entry,
+				Detail: fmt.Sprintf(".git points to %s", target), Fix: FixRepair})
+		}
+	}
+
+	// Entries reclaimed by an unregistered directory are repaired, not pruned.
+	reclaimed := make(map[string]bool)
+	for _, dir := range candidates {
+		if registered[cleanPath(dir)] {
+			continue
+		}
+		target, err := readGitFile(dir)
+		switch {
+		case err == nil && isWithin(target, commonDir):
+			reclaimed[cleanPath(target)] = true
+			problems = append(problems, Problem{Kind: ProblemUnregistered, Path: dir, Entry: target,
+				Detail: "worktree of this repository is not registered", Fix: FixRepair})
+		case os.IsNotExist(err):
+			problems = append(problems, Problem{Kind: ProblemUnregistered, Path: dir,
+				Detail: "directory is not a git worktree", Fix: FixNone})
+		}
+		// Anything else belongs to another repository and is left alone.
+	}
+
+	for _, entry := range dangling {
+		if reclaimed[cleanPath(entry)] {
+			continue
+		}
+		problems = append(problems, Problem{Kind: ProblemDanglingEntry, Path: entry, Entry: entry,
+			Detail: "entry has no gitdir file", Fix: FixPrune})
+	}
+	return problems, nil
+}
+
+// RepairWorktrees runs `git worktree repair` for the given worktree paths.
+// Without paths, the links of all registered worktrees are repaired.
+func RepairWorktrees(ctx context.Context, r Runner, repoDir string, paths ...string) error {
+	_, err := r.Run(ctx, repoDir, append([]string{"worktree", "repair"}, paths...)...)
+	return err
+}
+
+// readGitFile returns the git directory a worktree's .git file points to.
+// The returned error satisfies os.IsNotExist if dir has no .git at all.
+func readGitFile(dir string) (string, error) {
+	gitPath := filepath.Join(dir, ".git")
+	info, err := os.Stat(gitPath)
+	if err != nil {
+		return "", err
+	}
+	if info.IsDir() {
+		return "", fmt.Errorf("%s is a repository, not a linked worktree", dir)
+	}
+	data, err := os.ReadFile(gitPath)
+	if err != nil {
+		return "", err
+	}
+	target, ok := strings.CutPrefix(strings.TrimSpace(string(data)), "gitdir: ")
+	if !ok {
+		return "", fmt.Errorf("%s is not a gitdir file", gitPath)
+	}
+	if !filepath.IsAbs(target) {
+		target = filepath.Join(dir, target)
+	}
+	return target, nil
+}
+
+// cleanPath resolves symlinks where possible so that paths reported by git
+// and paths built locally compare equal.
+func cleanPath(path string) string {
+	if resolved, err := filepath.EvalSymlinks(path); err == nil {
+		return resolved
+	}
+	return filepath.Clean(path)
+}
+
+func isWithin(path, dir string) bool {
+	rel, err := filepath.Rel(cleanPath(dir), cleanPath(path))
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(os.PathSeparator))
+}
@@ -0,0 +1,170 @@
+package git
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/yasomaru/git-wt/testutil"
+)
+
+// problemKinds returns the kinds of problems found for the given path.
+func problemKinds(problems []Problem, path string) []ProblemKind {
+	var kinds []ProblemKind
+	for _, p := range problems {
+		if cleanPath(p.Path) == cleanPath(path) {
+			kinds = append(kinds, p.Kind)
+		}
+	}
+	return kinds
+}
+
+func TestDiagnose_Healthy(t *testing.T) {
+	dir := testutil.InitTestRepo(t)
+	wtPath := testutil.AddWorktree(t, dir, "healthy")
+
+	problems, err := Diagnose(t.Context(), testRunner, dir, []string{wtPath})
+	if err != nil {
+		t.Fatalf("Diagnose() error: %v", err)
+	}
+	if len(problems) != 0 {
+		t.Errorf("expected no problems, got %+v", problems)
+	}
+}
+
+func TestDiagnose_MissingPath(t *testing.T) {
+	dir := testutil.InitTestRepo(t)
+	gone := testutil.AddWorktree(t, dir, "gone")
+	locked := testutil.AddWorktree(t, dir, "usb")
+	runGitHelper(t, dir, "worktree", "lock", locked)
+	for _, path := range []string{gone, locked} {
+		if err := os.RemoveAll(path); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	problems, err := Diagnose(t.Context(), testRunner, dir, nil)
+	if err != nil {
+		t.Fatalf("Diagnose() error: %v", err)
+	}
+	if len(problems) != 2 {
+		t.Fatalf("expected 2 problems, got %+v", problems)
+	}
+	for _, p := range problems {
+		if p.Kind != ProblemMissingPath {
+			t.Errorf("Kind = %q, want %q", p.Kind, ProblemMissingPath)
+		}
+		wantFix := FixPrune
+		if filepath.Base(p.Path) == filepath.Base(locked) {
+			wantFix = FixNone
+		}
+		if p.Fix != wantFix {
+			t.Errorf("%s: Fix = %q, want %q", p.Path, p.Fix, wantFix)
+		}
+	}
+}
+
+func TestDiagnose_DanglingEntry(t *testing.T) {
+	dir := testutil.InitTestRepo(t)
+	entry := filepath.Join(dir, ".git", "worktrees", "leftover")
+	if err := os.MkdirAll(entry, 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	problems, err := Diagnose(t.Context(), testRunner, dir, nil)
+	if err != nil {
+		t.Fatalf("Diagnose() error: %v", err)
+	}
+	if len(problems) != 1 || problems[0].Kind != ProblemDanglingEntry || problems[0].Fix != FixPrune {
+		t.Fatalf("expected one prunable dangling entry, got %+v", problems)
+	}
+
+	if err := PruneWorktrees(t.Context(), testRunner, dir); err != nil {
+		t.Fatalf("PruneWorktrees() error: %v", err)
+	}
+	if _, err := os.Stat(entry); !os.IsNotExist(err) {
+		t.Error("expected prune to remove the dangling entry")
+	}
+}
+
+func TestDiagnose_UnregisteredDirectories(t *testing.T) {
+	dir := testutil.InitTestRepo(t)
+	plain := filepath.Join(t.TempDir(), "plain")
+	if err := os.MkdirAll(plain, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	other := testutil.InitTestRepo(t)
+
+	// A worktree whose entry lost its gitdir file is found through its
+	// directory and reconnected by repair instead of being pruned.
+	orphan := testutil.AddWorktree(t, dir, "orphan")
+	entry, err := readGitFile(orphan)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(filepath.Join(entry, "gitdir")); err != nil {
+		t.Fatal(err)
+	}
+
+	problems, err := Diagnose(t.Context(), testRunner, dir, []string{plain, other, orphan})
+	if err != nil {
+		t.Fatalf("Diagnose() error: %v", err)
+	}
+	if len(problems) != 2 {
+		t.Fatalf("expected 2 problems, got %+v", problems)
+	}
+	if kinds := problemKinds(problems, plain); len(kinds) != 1 || kinds[0] != ProblemUnregistered {
+		t.Errorf("plain directory: kinds = %v, want [%s]", kinds, ProblemUnregistered)
+	}
+	if kinds := problemKinds(problems, orphan); len(kinds) != 1 || kinds[0] != ProblemUnregistered {
+		t.Errorf("orphaned worktree: kinds = %v, want [%s]", kinds, ProblemUnregistered)
+	}
+
+	if err := RepairWorktrees(t.Context(), testRunner, dir, orphan); err != nil {
+		t.Fatalf("RepairWorktrees() error: %v", err)
+	}
+	problems, err = Diagnose(t.Context(), testRunner, dir, []string{orphan})
+	if err != nil {
+		t.Fatalf("Diagnose() after repair error: %v", err)
+	}
+	if len(problems) != 0 {
+		t.Errorf("expected repair to register the worktree again, got %+v", problems)
+	}
+}
+
+func TestDiagnose_GitdirMismatchAfterMove(t *testing.T) {
+	orig := testutil.InitTestRepo(t)
+	wtPath := testutil.AddWorktree(t, orig, "linked")
+	moved := filepath.Join(filepath.Dir(orig), "moved")
+	if err := os.Rename(orig, moved); err != nil {
+		t.Fatal(err)
+	}
+
+	problems, err := Diagnose(t.Context(), testRunner, moved, nil)
+	if err != nil {
+		t.Fatalf("Diagnose() error: %v", err)
+	}
+	if kinds := problemKinds(problems, wtPath); len(kinds) != 1 || kinds[0] != ProblemGitdirMismatch {
+		t.Fatalf("expected a gitdir mismatch for %s, got %+v", wtPath, problems)
+	}
+
+	if err := RepairWorktrees(t.Context(), testRunner, moved, wtPath); err != nil {
+		t.Fatalf("RepairWorktrees() error: %v", err)
+	}
+	if problems, _ := Diagnose(t.Context(), testRunner, moved, nil); len(problems) != 0 {
+		t.Errorf("expected repair to fix the mismatch, got %+v", problems)
+	}
+}
+
+func TestGitCommonDir_FromLinkedWorktree(t *testing.T) {
+	dir := testutil.InitTestRepo(t)
+	wtPath := testutil.AddWorktree(t, dir, "linked")
+
+	got, err := GitCommonDir(t.Context(), testRunner, wtPath)
+	if err != nil {
+		t.Fatalf("GitCommonDir() error: %v", err)
+	}
+	if cleanPath(got) != cleanPath(filepath.Join(dir, ".git")) {
+		t.Errorf("GitCommonDir() = %q, want %q", got, filepath.Join(dir, ".git"))
+	}
+}
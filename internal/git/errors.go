@@ -0,0 +1,124 @@
+package git
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrorKind classifies why a git command failed.
+type ErrorKind int
+
+const (
+	// KindUnknown is used for failures that are not recognised.
+	KindUnknown ErrorKind = iota
+	// KindDirty means the worktree has modified or untracked files.
+	KindDirty
+	// KindLocked means the worktree is locked.
+	KindLocked
+	// KindMissing means the path is not a registered worktree or does not exist.
+	KindMissing
+	// KindBranchCheckedOut means the branch is checked out in another worktree.
+	KindBranchCheckedOut
+	// KindNotARepo means the directory is not inside a git repository.
+	KindNotARepo
+	// KindSubmodules means git refuses to move or remove a worktree because
+	// it contains initialised submodules.
+	KindSubmodules
+)
+
+func (k ErrorKind) String() string {
+	switch k {
+	case KindDirty:
+		return "dirty"
+	case KindLocked:
+		return "locked"
+	case KindMissing:
+		return "missing"
+	case KindBranchCheckedOut:
+		return "branch-checked-out"
+	case KindNotARepo:
+		return "not-a-repo"
+	case KindSubmodules:
+		return "submodules"
+	default:
+		return "unknown"
+	}
+}
+
+// GitError describes a failed git invocation. Use errors.As to retrieve it
+// from errors returned by this package.
+type GitError struct {
+	Args     []string
+	ExitCode int // -1 if git did not exit normally (e.g. it was killed)
+	Stderr   string
+	Kind     ErrorKind
+	Err      error // underlying error, e.g. context.DeadlineExceeded
+}
+
+func (e *GitError) Error() string {
+	msg := e.Stderr
+	if msg == "" && e.Err != nil {
+		msg = e.Err.Error()
+	}
+	return fmt.Sprintf("git %s: %s", strings.Join(e.Args, " "), msg)
+}
+
+func (e *GitError) Unwrap() error {
+	return e.Err
+}
+
+// classifyStderr maps git's error output to an ErrorKind.
+func classifyStderr(stderr string) ErrorKind {
+	s := strings.ToLower(stderr)
+	switch {
+	case strings.Contains(s, "not a git repository"):
+		return KindNotARepo
+	case strings.Contains(s, "contains modified or untracked files"):
+		return KindDirty
+	case strings.Contains(s, "checked out at"),
+		strings.Contains(s, "is already used by worktree at"):
+		return KindBranchCheckedOut
+	case strings.Contains(s, "locked working tree"),
+		strings.Contains(s, "is locked"),
+		strings.Contains(s, "is already locked"):
+		return KindLocked
+	case strings.Contains(s, "containing submodules cannot be"):
+		return KindSubmodules
+	case strings.Contains(s, "is not a working tree"),
+		strings.Contains(s, "does not exist"):
+		return KindMissing
+	default:
+		return KindUnknown
+	}
+}
+
+// ErrorKindOf returns the kind of a *GitError wrapped in err, or KindUnknown.
+func ErrorKindOf(err error) ErrorKind {
+	var gitErr *GitError
+	if errors.As(err, &gitErr) {
+		return gitErr.Kind
+	}
+	return KindUnknown
+}
+
+// Describe returns a short explanation of err for end users. Errors that are
+// not classified are returned verbatim.
+func Describe(err error) string {
+	switch ErrorKindOf(err) {
+	case KindDirty:
+		return "worktree contains modified or untracked files"
+	case KindLocked:
+		return "worktree is locked"
+	case KindMissing:
+		return "not a registered worktree"
+	case KindBranchCheckedOut:
+		return "branch is already checked out in another worktree"
+	case KindNotARepo:
+		return "not a git repository"
+	case KindSubmodules:
+		return "worktree contains submodules"
+	default:
+		return err.Error()
+	}
+}
@@ -0,0 +1,363 @@
+package git
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/yasomaru/git-wt/testutil"
+)
+
+func TestClassifyStderr(t *testing.T) {
+	tests := []struct {
+		name   string
+		stderr string
+		want   ErrorKind
+	}{
+		{
+			name:   "dirty worktree",
+			stderr: "fatal: '/tmp/repo-feat' contains modified or untracked files, use --force to delete it",
+			want:   KindDirty,
+		},
+		{
+			name:   "locked worktree",
+			stderr: "fatal: cannot remove a locked working tree, lock reason: usb drive\nuse 'remove -f -f' to override or unlock first",
+			want:   KindLocked,
+		},
+		{
+			name:   "already locked",
+			stderr: "fatal: '/tmp/repo-usb' is already locked, reason: usb drive",
+			want:   KindLocked,
+		},
+		{
+			name:   "worktree with submodules",
+			stderr: "fatal: working trees containing submodules cannot be moved or removed",
+			want:   KindSubmodules,
+		},
+		{
+			name:   "not a worktree",
+			stderr: "fatal: '/tmp/nope' is not a working tree",
+			want:   KindMissing,
+		},
+		{
+			name:   "branch checked out",
+			stderr: "fatal: 'main' is already checked out at '/tmp/repo'",
+			want:   KindBranchCheckedOut,
+		},
+		{
+			name:   "branch used by worktree (newer git)",
+			stderr: "fatal: 'main' is already used by worktree at '/tmp/repo'",
+			want:   KindBranchCheckedOut,
+		},
+		{
+			name:   "branch delete refused",
+			stderr: "error: Cannot delete branch 'feat' checked out at '/tmp/repo-feat'",
+			want:   KindBranchCheckedOut,
+		},
+		{
+			name:   "not a repository",
+			stderr: "fatal: not a git repository (or any of the parent directories): .git",
+			want:   KindNotARepo,
+		},
+		{
+			name:   "unrecognised",
+			stderr: "fatal: something unexpected",
+			want:   KindUnknown,
+		},
+		{
+			name:   "empty",
+			stderr: "",
+			want:   KindUnknown,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := classifyStderr(tt.stderr); got != tt.want {
+				t.Errorf("classifyStderr() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGitError_ErrorAndUnwrap(t *testing.T) {
+	err := &GitError{
+		Args:   []string{"status"},
+		Stderr: "",
+		Err:    context.DeadlineExceeded,
+	}
+	if got, want := err.Error(), "git status: context deadline exceeded"; got != want {
+		t.Errorf("Error() = %q, want %q", got, want)
+	}
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Error("expected errors.Is(err, context.DeadlineExceeded) to be true")
+	}
+
+	err = &GitError{Args: []string{"worktree", "remove", "x"}, Stderr: "fatal: boom"}
+	if got, want := err.Error(), "git worktree remove x: fatal: boom"; got != want {
+		t.Errorf("Error() = %q, want %q", got, want)
+	}
+}
+
+func TestDescribe(t *testing.T) {
+	if got := Describe(&GitError{Kind: KindLocked}); got != "worktree is locked" {
+		t.Errorf("Describe(locked) = %q", got)
+	}
+	plain := errors.New("plain failure")
+	if got := Describe(plain); got != "plain failure" {
+		t.Errorf("Describe(plain) = %q, want %q", got, "plain failure")
+	}
+}
+
+func TestExecRunner_ReturnsGitError(t *testing.T) {
+	t.Parallel()
+
+	t.Run("not a repository", func(t *testing.T) {
+		t.Parallel()
+		_, err := RepoRoot(t.Context(), testRunner, t.TempDir())
+
+		var gitErr *GitError
+		if !errors.As(err, &gitErr) {
+			t.Fatalf("expected *GitError, got %T: %v", err, err)
+		}
+		if gitErr.Kind != KindNotARepo {
+			t.Errorf("Kind = %v, want %v", gitErr.Kind, KindNotARepo)
+		}
+		if gitErr.ExitCode != 128 {
+			t.Errorf("ExitCode = %d, want 128", gitErr.ExitCode)
+		}
+		if len(gitErr.Args) == 0 || gitErr.Args[0] != "rev-parse" {
+			t.Errorf("Args = %v, want rev-parse ...", gitErr.Args)
+		}
+	})
+
+	t.Run("killed by timeout", func(t *testing.T) {
+		t.Parallel()
+		dir := testutil.InitTestRepo(t)
+		ctx, cancel := context.WithTimeout(t.Context(), time.Nanosecond)
+		defer cancel()
+		<-ctx.Done()
+
+		_, err := testRunner.Run(ctx, dir, "status")
+		var gitErr *GitError
+		if !errors.As(err, &gitErr) {
+			t.Fatalf("expected *GitError, got %T: %v", err, err)
+		}
+		if gitErr.ExitCode != -1 {
+			t.Errorf("ExitCode = %d, want -1", gitErr.ExitCode)
+		}
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("expected wrapped context.DeadlineExceeded, got %v", err)
+		}
+	})
+}
+
+func TestRemoveWorktree_LockedNotForced(t *testing.T) {
+	dir := testutil.InitTestRepo(t)
+	wtPath := testutil.AddWorktree(t, dir, "locked")
+	runGitHelper(t, dir, "worktree", "lock", "--reason", "usb drive", wtPath)
+	t.Cleanup(func() {
+		_, _ = testRunner.Run(context.Background(), dir, "worktree", "unlock", wtPath)
+	})
+
+	_, err := RemoveWorktree(t.Context(), testRunner, dir, wtPath, RemoveOptions{})
+	if ErrorKindOf(err) != KindLocked {
+		t.Fatalf("RemoveWorktree() on locked worktree = %v, want KindLocked", err)
+	}
+}
+
+func TestRemoveWorktree_LockedForced(t *testing.T) {
+	dir := testutil.InitTestRepo(t)
+	wtPath := testutil.AddWorktree(t, dir, "locked")
+	runGitHelper(t, dir, "worktree", "lock", wtPath)
+
+	if _, err := RemoveWorktree(t.Context(), testRunner, dir, wtPath, RemoveOptions{Force: true}); err != nil {
+		t.Fatalf("RemoveWorktree(Force) on locked worktree error: %v", err)
+	}
+	if _, err := os.Stat(wtPath); !os.IsNotExist(err) {
+		t.Error("expected locked worktree directory to be removed")
+	}
+}
+
+func TestRemoveWorktree_NotAWorktree(t *testing.T) {
+	dir := testutil.InitTestRepo(t)
+
+	_, err := RemoveWorktree(t.Context(), testRunner, dir, filepath.Join(t.TempDir(), "nope"), RemoveOptions{})
+	if ErrorKindOf(err) != KindMissing {
+		t.Fatalf("RemoveWorktree() on unknown path = %v, want KindMissing", err)
+	}
+}
+
+func TestRemoveWorktree_DirtyIsBackedUp(t *testing.T) {
+	dir := testutil.InitTestRepo(t)
+	wtPath := testutil.AddWorktree(t, dir, "dirty")
+	testutil.WriteFile(t, wtPath, "untracked.txt", "x\n")
+
+	rm, err := RemoveWorktree(t.Context(), testRunner, dir, wtPath, RemoveOptions{})
+	if err != nil {
+		t.Fatalf("RemoveWorktree() on dirty worktree error: %v", err)
+	}
+	if !strings.HasPrefix(rm.Backup, "refs/wt-backup/dirty/") {
+		t.Fatalf("backup = %q, want a ref under refs/wt-backup/dirty/", rm.Backup)
+	}
+	if _, err := os.Stat(wtPath); !os.IsNotExist(err) {
+		t.Error("expected dirty worktree directory to be removed")
+	}
+	if out, _ := testRunner.Run(t.Context(), dir, "stash", "list"); out != "" {
+		t.Errorf("stash list = %q, want the backup kept out of the stash", out)
+	}
+
+	runGitHelper(t, dir, "stash", "apply", rm.Backup)
+	if _, err := os.Stat(filepath.Join(dir, "untracked.txt")); err != nil {
+		t.Errorf("expected stash apply to restore the untracked file: %v", err)
+	}
+}
+
+func TestRemoveWorktree_DetachedBackupsDoNotCollide(t *testing.T) {
+	dir := testutil.InitTestRepo(t)
+	var paths []string
+	for _, name := range []string{"d1", "d2"} {
+		wtPath := filepath.Join(t.TempDir(), name)
+		runGitHelper(t, dir, "worktree", "add", "--detach", wtPath)
+		testutil.WriteFile(t, wtPath, name+".txt", name+"\n")
+		paths = append(paths, wtPath)
+	}
+
+	// Both removals usually happen within the same second.
+	var backups []string
+	for _, wtPath := range paths {
+		rm, err := RemoveWorktree(t.Context(), testRunner, dir, wtPath, RemoveOptions{})
+		if err != nil {
+			t.Fatalf("RemoveWorktree(%s) error: %v", wtPath, err)
+		}
+		if !strings.HasPrefix(rm.Backup, "refs/wt-backup/detached-") {
+			t.Errorf("backup = %q, want a ref named after the detached HEAD", rm.Backup)
+		}
+		backups = append(backups, rm.Backup)
+	}
+	if backups[0] == backups[1] {
+		t.Fatalf("both backups use %s", backups[0])
+	}
+	for i, name := range []string{"d1", "d2"} {
+		if files, _ := testRunner.Run(t.Context(), dir, "ls-tree", "-r", "--name-only", backups[i]+"^3"); files != name+".txt" {
+			t.Errorf("backup %s holds %q, want %s.txt", backups[i], files, name)
+		}
+	}
+}
+
+func TestRemoveWorktree_IgnoredFilesAreBackedUp(t *testing.T) {
+	dir := testutil.InitTestRepo(t)
+	testutil.WriteFile(t, dir, ".gitignore", ".env\n")
+	runGitHelper(t, dir, "add", ".gitignore")
+	runGitHelper(t, dir, "commit", "-m", "ignore .env")
+	wtPath := testutil.AddWorktree(t, dir, "secrets")
+	testutil.WriteFile(t, wtPath, ".env", "TOKEN=x\n")
+
+	// git itself would remove the worktree without a word about .env.
+	rm, err := RemoveWorktree(t.Context(), testRunner, dir, wtPath, RemoveOptions{})
+	if err != nil {
+		t.Fatalf("RemoveWorktree() with ignored files error: %v", err)
+	}
+	if !strings.HasPrefix(rm.Backup, "refs/wt-backup/secrets/") {
+		t.Fatalf("backup = %q, want a ref under refs/wt-backup/secrets/", rm.Backup)
+	}
+	if _, err := os.Stat(wtPath); !os.IsNotExist(err) {
+		t.Error("expected the worktree directory to be removed")
+	}
+
+	runGitHelper(t, dir, "worktree", "add", wtPath, "secrets")
+	runGitHelper(t, wtPath, "stash", "apply", rm.Backup)
+	if data, err := os.ReadFile(filepath.Join(wtPath, ".env")); err != nil || string(data) != "TOKEN=x\n" {
+		t.Errorf(".env after stash apply = %q, %v; want it restored", data, err)
+	}
+}
+
+func TestRemoveWorktree_IgnoredFilesRefused(t *testing.T) {
+	dir := testutil.InitTestRepo(t)
+	wtPath := testutil.AddWorktree(t, dir, "secrets")
+	runGitHelper(t, dir, "config", "core.excludesFile", filepath.Join(dir, ".excludes"))
+	testutil.WriteFile(t, dir, ".excludes", ".env\n")
+	testutil.WriteFile(t, wtPath, ".env", "TOKEN=x\n")
+
+	if _, err := RemoveWorktree(t.Context(), testRunner, dir, wtPath, RemoveOptions{Dirty: DirtyRefuse}); ErrorKindOf(err) != KindDirty {
+		t.Fatalf("RemoveWorktree(DirtyRefuse) = %v, want KindDirty", err)
+	}
+	if _, err := os.Stat(filepath.Join(wtPath, ".env")); err != nil {
+		t.Errorf("expected the ignored file to be kept: %v", err)
+	}
+}
+
+func TestRemoveWorktree_DirtyRefused(t *testing.T) {
+	dir := testutil.InitTestRepo(t)
+	wtPath := testutil.AddWorktree(t, dir, "dirty")
+	testutil.WriteFile(t, wtPath, "untracked.txt", "x\n")
+
+	rm, err := RemoveWorktree(t.Context(), testRunner, dir, wtPath, RemoveOptions{Dirty: DirtyRefuse})
+	if ErrorKindOf(err) != KindDirty {
+		t.Fatalf("RemoveWorktree(DirtyRefuse) = %v, want KindDirty", err)
+	}
+	if rm.Backup != "" {
+		t.Errorf("backup = %q, want none", rm.Backup)
+	}
+	if _, err := os.Stat(filepath.Join(wtPath, "untracked.txt")); err != nil {
+		t.Errorf("expected the dirty worktree to be kept: %v", err)
+	}
+}
+
+func TestRemoveWorktree_DirtyDiscarded(t *testing.T) {
+	dir := testutil.InitTestRepo(t)
+	wtPath := testutil.AddWorktree(t, dir, "dirty")
+	testutil.WriteFile(t, wtPath, "untracked.txt", "x\n")
+
+	rm, err := RemoveWorktree(t.Context(), testRunner, dir, wtPath, RemoveOptions{Dirty: DirtyDiscard})
+	if err != nil {
+		t.Fatalf("RemoveWorktree(DirtyDiscard) error: %v", err)
+	}
+	if rm.Backup != "" {
+		t.Errorf("backup = %q, want none", rm.Backup)
+	}
+	if out, _ := testRunner.Run(t.Context(), dir, "for-each-ref", "refs/wt-backup/"); out != "" {
+		t.Errorf("backup refs = %q, want none", out)
+	}
+}
+
+func TestRemoveWorktree_LockedDirtyForcedIsBackedUp(t *testing.T) {
+	dir := testutil.InitTestRepo(t)
+	wtPath := testutil.AddWorktree(t, dir, "locked")
+	testutil.WriteFile(t, wtPath, "untracked.txt", "x\n")
+	runGitHelper(t, dir, "worktree", "lock", wtPath)
+
+	rm, err := RemoveWorktree(t.Context(), testRunner, dir, wtPath, RemoveOptions{Force: true})
+	if err != nil {
+		t.Fatalf("RemoveWorktree(Force) on locked dirty worktree error: %v", err)
+	}
+	if !strings.HasPrefix(rm.Backup, "refs/wt-backup/locked/") {
+		t.Errorf("backup = %q, want a ref under refs/wt-backup/locked/", rm.Backup)
+	}
+}
+
+func TestBackupWorktree_Clean(t *testing.T) {
+	dir := testutil.InitTestRepo(t)
+	wtPath := testutil.AddWorktree(t, dir, "clean")
+
+	backup, err := BackupWorktree(t.Context(), testRunner, wtPath, "clean")
+	if err != nil {
+		t.Fatalf("BackupWorktree() error: %v", err)
+	}
+	if backup != "" {
+		t.Errorf("BackupWorktree() on a clean worktree = %q, want no backup", backup)
+	}
+}
+
+func TestAddWorktree_BranchCheckedOut(t *testing.T) {
+	dir := testutil.InitTestRepo(t)
+	runGitHelper(t, dir, "branch", "-M", "master")
+
+	err := AddWorktree(t.Context(), testRunner, dir, filepath.Join(t.TempDir(), "dup"), "master", "")
+	if ErrorKindOf(err) != KindBranchCheckedOut {
+		t.Fatalf("AddWorktree() for checked-out branch = %v, want KindBranchCheckedOut", err)
+	}
+}
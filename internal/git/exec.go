@@ -2,13 +2,44 @@ package git
 
 import (
 	"bytes"
+	"context"
+	"errors"
 	"fmt"
 	"os/exec"
+	"path/filepath"
 	"strings"
+	"time"
 )
 
-func run(dir string, args ...string) (string, error) {
-	cmd := exec.Command("git", args...)
+// Runner executes git commands. Every function in this package issues its
+// git calls through a Runner, so tests can substitute a scripted fake (see
+// package gittest) for the real executable.
+type Runner interface {
+	// Run executes git with args in dir and returns its trimmed stdout.
+	// Failures are reported as a *GitError.
+	Run(ctx context.Context, dir string, args ...string) (string, error)
+}
+
+// waitDelay bounds how long Run waits for git's output pipes to close after
+// the process has been killed, e.g. when a child process still holds them.
+const waitDelay = time.Second
+
+// ExecRunner is the Runner that executes the git binary.
+type ExecRunner struct {
+	// Timeout limits each individual invocation. Zero means no limit beyond
+	// the caller's context.
+	Timeout time.Duration
+}
+
+func (r *ExecRunner) Run(ctx context.Context, dir string, args ...string) (string, error) {
+	if r.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, r.Timeout)
+		defer cancel()
+	}
+
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.WaitDelay = waitDelay
 	if dir != "" {
 		cmd.Dir = dir
 	}
@@ -17,40 +48,243 @@ func run(dir string, args ...string) (string, error) {
 	cmd.Stderr = &stderr
 
 	if err := cmd.Run(); err != nil {
-		msg := strings.TrimSpace(stderr.String())
-		if msg == "" {
-			msg = err.Error()
+		gitErr := &GitError{
+			Args:     args,
+			ExitCode: -1,
+			Stderr:   strings.TrimSpace(stderr.String()),
+			Err:      err,
+		}
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			gitErr.ExitCode = exitErr.ExitCode()
 		}
-		return "", fmt.Errorf("git %s: %s", strings.Join(args, " "), msg)
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			// The process was killed; its stderr is not meaningful.
+			gitErr.Stderr = ""
+			gitErr.Err = ctxErr
+		}
+		gitErr.Kind = classifyStderr(gitErr.Stderr)
+		return "", gitErr
 	}
 	return strings.TrimSpace(stdout.String()), nil
 }
 
-func RepoRoot(dir string) (string, error) {
-	return run(dir, "rev-parse", "--show-toplevel")
+// RepoRoot returns the root directory of the repository containing dir: the
+// main worktree, or the git dir of a bare repository. It is resolved from
+// the common git dir, so it is the same from the main worktree and from any
+// linked worktree. A bare repository in the bare layout (see CloneBare) is
+// rooted at its container directory.
+func RepoRoot(ctx context.Context, r Runner, dir string) (string, error) {
+	common, err := GitCommonDir(ctx, r, dir)
+	if err != nil {
+		return "", err
+	}
+	if bare, _ := r.Run(ctx, dir, "config", "--bool", "core.bare"); bare == "true" {
+		return BareRoot(common), nil
+	}
+	if filepath.Base(common) == ".git" {
+		return filepath.Dir(common), nil
+	}
+
+	// The git dir is not inside the main worktree, e.g. in a submodule or a
+	// clone with --separate-git-dir. Only from the main worktree itself can
+	// git tell where it is; otherwise it is the first worktree git lists.
+	if gitDir, err := r.Run(ctx, dir, "rev-parse", "--absolute-git-dir"); err == nil && cleanPath(gitDir) == cleanPath(common) {
+		return r.Run(ctx, dir, "rev-parse", "--show-toplevel")
+	}
+	worktrees, err := ListWorktrees(ctx, r, dir)
+	if err != nil {
+		return "", err
+	}
+	return worktrees[0].Path, nil
 }
 
-func DefaultBranch(dir string) (string, error) {
-	// Try origin/HEAD first
-	out, err := run(dir, "symbolic-ref", "refs/remotes/origin/HEAD")
-	if err == nil {
-		return strings.TrimPrefix(out, "refs/remotes/origin/"), nil
+// HeadCommit returns the commit checked out in the worktree containing dir.
+func HeadCommit(ctx context.Context, r Runner, dir string) (string, error) {
+	return r.Run(ctx, dir, "rev-parse", "--verify", "HEAD")
+}
+
+// BareRoot returns the container directory of the bare git dir common if the
+// container has a .git file pointing to it, as in the bare layout, or common
+// itself otherwise.
+func BareRoot(common string) string {
+	container := filepath.Dir(common)
+	if gitDir, err := readGitFile(container); err == nil && cleanPath(gitDir) == cleanPath(common) {
+		return container
+	}
+	return common
+}
+
+// ErrNoDefaultBranch is returned by DefaultBranch when no remote HEAD and no
+// main or master branch exists.
+var ErrNoDefaultBranch = errors.New("cannot determine the default branch")
+
+// Remotes returns the names of the remotes of the repository at dir, with
+// origin first if it exists.
+func Remotes(ctx context.Context, r Runner, dir string) ([]string, error) {
+	out, err := r.Run(ctx, dir, "remote")
+	if err != nil {
+		return nil, err
+	}
+	var remotes []string
+	for _, name := range strings.Split(out, "\n") {
+		switch {
+		case name == "":
+		case name == "origin":
+			remotes = append([]string{name}, remotes...)
+		default:
+			remotes = append(remotes, name)
+		}
+	}
+	return remotes, nil
+}
+
+// DefaultBranch returns the default branch of the repository at dir. It
+// tries the HEAD of each of remotes in order (all remotes, origin first, if
+// remotes is empty), then a local main or master branch, then a main or
+// master branch on one of the remotes. ErrNoDefaultBranch is returned if
+// none of them exists.
+func DefaultBranch(ctx context.Context, r Runner, dir string, remotes []string) (string, error) {
+	if len(remotes) == 0 {
+		remotes, _ = Remotes(ctx, r, dir)
+	}
+	for _, remote := range remotes {
+		prefix := "refs/remotes/" + remote + "/"
+		out, err := r.Run(ctx, dir, "symbolic-ref", prefix+"HEAD")
+		if err == nil && strings.HasPrefix(out, prefix) {
+			return strings.TrimPrefix(out, prefix), nil
+		}
 	}
-	// Fallback: check for main or master
 	for _, name := range []string{"main", "master"} {
-		if _, err := run(dir, "rev-parse", "--verify", "refs/heads/"+name); err == nil {
+		if _, err := r.Run(ctx, dir, "rev-parse", "--verify", "--quiet", "refs/heads/"+name); err == nil {
 			return name, nil
 		}
 	}
-	return "main", nil
+	for _, remote := range remotes {
+		for _, name := range []string{"main", "master"} {
+			if _, ok := RemoteTrackingRef(ctx, r, dir, remote, name); ok {
+				return name, nil
+			}
+		}
+	}
+	return "", ErrNoDefaultBranch
 }
 
-func BranchExists(dir, branch string) bool {
-	_, err := run(dir, "rev-parse", "--verify", "refs/heads/"+branch)
+// RemoteTrackingRef returns the short name of the remote-tracking ref of
+// branch on remote, e.g. "origin/main", if it exists.
+func RemoteTrackingRef(ctx context.Context, r Runner, dir, remote, branch string) (string, bool) {
+	ref := remote + "/" + branch
+	_, err := r.Run(ctx, dir, "rev-parse", "--verify", "--quiet", "refs/remotes/"+ref)
+	return ref, err == nil
+}
+
+// ExpandRefPatterns resolves patterns such as "release/*" to the short names
+// of the local and remote-tracking branches they match, keeping the order of
+// patterns. Patterns without glob characters are returned as is.
+func ExpandRefPatterns(ctx context.Context, r Runner, dir string, patterns []string) ([]string, error) {
+	var refs []string
+	seen := make(map[string]bool)
+	add := func(ref string) {
+		if !seen[ref] {
+			seen[ref] = true
+			refs = append(refs, ref)
+		}
+	}
+	for _, p := range patterns {
+		if !strings.ContainsAny(p, "*?[") {
+			add(p)
+			continue
+		}
+		out, err := r.Run(ctx, dir, "for-each-ref", "--format=%(refname:lstrip=2)", "refs/heads/"+p, "refs/remotes/"+p)
+		if err != nil {
+			return nil, err
+		}
+		for _, ref := range strings.Split(out, "\n") {
+			if ref != "" {
+				add(ref)
+			}
+		}
+	}
+	return refs, nil
+}
+
+func BranchExists(ctx context.Context, r Runner, dir, branch string) bool {
+	_, err := r.Run(ctx, dir, "rev-parse", "--verify", "refs/heads/"+branch)
+	return err == nil
+}
+
+// IsTracked reports whether path, relative to the worktree at dir, is
+// tracked in its index.
+func IsTracked(ctx context.Context, r Runner, dir, path string) bool {
+	_, err := r.Run(ctx, dir, "ls-files", "--error-unmatch", "--", path)
 	return err == nil
 }
 
-func IsInsideWorktree(dir string) bool {
-	out, err := run(dir, "rev-parse", "--is-inside-work-tree")
+func IsInsideWorktree(ctx context.Context, r Runner, dir string) bool {
+	out, err := r.Run(ctx, dir, "rev-parse", "--is-inside-work-tree")
 	return err == nil && out == "true"
 }
+
+// CreateBranch creates branch at start. With track, it tracks start, which
+// is usually a remote-tracking branch such as "origin/feature"; without, no
+// upstream is configured.
+func CreateBranch(ctx context.Context, r Runner, dir, branch, start string, track bool) error {
+	flag := "--no-track"
+	if track {
+		flag = "--track"
+	}
+	_, err := r.Run(ctx, dir, "branch", flag, branch, start)
+	return err
+}
+
+// DeleteBranch deletes branch with `git branch -D`.
+func DeleteBranch(ctx context.Context, r Runner, dir, branch string) error {
+	_, err := r.Run(ctx, dir, "branch", "-D", branch)
+	return err
+}
+
+// Fetch fetches remote.
+func Fetch(ctx context.Context, r Runner, dir, remote string) error {
+	_, err := r.Run(ctx, dir, "fetch", remote)
+	return err
+}
+
+// Divergence counts the commits on a that are not on b (ahead) and those on
+// b that are not on a (behind).
+func Divergence(ctx context.Context, r Runner, dir, a, b string) (ahead, behind int, err error) {
+	out, err := r.Run(ctx, dir, "rev-list", "--left-right", "--count", a+"..."+b)
+	if err != nil {
+		return 0, 0, err
+	}
+	if _, err := fmt.Sscanf(out, "%d %d", &ahead, &behind); err != nil {
+		return 0, 0, fmt.Errorf("unexpected rev-list output %q", out)
+	}
+	return ahead, behind, nil
+}
+
+// RenameBranch renames branch oldName to newName with `git branch -m`. Git
+// moves the branch's configuration along and updates any worktree that has
+// it checked out.
+func RenameBranch(ctx context.Context, r Runner, dir, oldName, newName string) error {
+	_, err := r.Run(ctx, dir, "branch", "-m", oldName, newName)
+	return err
+}
+
+// BranchUpstream returns the remote and merge ref configured for branch.
+// Both are empty if the branch has no upstream.
+func BranchUpstream(ctx context.Context, r Runner, dir, branch string) (remote, merge string) {
+	remote, _ = r.Run(ctx, dir, "config", "--get", "branch."+branch+".remote")
+	merge, _ = r.Run(ctx, dir, "config", "--get", "branch."+branch+".merge")
+	return remote, merge
+}
+
+// SetBranchUpstream configures branch to track merge on remote. Unlike
+// `git branch --set-upstream-to`, the remote branch does not have to exist
+// yet.
+func SetBranchUpstream(ctx context.Context, r Runner, dir, branch, remote, merge string) error {
+	if _, err := r.Run(ctx, dir, "config", "branch."+branch+".remote", remote); err != nil {
+		return err
+	}
+	_, err := r.Run(ctx, dir, "config", "branch."+branch+".merge", merge)
+	return err
+}
@@ -1,14 +1,21 @@
 package git
 
 import (
+	"context"
+	"errors"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"slices"
 	"testing"
+	"time"
 
 	"github.com/yasomaru/git-wt/testutil"
 )
 
+// testRunner runs the real git binary for tests that use temporary repos.
+var testRunner = &ExecRunner{}
+
 func TestRepoRoot(t *testing.T) {
 	t.Parallel()
 
@@ -16,7 +23,7 @@ func TestRepoRoot(t *testing.T) {
 		t.Parallel()
 		dir := testutil.InitTestRepo(t)
 
-		root, err := RepoRoot(dir)
+		root, err := RepoRoot(t.Context(), testRunner, dir)
 		if err != nil {
 			t.Fatalf("RepoRoot(%q) returned unexpected error: %v", dir, err)
 		}
@@ -46,7 +53,7 @@ func TestRepoRoot(t *testing.T) {
 			t.Fatalf("MkdirAll(%q): %v", subdir, err)
 		}
 
-		root, err := RepoRoot(subdir)
+		root, err := RepoRoot(t.Context(), testRunner, subdir)
 		if err != nil {
 			t.Fatalf("RepoRoot(%q) returned unexpected error: %v", subdir, err)
 		}
@@ -59,11 +66,42 @@ func TestRepoRoot(t *testing.T) {
 		}
 	})
 
+	t.Run("linked worktree returns main worktree", func(t *testing.T) {
+		t.Parallel()
+		dir := testutil.InitTestRepo(t)
+		nested := filepath.Join(dir, ".worktrees", "feature")
+		runGitHelper(t, dir, "worktree", "add", "-b", "feature", nested)
+
+		for _, from := range []string{nested, testutil.AddWorktree(t, dir, "other")} {
+			root, err := RepoRoot(t.Context(), testRunner, from)
+			if err != nil {
+				t.Fatalf("RepoRoot(%q) returned unexpected error: %v", from, err)
+			}
+			if cleanPath(root) != cleanPath(dir) {
+				t.Errorf("RepoRoot(%q) = %q, want %q", from, root, dir)
+			}
+		}
+	})
+
+	t.Run("separate git dir returns main worktree", func(t *testing.T) {
+		t.Parallel()
+		dir := t.TempDir()
+		runGitHelper(t, dir, "init", "--separate-git-dir", filepath.Join(t.TempDir(), "repo.git"))
+
+		root, err := RepoRoot(t.Context(), testRunner, dir)
+		if err != nil {
+			t.Fatalf("RepoRoot(%q) returned unexpected error: %v", dir, err)
+		}
+		if cleanPath(root) != cleanPath(dir) {
+			t.Errorf("RepoRoot(%q) = %q, want %q", dir, root, dir)
+		}
+	})
+
 	t.Run("non-repo directory returns error", func(t *testing.T) {
 		t.Parallel()
 		dir := t.TempDir() // plain directory, no git init
 
-		_, err := RepoRoot(dir)
+		_, err := RepoRoot(t.Context(), testRunner, dir)
 		if err == nil {
 			t.Fatalf("RepoRoot(%q) expected error for non-repo directory, got nil", dir)
 		}
@@ -81,7 +119,7 @@ func TestDefaultBranch(t *testing.T) {
 		// Rename it to master explicitly so the test is deterministic.
 		runGitHelper(t, dir, "branch", "-M", "master")
 
-		got, err := DefaultBranch(dir)
+		got, err := DefaultBranch(t.Context(), testRunner, dir, nil)
 		if err != nil {
 			t.Fatalf("DefaultBranch(%q) returned unexpected error: %v", dir, err)
 		}
@@ -97,7 +135,7 @@ func TestDefaultBranch(t *testing.T) {
 		// Rename the default branch to main so the lookup finds it.
 		runGitHelper(t, dir, "branch", "-M", "main")
 
-		got, err := DefaultBranch(dir)
+		got, err := DefaultBranch(t.Context(), testRunner, dir, nil)
 		if err != nil {
 			t.Fatalf("DefaultBranch(%q) returned unexpected error: %v", dir, err)
 		}
@@ -106,19 +144,49 @@ func TestDefaultBranch(t *testing.T) {
 		}
 	})
 
-	t.Run("falls back to main when neither main nor master exists", func(t *testing.T) {
+	t.Run("fails when neither main nor master exists", func(t *testing.T) {
 		t.Parallel()
 		dir := testutil.InitTestRepo(t)
 
 		// Rename the default branch to something else entirely.
 		runGitHelper(t, dir, "branch", "-M", "develop")
 
-		got, err := DefaultBranch(dir)
+		got, err := DefaultBranch(t.Context(), testRunner, dir, nil)
+		if !errors.Is(err, ErrNoDefaultBranch) {
+			t.Errorf("DefaultBranch(%q) = %q, %v, want ErrNoDefaultBranch", dir, got, err)
+		}
+	})
+
+	t.Run("uses the HEAD of the first configured remote", func(t *testing.T) {
+		t.Parallel()
+		dir := testutil.InitTestRepo(t)
+		runGitHelper(t, dir, "branch", "-M", "develop")
+		runGitHelper(t, dir, "update-ref", "refs/remotes/origin/trunk", "HEAD")
+		runGitHelper(t, dir, "symbolic-ref", "refs/remotes/origin/HEAD", "refs/remotes/origin/trunk")
+		runGitHelper(t, dir, "update-ref", "refs/remotes/upstream/develop", "HEAD")
+		runGitHelper(t, dir, "symbolic-ref", "refs/remotes/upstream/HEAD", "refs/remotes/upstream/develop")
+
+		got, err := DefaultBranch(t.Context(), testRunner, dir, []string{"upstream", "origin"})
+		if err != nil {
+			t.Fatalf("DefaultBranch(%q) returned unexpected error: %v", dir, err)
+		}
+		if got != "develop" {
+			t.Errorf("DefaultBranch(%q) = %q, want %q from upstream/HEAD", dir, got, "develop")
+		}
+	})
+
+	t.Run("falls back to a main branch on a remote", func(t *testing.T) {
+		t.Parallel()
+		dir := testutil.InitTestRepo(t)
+		runGitHelper(t, dir, "branch", "-M", "feature")
+		runGitHelper(t, dir, "update-ref", "refs/remotes/upstream/main", "HEAD")
+
+		got, err := DefaultBranch(t.Context(), testRunner, dir, []string{"upstream"})
 		if err != nil {
 			t.Fatalf("DefaultBranch(%q) returned unexpected error: %v", dir, err)
 		}
 		if got != "main" {
-			t.Errorf("DefaultBranch(%q) = %q, want fallback %q", dir, got, "main")
+			t.Errorf("DefaultBranch(%q) = %q, want %q", dir, got, "main")
 		}
 	})
 
@@ -130,7 +198,7 @@ func TestDefaultBranch(t *testing.T) {
 		runGitHelper(t, dir, "branch", "-M", "main")
 		testutil.CreateBranch(t, dir, "master")
 
-		got, err := DefaultBranch(dir)
+		got, err := DefaultBranch(t.Context(), testRunner, dir, nil)
 		if err != nil {
 			t.Fatalf("DefaultBranch(%q) returned unexpected error: %v", dir, err)
 		}
@@ -141,6 +209,22 @@ func TestDefaultBranch(t *testing.T) {
 	})
 }
 
+func TestRemotes(t *testing.T) {
+	t.Parallel()
+	dir := testutil.InitTestRepo(t)
+	for _, name := range []string{"fork", "origin", "upstream"} {
+		runGitHelper(t, dir, "remote", "add", name, dir)
+	}
+
+	got, err := Remotes(t.Context(), testRunner, dir)
+	if err != nil {
+		t.Fatalf("Remotes() error: %v", err)
+	}
+	if want := []string{"origin", "fork", "upstream"}; !slices.Equal(got, want) {
+		t.Errorf("Remotes() = %v, want %v", got, want)
+	}
+}
+
 func TestBranchExists(t *testing.T) {
 	t.Parallel()
 
@@ -182,7 +266,7 @@ func TestBranchExists(t *testing.T) {
 				tc.setupFunc(t, dir)
 			}
 
-			got := BranchExists(dir, tc.branch)
+			got := BranchExists(t.Context(), testRunner, dir, tc.branch)
 			if got != tc.wantExists {
 				t.Errorf("BranchExists(%q, %q) = %v, want %v", dir, tc.branch, got, tc.wantExists)
 			}
@@ -190,6 +274,111 @@ func TestBranchExists(t *testing.T) {
 	}
 }
 
+func TestRemoteTrackingRef(t *testing.T) {
+	t.Parallel()
+	dir := testutil.InitTestRepo(t)
+	runGitHelper(t, dir, "update-ref", "refs/remotes/origin/master", "HEAD")
+
+	if ref, ok := RemoteTrackingRef(t.Context(), testRunner, dir, "origin", "master"); !ok || ref != "origin/master" {
+		t.Errorf("RemoteTrackingRef(origin, master) = %q, %v, want origin/master, true", ref, ok)
+	}
+	if _, ok := RemoteTrackingRef(t.Context(), testRunner, dir, "upstream", "master"); ok {
+		t.Error("RemoteTrackingRef(upstream, master) = true, want false")
+	}
+}
+
+func TestExpandRefPatterns(t *testing.T) {
+	t.Parallel()
+	dir := testutil.InitTestRepo(t)
+	testutil.CreateBranch(t, dir, "release/1.0")
+	testutil.CreateBranch(t, dir, "release/2.0")
+	runGitHelper(t, dir, "update-ref", "refs/remotes/origin/release/3.0", "HEAD")
+
+	got, err := ExpandRefPatterns(t.Context(), testRunner, dir, []string{"master", "release/*", "origin/release/*", "release/1.0"})
+	if err != nil {
+		t.Fatalf("ExpandRefPatterns() error: %v", err)
+	}
+	want := []string{"master", "release/1.0", "release/2.0", "origin/release/3.0"}
+	if !slices.Equal(got, want) {
+		t.Errorf("ExpandRefPatterns() = %v, want %v", got, want)
+	}
+}
+
+func TestRenameBranchKeepsUpstream(t *testing.T) {
+	t.Parallel()
+	dir := testutil.InitTestRepo(t)
+	testutil.CreateBranch(t, dir, "old-name")
+
+	if err := SetBranchUpstream(t.Context(), testRunner, dir, "old-name", "origin", "refs/heads/old-name"); err != nil {
+		t.Fatalf("SetBranchUpstream() error: %v", err)
+	}
+	if err := RenameBranch(t.Context(), testRunner, dir, "old-name", "new-name"); err != nil {
+		t.Fatalf("RenameBranch() error: %v", err)
+	}
+	if BranchExists(t.Context(), testRunner, dir, "old-name") || !BranchExists(t.Context(), testRunner, dir, "new-name") {
+		t.Fatal("expected old-name to be renamed to new-name")
+	}
+
+	remote, merge := BranchUpstream(t.Context(), testRunner, dir, "new-name")
+	if remote != "origin" || merge != "refs/heads/old-name" {
+		t.Errorf("BranchUpstream() = %q, %q; want the upstream carried over", remote, merge)
+	}
+	if remote, merge := BranchUpstream(t.Context(), testRunner, dir, "master"); remote != "" || merge != "" {
+		t.Errorf("BranchUpstream() without upstream = %q, %q; want empty", remote, merge)
+	}
+}
+
+func TestCreateBranch(t *testing.T) {
+	t.Parallel()
+	remote := testutil.InitTestRepo(t)
+	testutil.CreateBranch(t, remote, "feature")
+	dir := testutil.InitTestRepo(t)
+	runGitHelper(t, dir, "remote", "add", "origin", remote)
+	runGitHelper(t, dir, "fetch", "origin")
+
+	if err := CreateBranch(t.Context(), testRunner, dir, "feature", "origin/feature", true); err != nil {
+		t.Fatalf("CreateBranch() error: %v", err)
+	}
+	if remote, merge := BranchUpstream(t.Context(), testRunner, dir, "feature"); remote != "origin" || merge != "refs/heads/feature" {
+		t.Errorf("BranchUpstream() = %q, %q; want origin refs/heads/feature", remote, merge)
+	}
+
+	if err := CreateBranch(t.Context(), testRunner, dir, "copy", "origin/feature", false); err != nil {
+		t.Fatalf("CreateBranch() without tracking error: %v", err)
+	}
+	if remote, merge := BranchUpstream(t.Context(), testRunner, dir, "copy"); remote != "" || merge != "" {
+		t.Errorf("BranchUpstream() = %q, %q; want no upstream", remote, merge)
+	}
+
+	if err := DeleteBranch(t.Context(), testRunner, dir, "copy"); err != nil {
+		t.Fatalf("DeleteBranch() error: %v", err)
+	}
+	if BranchExists(t.Context(), testRunner, dir, "copy") {
+		t.Error("expected copy to be deleted")
+	}
+}
+
+func TestDivergence(t *testing.T) {
+	t.Parallel()
+	dir := testutil.InitTestRepo(t)
+	testutil.CreateBranch(t, dir, "other")
+	testutil.MakeCommit(t, dir, "local")
+	runGitHelper(t, dir, "checkout", "other")
+	testutil.MakeCommit(t, dir, "other-1")
+	testutil.MakeCommit(t, dir, "other-2")
+
+	ahead, behind, err := Divergence(t.Context(), testRunner, dir, "master", "other")
+	if err != nil {
+		t.Fatalf("Divergence() error: %v", err)
+	}
+	if ahead != 1 || behind != 2 {
+		t.Errorf("Divergence() = %d, %d; want 1, 2", ahead, behind)
+	}
+	if _, _, err := Divergence(t.Context(), testRunner, dir, "master", "missing"); err == nil {
+		t.Error("Divergence() with a missing ref succeeded, want an error")
+	}
+}
+
 func TestIsInsideWorktree(t *testing.T) {
 	t.Parallel()
 
@@ -227,7 +416,7 @@ func TestIsInsideWorktree(t *testing.T) {
 			t.Parallel()
 			dir := tc.dir(t)
 
-			got := IsInsideWorktree(dir)
+			got := IsInsideWorktree(t.Context(), testRunner, dir)
 			if got != tc.want {
 				t.Errorf("IsInsideWorktree(%q) = %v, want %v", dir, got, tc.want)
 			}
@@ -235,6 +424,35 @@ func TestIsInsideWorktree(t *testing.T) {
 	}
 }
 
+func TestExecRunner_ContextCancelled(t *testing.T) {
+	t.Parallel()
+	dir := testutil.InitTestRepo(t)
+
+	ctx, cancel := context.WithCancel(t.Context())
+	cancel()
+
+	_, err := testRunner.Run(ctx, dir, "status")
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("testRunner.Run() with cancelled context = %v, want context.Canceled", err)
+	}
+}
+
+func TestExecRunner_Timeout(t *testing.T) {
+	t.Parallel()
+	dir := testutil.InitTestRepo(t)
+
+	r := &ExecRunner{Timeout: time.Nanosecond}
+	_, err := r.Run(t.Context(), dir, "status")
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Run() with 1ns timeout = %v, want context.DeadlineExceeded", err)
+	}
+
+	r.Timeout = 0
+	if _, err := r.Run(t.Context(), dir, "status"); err != nil {
+		t.Errorf("Run() without timeout returned error: %v", err)
+	}
+}
+
 // runGitHelper executes a git command in the given directory, failing the test on error.
 func runGitHelper(t *testing.T, dir string, args ...string) {
 	t.Helper()
@@ -0,0 +1,109 @@
+// Package gittest provides a scripted git.Runner for tests.
+package gittest
+
+import (
+	"context"
+	"strings"
+	"sync"
+
+	"github.com/yasomaru/git-wt/internal/git"
+)
+
+// Call records a single invocation of a FakeRunner.
+type Call struct {
+	Dir  string
+	Args []string
+}
+
+// String returns the arguments joined by spaces, e.g. "worktree list".
+func (c Call) String() string {
+	return strings.Join(c.Args, " ")
+}
+
+// HandlerFunc computes the result of a git invocation.
+type HandlerFunc func(ctx context.Context, dir string, args ...string) (string, error)
+
+// FakeRunner is a git.Runner that replays scripted results and records every
+// invocation. It is safe for concurrent use.
+type FakeRunner struct {
+	mu       sync.Mutex
+	handlers map[string]HandlerFunc
+	calls    []Call
+}
+
+var _ git.Runner = (*FakeRunner)(nil)
+
+// NewFakeRunner returns a FakeRunner without any scripted commands.
+func NewFakeRunner() *FakeRunner {
+	return &FakeRunner{handlers: make(map[string]HandlerFunc)}
+}
+
+// Stub makes invocations whose space-joined arguments equal command return
+// out and err. Stubbing the same command again replaces the previous result.
+func (f *FakeRunner) Stub(command, out string, err error) {
+	f.Handle(command, func(context.Context, string, ...string) (string, error) {
+		return out, err
+	})
+}
+
+// Handle makes invocations whose space-joined arguments equal command return
+// the result of fn.
+func (f *FakeRunner) Handle(command string, fn HandlerFunc) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.handlers[command] = fn
+}
+
+// Run implements git.Runner. Commands that were not scripted fail with a
+// *git.GitError of kind KindUnknown.
+func (f *FakeRunner) Run(ctx context.Context, dir string, args ...string) (string, error) {
+	call := Call{Dir: dir, Args: append([]string(nil), args...)}
+
+	f.mu.Lock()
+	f.calls = append(f.calls, call)
+	fn, ok := f.handlers[call.String()]
+	f.mu.Unlock()
+
+	if !ok {
+		return "", Fail(git.KindUnknown, "gittest: unexpected command: git "+call.String(), args...)
+	}
+	return fn(ctx, dir, args...)
+}
+
+// Calls returns the invocations recorded so far in call order.
+func (f *FakeRunner) Calls() []Call {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]Call(nil), f.calls...)
+}
+
+// Called reports whether command was invoked at least once.
+func (f *FakeRunner) Called(command string) bool {
+	for _, c := range f.Calls() {
+		if c.String() == command {
+			return true
+		}
+	}
+	return false
+}
+
+// Fail builds the *git.GitError a real git invocation with args would return
+// when it exits with status 128 and prints stderr.
+func Fail(kind git.ErrorKind, stderr string, args ...string) error {
+	return &git.GitError{
+		Args:     args,
+		ExitCode: 128,
+		Stderr:   stderr,
+		Kind:     kind,
+	}
+}
+
+// Timeout builds the *git.GitError returned when an invocation with args
+// exceeded its deadline.
+func Timeout(args ...string) error {
+	return &git.GitError{
+		Args:     args,
+		ExitCode: -1,
+		Err:      context.DeadlineExceeded,
+	}
+}
@@ -0,0 +1,42 @@
+package gittest
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/yasomaru/git-wt/internal/git"
+)
+
+func TestFakeRunner_Stub(t *testing.T) {
+	f := NewFakeRunner()
+	f.Stub("rev-parse --show-toplevel", "/repo", nil)
+
+	out, err := f.Run(t.Context(), "", "rev-parse", "--show-toplevel")
+	if err != nil || out != "/repo" {
+		t.Fatalf("Run() = %q, %v, want %q, nil", out, err, "/repo")
+	}
+	if !f.Called("rev-parse --show-toplevel") {
+		t.Error("expected call to be recorded")
+	}
+}
+
+func TestFakeRunner_UnexpectedCommand(t *testing.T) {
+	f := NewFakeRunner()
+
+	_, err := f.Run(t.Context(), "/repo", "fetch")
+	var gitErr *git.GitError
+	if !errors.As(err, &gitErr) {
+		t.Fatalf("expected *git.GitError, got %T: %v", err, err)
+	}
+	if len(f.Calls()) != 1 {
+		t.Errorf("expected 1 recorded call, got %d", len(f.Calls()))
+	}
+}
+
+func TestTimeout(t *testing.T) {
+	err := Timeout("status")
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Timeout() = %v, want wrapped context.DeadlineExceeded", err)
+	}
+}
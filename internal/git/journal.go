@@ -0,0 +1,170 @@
+package git
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// removalJournal is the file, relative to the git common dir, in which
+// removed worktrees are recorded as JSON lines, oldest first.
+const removalJournal = "git-wt/removals.jsonl"
+
+// RemovalJournalPath returns the path of the removal journal of the
+// repository at dir. It lives in the common dir so that every worktree of
+// the repository sees the same journal.
+func RemovalJournalPath(ctx context.Context, r Runner, dir string) (string, error) {
+	common, err := GitCommonDir(ctx, r, dir)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(common, removalJournal), nil
+}
+
+// RecordRemoval appends rm to the removal journal of the repository at dir.
+func RecordRemoval(ctx context.Context, r Runner, dir string, rm Removal) error {
+	path, err := RemovalJournalPath(ctx, r, dir)
+	if err != nil {
+		return err
+	}
+	return appendJSONLine(path, rm)
+}
+
+// Removals returns the removals recorded in the journal of the repository at
+// dir, oldest first. A missing journal has no entries.
+func Removals(ctx context.Context, r Runner, dir string) ([]Removal, error) {
+	path, err := RemovalJournalPath(ctx, r, dir)
+	if err != nil {
+		return nil, err
+	}
+	return readJSONLines[Removal](path)
+}
+
+// ForgetRemoval drops rm from the removal journal of the repository at dir,
+// typically after it was restored. Entries are identified by path and time
+// of removal.
+func ForgetRemoval(ctx context.Context, r Runner, dir string, rm Removal) error {
+	removals, err := Removals(ctx, r, dir)
+	if err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	for _, other := range removals {
+		if other.Path == rm.Path && other.RemovedAt.Equal(rm.RemovedAt) {
+			continue
+		}
+		line, err := json.Marshal(other)
+		if err != nil {
+			return err
+		}
+		buf.Write(append(line, '\n'))
+	}
+
+	path, err := RemovalJournalPath(ctx, r, dir)
+	if err != nil {
+		return err
+	}
+	// Replace the journal atomically so an interrupted write cannot lose
+	// the other entries.
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, buf.Bytes(), 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// RestoreWorktree recreates the worktree described by rm: the deleted branch
+// is recreated at its old tip, the worktree is added at its old path, backed
+// up local changes are applied and the lock is restored. If the worktree
+// cannot be added, a recreated branch is deleted again.
+func RestoreWorktree(ctx context.Context, r Runner, repoDir string, rm Removal) error {
+	if _, err := os.Stat(rm.Path); err == nil {
+		return fmt.Errorf("path already exists: %s", rm.Path)
+	}
+	if err := os.MkdirAll(filepath.Dir(rm.Path), 0o755); err != nil {
+		return err
+	}
+
+	if rm.BranchTip != "" {
+		if _, err := r.Run(ctx, repoDir, "branch", rm.Branch, rm.BranchTip); err != nil {
+			return err
+		}
+	}
+
+	args := []string{"worktree", "add", rm.Path, rm.Branch}
+	if rm.Branch == "" {
+		args = []string{"worktree", "add", "--detach", rm.Path, rm.Head}
+	}
+	if _, err := r.Run(ctx, repoDir, args...); err != nil {
+		if rm.BranchTip != "" {
+			_, _ = r.Run(context.WithoutCancel(ctx), repoDir, "branch", "-D", rm.Branch)
+		}
+		return err
+	}
+
+	if rm.Backup != "" {
+		if _, err := r.Run(ctx, rm.Path, "stash", "apply", "--index", rm.Backup); err != nil {
+			return fmt.Errorf("worktree restored, but applying %s failed: %w", rm.Backup, err)
+		}
+	}
+	if rm.Locked {
+		if err := LockWorktree(ctx, r, repoDir, rm.Path, rm.LockReason); err != nil {
+			return fmt.Errorf("worktree restored, but locking it failed: %w", err)
+		}
+	}
+	return nil
+}
+
+// appendJSONLine appends v as a single JSON line to the file at path,
+// creating the file and its directory if needed.
+func appendJSONLine(path string, v any) error {
+	line, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// readJSONLines decodes every non-empty line of the file at path. A missing
+// file has no entries.
+func readJSONLines[T any](path string) ([]T, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []T
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(nil, 1024*1024)
+	for n := 1; scanner.Scan(); n++ {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		var entry T
+		if err := json.Unmarshal(line, &entry); err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, n, err)
+		}
+		entries = append(entries, entry)
+	}
+	return entries, scanner.Err()
+}
@@ -0,0 +1,114 @@
+package git
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/yasomaru/git-wt/testutil"
+)
+
+func TestRemovalJournal_RecordAndForget(t *testing.T) {
+	dir := testutil.InitTestRepo(t)
+
+	removals, err := Removals(t.Context(), testRunner, dir)
+	if err != nil || len(removals) != 0 {
+		t.Fatalf("Removals() on a new repo = %v, %v; want none", removals, err)
+	}
+
+	first := Removal{Path: "/tmp/a", Branch: "a", Head: "1111", RemovedAt: time.Unix(1700000000, 0)}
+	second := Removal{Path: "/tmp/b", Branch: "b", Head: "2222", Backup: "refs/wt-backup/b/1", RemovedAt: time.Unix(1700000100, 0)}
+	for _, rm := range []Removal{first, second} {
+		if err := RecordRemoval(t.Context(), testRunner, dir, rm); err != nil {
+			t.Fatalf("RecordRemoval() error: %v", err)
+		}
+	}
+
+	path, err := RemovalJournalPath(t.Context(), testRunner, dir)
+	if err != nil {
+		t.Fatalf("RemovalJournalPath() error: %v", err)
+	}
+	if !strings.HasPrefix(path, realAbs(t, filepath.Join(dir, ".git"))) {
+		t.Errorf("journal path = %q, want it inside the git dir", path)
+	}
+
+	removals, err = Removals(t.Context(), testRunner, dir)
+	if err != nil {
+		t.Fatalf("Removals() error: %v", err)
+	}
+	if len(removals) != 2 || removals[0].Branch != "a" || removals[1].Backup != second.Backup {
+		t.Fatalf("Removals() = %+v, want [a b] in order", removals)
+	}
+
+	if err := ForgetRemoval(t.Context(), testRunner, dir, first); err != nil {
+		t.Fatalf("ForgetRemoval() error: %v", err)
+	}
+	removals, _ = Removals(t.Context(), testRunner, dir)
+	if len(removals) != 1 || removals[0].Branch != "b" {
+		t.Errorf("Removals() after forget = %+v, want only b", removals)
+	}
+}
+
+func TestRemovalJournal_SharedByWorktrees(t *testing.T) {
+	dir := testutil.InitTestRepo(t)
+	wtPath := testutil.AddWorktree(t, dir, "feature")
+
+	if err := RecordRemoval(t.Context(), testRunner, wtPath, Removal{Path: "/tmp/x", Branch: "x"}); err != nil {
+		t.Fatalf("RecordRemoval() error: %v", err)
+	}
+	removals, err := Removals(t.Context(), testRunner, dir)
+	if err != nil || len(removals) != 1 {
+		t.Errorf("Removals() from the main worktree = %v, %v; want the entry recorded in the linked one", removals, err)
+	}
+}
+
+func TestRestoreWorktree_RoundTrip(t *testing.T) {
+	dir := testutil.InitTestRepo(t)
+	wtPath := testutil.AddWorktree(t, dir, "feature")
+	testutil.MakeCommit(t, wtPath, "feature work")
+	testutil.WriteFile(t, wtPath, "notes.txt", "local only\n")
+	runGitHelper(t, dir, "worktree", "lock", "--reason", "usb drive", wtPath)
+	wtPath = realAbs(t, wtPath)
+
+	rm, err := RemoveWorktree(t.Context(), testRunner, dir, wtPath, RemoveOptions{DeleteBranch: true, ForceDeleteBranch: true, Force: true})
+	if err != nil {
+		t.Fatalf("RemoveWorktree() error: %v", err)
+	}
+	if rm.Branch != "feature" || rm.BranchTip == "" || rm.Backup == "" || !rm.Locked || rm.LockReason != "usb drive" {
+		t.Fatalf("Removal = %+v, want branch, tip, backup and lock recorded", rm)
+	}
+	if BranchExists(t.Context(), testRunner, dir, "feature") {
+		t.Fatal("expected branch 'feature' to be deleted")
+	}
+
+	if err := RestoreWorktree(t.Context(), testRunner, dir, rm); err != nil {
+		t.Fatalf("RestoreWorktree() error: %v", err)
+	}
+	if head, _ := testRunner.Run(t.Context(), wtPath, "rev-parse", "HEAD"); head != rm.BranchTip {
+		t.Errorf("restored HEAD = %q, want %q", head, rm.BranchTip)
+	}
+	if data, err := os.ReadFile(filepath.Join(wtPath, "notes.txt")); err != nil || string(data) != "local only\n" {
+		t.Errorf("notes.txt = %q (%v), want the backed up content", data, err)
+	}
+	worktrees, err := ListWorktrees(t.Context(), testRunner, dir)
+	if err != nil {
+		t.Fatalf("ListWorktrees() error: %v", err)
+	}
+	for _, wt := range worktrees {
+		if wt.BranchShort() == "feature" && (!wt.IsLocked || wt.LockReason != "usb drive") {
+			t.Errorf("restored worktree lock = %v %q, want locked with reason", wt.IsLocked, wt.LockReason)
+		}
+	}
+	runGitHelper(t, dir, "worktree", "unlock", wtPath)
+}
+
+func TestRestoreWorktree_PathExists(t *testing.T) {
+	dir := testutil.InitTestRepo(t)
+
+	rm := Removal{Path: t.TempDir(), Branch: "feature", Head: "1111"}
+	if err := RestoreWorktree(t.Context(), testRunner, dir, rm); err == nil {
+		t.Fatal("RestoreWorktree() onto an existing path succeeded, want an error")
+	}
+}
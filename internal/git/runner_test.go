@@ -0,0 +1,269 @@
+package git_test
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/yasomaru/git-wt/internal/git"
+	"github.com/yasomaru/git-wt/internal/git/gittest"
+)
+
+func TestListWorktrees_FakeRunner(t *testing.T) {
+	fake := gittest.NewFakeRunner()
+	fake.Stub("worktree list --porcelain -z", strings.Join([]string{
+		"worktree /repo",
+		"HEAD 1111111111111111111111111111111111111111",
+		"branch refs/heads/main",
+		"",
+		"worktree /repo-detached",
+		"HEAD 2222222222222222222222222222222222222222",
+		"detached",
+		"locked on usb drive",
+		"",
+		"worktree /repo.git",
+		"bare",
+		"unexpected-attribute with value",
+		"",
+	}, "\x00"), nil)
+
+	worktrees, err := git.ListWorktrees(t.Context(), fake, "/repo")
+	if err != nil {
+		t.Fatalf("ListWorktrees() error: %v", err)
+	}
+	if len(worktrees) != 3 {
+		t.Fatalf("expected 3 worktrees, got %d", len(worktrees))
+	}
+	if worktrees[0].BranchShort() != "main" {
+		t.Errorf("worktrees[0].BranchShort() = %q, want %q", worktrees[0].BranchShort(), "main")
+	}
+	if !worktrees[1].IsDetached {
+		t.Error("expected worktrees[1] to be detached")
+	}
+	if !worktrees[1].IsLocked || worktrees[1].LockReason != "on usb drive" {
+		t.Errorf("worktrees[1] lock = %v %q, want true %q", worktrees[1].IsLocked, worktrees[1].LockReason, "on usb drive")
+	}
+	if !worktrees[2].IsBare {
+		t.Error("expected worktrees[2] to be bare")
+	}
+
+	calls := fake.Calls()
+	if len(calls) != 1 || calls[0].Dir != "/repo" {
+		t.Errorf("unexpected calls: %v", calls)
+	}
+}
+
+func TestListWorktrees_FallbackWithoutNUL(t *testing.T) {
+	fake := gittest.NewFakeRunner()
+	usage := &git.GitError{
+		Args:     []string{"worktree", "list", "--porcelain", "-z"},
+		ExitCode: 129,
+		Stderr:   "error: unknown switch `z'",
+	}
+	fake.Stub("worktree list --porcelain -z", "", usage)
+	fake.Stub("worktree list --porcelain", "worktree /repo\nHEAD abc\nbranch refs/heads/main\nprunable gitdir file points to non-existent location\n", nil)
+
+	worktrees, err := git.ListWorktrees(t.Context(), fake, "/repo")
+	if err != nil {
+		t.Fatalf("ListWorktrees() error: %v", err)
+	}
+	if len(worktrees) != 1 || !worktrees[0].IsPrunable {
+		t.Fatalf("expected a single prunable worktree, got %+v", worktrees)
+	}
+}
+
+func TestListWorktrees_PermissionError(t *testing.T) {
+	fake := gittest.NewFakeRunner()
+	want := gittest.Fail(git.KindUnknown, "fatal: cannot open '.git/worktrees': Permission denied",
+		"worktree", "list", "--porcelain", "-z")
+	fake.Stub("worktree list --porcelain -z", "", want)
+
+	_, err := git.ListWorktrees(t.Context(), fake, "/repo")
+	if !errors.Is(err, want) {
+		t.Fatalf("ListWorktrees() error = %v, want %v", err, want)
+	}
+}
+
+func TestEnrichWorktree_FakeTimeout(t *testing.T) {
+	fake := gittest.NewFakeRunner()
+	fake.Stub("status --porcelain=v2 --branch -z", "", gittest.Timeout("status", "--porcelain=v2", "--branch", "-z"))
+
+	wt := &git.Worktree{Path: t.TempDir(), Branch: "refs/heads/feature"}
+	git.EnrichWorktree(t.Context(), fake, wt, git.EnrichOptions{DefaultBranch: "main"})
+
+	if got := wt.StatusText(); got != "status: timeout" {
+		t.Errorf("StatusText() = %q, want %q", got, "status: timeout")
+	}
+	if fake.Called("log -1 --format=%ct") {
+		t.Error("expected enrichment to stop after the status timeout")
+	}
+}
+
+func TestEnrichWorktree_FakeStatus(t *testing.T) {
+	fake := gittest.NewFakeRunner()
+	fake.Stub("status --porcelain=v2 --branch -z", strings.Join([]string{
+		"# branch.oid 1111111111111111111111111111111111111111",
+		"# branch.head feature",
+		"# branch.upstream origin/feature",
+		"# branch.ab +2 -1",
+		"1 .M N... 100644 100644 100644 1111 1111 a.go",
+		"1 M. N... 100644 100644 100644 1111 2222 b.go",
+		"2 RM N... 100644 100644 100644 1111 2222 R100 c.go",
+		"old c.go",
+		"u UU N... 100644 100644 100644 100644 1111 2222 3333 d.go",
+		"? e.go",
+		"",
+	}, "\x00"), nil)
+	fake.Stub("for-each-ref --merged main --format=%(refname:lstrip=2) refs/heads/feature", "feature", nil)
+	fake.Stub("log -1 --format=%ct", "1700000000", nil)
+
+	wt := &git.Worktree{Path: t.TempDir(), Branch: "refs/heads/feature"}
+	git.EnrichWorktree(t.Context(), fake, wt, git.EnrichOptions{DefaultBranch: "main"})
+
+	if wt.Modified != 2 || wt.Staged != 2 || wt.Conflicted != 1 || wt.Untracked != 1 {
+		t.Errorf("Modified, Staged, Conflicted, Untracked = %d, %d, %d, %d, want 2, 2, 1, 1",
+			wt.Modified, wt.Staged, wt.Conflicted, wt.Untracked)
+	}
+	if wt.Ahead != 2 || wt.Behind != 1 {
+		t.Errorf("Ahead, Behind = %d, %d, want 2, 1", wt.Ahead, wt.Behind)
+	}
+	if wt.Upstream != git.UpstreamTracking || wt.UpstreamBranch != "origin/feature" {
+		t.Errorf("Upstream = %v %q, want tracking origin/feature", wt.Upstream, wt.UpstreamBranch)
+	}
+	if !wt.IsMerged {
+		t.Error("expected IsMerged = true")
+	}
+	if wt.LastCommit.Unix() != 1700000000 {
+		t.Errorf("LastCommit = %v, want unix 1700000000", wt.LastCommit)
+	}
+}
+
+func TestRemoveWorktree_FakeLocked(t *testing.T) {
+	fake := gittest.NewFakeRunner()
+	fake.Stub("worktree remove /repo-usb", "", gittest.Fail(git.KindLocked,
+		"fatal: cannot remove a locked working tree, lock reason: usb",
+		"worktree", "remove", "/repo-usb"))
+
+	_, err := git.RemoveWorktree(t.Context(), fake, "/repo", "/repo-usb", git.RemoveOptions{})
+	if git.ErrorKindOf(err) != git.KindLocked {
+		t.Fatalf("RemoveWorktree() error = %v, want KindLocked", err)
+	}
+	if fake.Called("worktree remove --force /repo-usb") {
+		t.Error("locked worktree must not be force-removed")
+	}
+}
+
+func TestAddWorktree_FakeNewBranch(t *testing.T) {
+	fake := gittest.NewFakeRunner()
+	fake.Stub("rev-parse --verify refs/heads/feature", "", gittest.Fail(git.KindUnknown,
+		"fatal: Needed a single revision", "rev-parse", "--verify", "refs/heads/feature"))
+	fake.Handle("worktree add -b feature /repo-feature main", func(ctx context.Context, dir string, args ...string) (string, error) {
+		if dir != "/repo" {
+			t.Errorf("worktree add ran in %q, want /repo", dir)
+		}
+		return "", nil
+	})
+
+	if err := git.AddWorktree(t.Context(), fake, "/repo", "/repo-feature", "feature", "main"); err != nil {
+		t.Fatalf("AddWorktree() error: %v", err)
+	}
+	if !fake.Called("worktree add -b feature /repo-feature main") {
+		t.Errorf("expected worktree add call, got %v", fake.Calls())
+	}
+}
+
+func TestAddSparseWorktree_FakeFailureRollsBack(t *testing.T) {
+	fake := gittest.NewFakeRunner()
+	fake.Stub("rev-parse --verify refs/heads/feature", "", gittest.Fail(git.KindUnknown,
+		"fatal: Needed a single revision", "rev-parse", "--verify", "refs/heads/feature"))
+	fake.Stub("worktree add --no-checkout -b feature /repo-feature", "", nil)
+	want := gittest.Fail(git.KindUnknown, "fatal: specify directories rather than patterns",
+		"sparse-checkout", "set", "--cone", "--", "apps/*")
+	fake.Stub("sparse-checkout set --cone -- apps/*", "", want)
+	fake.Stub("worktree remove --force /repo-feature", "", nil)
+	fake.Stub("branch -D feature", "", nil)
+
+	err := git.AddSparseWorktree(t.Context(), fake, "/repo", "/repo-feature", "feature", "", []string{"apps/*"})
+	if !errors.Is(err, want) {
+		t.Fatalf("AddSparseWorktree() error = %v, want %v", err, want)
+	}
+	if fake.Called("checkout") {
+		t.Error("checkout must not run after sparse-checkout failed")
+	}
+	if !fake.Called("worktree remove --force /repo-feature") || !fake.Called("branch -D feature") {
+		t.Errorf("expected the worktree and branch to be removed again, got %v", fake.Calls())
+	}
+}
+
+func TestRestoreWorktree_FakeAddFailureDeletesBranch(t *testing.T) {
+	fake := gittest.NewFakeRunner()
+	path := filepath.Join(t.TempDir(), "repo-feature")
+	fake.Stub("branch feature 1111111", "", nil)
+	fake.Stub("worktree add "+path+" feature", "", gittest.Fail(git.KindBranchCheckedOut,
+		"fatal: 'feature' is already checked out at '/elsewhere'",
+		"worktree", "add", path, "feature"))
+	fake.Stub("branch -D feature", "", nil)
+
+	rm := git.Removal{Path: path, Branch: "feature", Head: "1111111", BranchTip: "1111111"}
+	if err := git.RestoreWorktree(t.Context(), fake, "/repo", rm); git.ErrorKindOf(err) != git.KindBranchCheckedOut {
+		t.Fatalf("RestoreWorktree() error = %v, want KindBranchCheckedOut", err)
+	}
+	if !fake.Called("branch -D feature") {
+		t.Error("expected the recreated branch to be deleted again")
+	}
+}
+
+func TestEnrichWorktree_FakeUpstreamGone(t *testing.T) {
+	fake := gittest.NewFakeRunner()
+	fake.Stub("status --porcelain=v2 --branch -z", strings.Join([]string{
+		"# branch.oid 1111111111111111111111111111111111111111",
+		"# branch.head feature",
+		"# branch.upstream origin/feature",
+		"",
+	}, "\x00"), nil)
+	wt := &git.Worktree{Path: t.TempDir(), Branch: "refs/heads/feature"}
+	opts := git.EnrichOptions{DefaultBranch: "main", Merged: map[string]string{}, CommitTimes: map[string]time.Time{"feature": time.Unix(1700000000, 0)}}
+	git.EnrichWorktree(t.Context(), fake, wt, opts)
+
+	if wt.Upstream != git.UpstreamGone {
+		t.Errorf("Upstream = %v, want gone when git omits branch.ab", wt.Upstream)
+	}
+	if wt.LastCommit.Unix() != 1700000000 {
+		t.Errorf("LastCommit = %v, want the time from CommitTimes", wt.LastCommit)
+	}
+	if fake.Called("log -1 --format=%ct") {
+		t.Error("expected the commit time to be taken from CommitTimes")
+	}
+}
+
+func TestEnrichWorktrees_FakeRepoWideQueries(t *testing.T) {
+	fake := gittest.NewFakeRunner()
+	fake.Stub("for-each-ref --format=%(refname:lstrip=2)%09%(committerdate:unix) refs/heads/",
+		"main\t1700000000\nfeature-a\t1700000100\nfeature-b\t1700000200", nil)
+	fake.Stub("for-each-ref --merged main --format=%(refname:lstrip=2) refs/heads/", "main\nfeature-a", nil)
+	fake.Stub("status --porcelain=v2 --branch -z", "# branch.oid 1111\x00# branch.head x\x00", nil)
+
+	worktrees := []git.Worktree{
+		{Path: t.TempDir(), Branch: "refs/heads/main"},
+		{Path: t.TempDir(), Branch: "refs/heads/feature-a"},
+		{Path: t.TempDir(), Branch: "refs/heads/feature-b"},
+	}
+	git.EnrichWorktrees(t.Context(), fake, worktrees, git.EnrichOptions{DefaultBranch: "main"}, 2)
+
+	if worktrees[2].LastCommit.Unix() != 1700000200 {
+		t.Errorf("LastCommit = %v, want unix 1700000200", worktrees[2].LastCommit)
+	}
+	if !worktrees[1].IsMerged || worktrees[2].IsMerged {
+		t.Errorf("IsMerged = %v, %v, want feature-a merged only", worktrees[1].IsMerged, worktrees[2].IsMerged)
+	}
+	counts := make(map[string]int)
+	for _, c := range fake.Calls() {
+		counts[c.Args[0]]++
+	}
+	if counts["for-each-ref"] != 2 || counts["status"] != 3 || len(fake.Calls()) != 5 {
+		t.Errorf("git calls by command = %v, want two repo-wide for-each-ref and one status per worktree", counts)
+	}
+}
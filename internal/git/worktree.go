@@ -1,12 +1,15 @@
 package git
 
 import (
-	"bufio"
+	"context"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
+	"runtime"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -18,17 +21,146 @@ type Worktree struct {
 	IsDetached bool
 	IsCurrent  bool
 
-	// Status info (populated separately)
-	Modified   int
-	Untracked  int
-	Ahead      int
-	Behind     int
-	IsMerged   bool
+	// IsLocked is set for worktrees locked with `git worktree lock`.
+	IsLocked   bool
+	LockReason string
+	// IsPrunable is set when git considers the worktree stale, typically
+	// because its directory no longer exists.
+	IsPrunable     bool
+	PrunableReason string
+
+	// Status info (populated separately). Modified counts tracked files
+	// with unstaged changes and Staged those with staged changes; a file
+	// can be both. Conflicted files are counted in neither. Submodules with
+	// new commits, modified or untracked content are counted in
+	// DirtySubmodules instead of Modified.
+	Modified        int
+	Staged          int
+	Conflicted      int
+	Untracked       int
+	DirtySubmodules int
+	// IsSparse is set when only part of the tree is checked out with
+	// sparse-checkout.
+	IsSparse bool
+	// Operation is the rebase, merge or similar operation that was started
+	// in the worktree and not yet finished.
+	Operation Operation
+	Ahead     int
+	Behind    int
+	IsMerged  bool
+	MergedBy  MergeMethod // how the branch was merged, if IsMerged
+	// MergedInto is the merge target the branch was merged into. It is only
+	// set when EnrichOptions.MergeTargets are given, not for the default
+	// branch alone.
+	MergedInto string
 	LastCommit time.Time
+
+	// Upstream is the state of the branch's upstream, named by
+	// UpstreamBranch (e.g. "origin/feature") unless it is UpstreamNone.
+	Upstream       UpstreamState
+	UpstreamBranch string
+
+	// StatusErr is set when the working tree status could not be read,
+	// e.g. because git timed out. The other status fields are then unknown.
+	StatusErr error
+}
+
+// UpstreamState describes the upstream branch of a worktree's branch.
+type UpstreamState int
+
+const (
+	// UpstreamNone means the branch has no upstream configured.
+	UpstreamNone UpstreamState = iota
+	// UpstreamTracking means the branch tracks an existing upstream.
+	UpstreamTracking
+	// UpstreamGone means the upstream was deleted on the remote, typically
+	// after its pull request was merged.
+	UpstreamGone
+)
+
+func (s UpstreamState) String() string {
+	switch s {
+	case UpstreamTracking:
+		return "tracking"
+	case UpstreamGone:
+		return "gone"
+	default:
+		return "none"
+	}
+}
+
+// Operation is a multi-step git operation in progress in a worktree.
+type Operation string
+
+const (
+	OpNone       Operation = ""
+	OpRebase     Operation = "rebase"
+	OpAm         Operation = "am"
+	OpMerge      Operation = "merge"
+	OpCherryPick Operation = "cherry-pick"
+	OpRevert     Operation = "revert"
+	OpBisect     Operation = "bisect"
+)
+
+// operationMarkers maps the files git keeps in a worktree's gitdir while an
+// operation is in progress to that operation, in the order they are checked.
+// rebase-apply is shared by rebase and am; am adds the "applying" marker.
+var operationMarkers = []struct {
+	path string
+	op   Operation
+}{
+	{"rebase-merge", OpRebase},
+	{filepath.Join("rebase-apply", "applying"), OpAm},
+	{"rebase-apply", OpRebase},
+	{"MERGE_HEAD", OpMerge},
+	{"CHERRY_PICK_HEAD", OpCherryPick},
+	{"REVERT_HEAD", OpRevert},
+	{"BISECT_LOG", OpBisect},
 }
 
+// worktreeGitDir returns the gitdir of the worktree at wtPath: its .git
+// directory, or the directory its .git file points to.
+func worktreeGitDir(wtPath string) (string, error) {
+	gitDir := filepath.Join(wtPath, ".git")
+	info, err := os.Stat(gitDir)
+	if err != nil {
+		return "", err
+	}
+	if info.IsDir() {
+		return gitDir, nil
+	}
+	return readGitFile(wtPath)
+}
+
+// detectOperation reports the operation in progress in the worktree at
+// wtPath by looking for git's state files in its gitdir.
+func detectOperation(wtPath string) Operation {
+	gitDir, err := worktreeGitDir(wtPath)
+	if err != nil {
+		return OpNone
+	}
+	for _, m := range operationMarkers {
+		if _, err := os.Stat(filepath.Join(gitDir, m.path)); err == nil {
+			return m.op
+		}
+	}
+	return OpNone
+}
+
+// IsClean reports whether the worktree has no local changes. A worktree whose
+// status could not be determined is never considered clean.
 func (w *Worktree) IsClean() bool {
-	return w.Modified == 0 && w.Untracked == 0
+	return w.StatusErr == nil && w.Modified == 0 && w.Staged == 0 && w.Conflicted == 0 && w.Untracked == 0 &&
+		w.DirtySubmodules == 0
+}
+
+// OperationText describes the operation in progress, e.g. "rebase in
+// progress". It is empty if there is none.
+func (w *Worktree) OperationText() string {
+	if w.Operation == OpNone {
+		return ""
+	}
+	return string(w.Operation) + " in progress"
 }
 
 func (w *Worktree) BranchShort() string {
@@ -39,19 +171,53 @@ func (w *Worktree) StatusText() string {
 	if w.IsBare {
 		return "bare"
 	}
+	if w.StatusErr != nil {
+		if errors.Is(w.StatusErr, context.DeadlineExceeded) {
+			return "status: timeout"
+		}
+		return "status: unknown"
+	}
 	if w.IsClean() {
 		return "clean"
 	}
 	parts := []string{}
+	if w.Conflicted > 0 {
+		parts = append(parts, fmt.Sprintf("%d conflicted", w.Conflicted))
+	}
+	if w.Staged > 0 {
+		parts = append(parts, fmt.Sprintf("%d staged", w.Staged))
+	}
 	if w.Modified > 0 {
 		parts = append(parts, fmt.Sprintf("%d modified", w.Modified))
 	}
 	if w.Untracked > 0 {
 		parts = append(parts, fmt.Sprintf("%d untracked", w.Untracked))
 	}
+	switch {
+	case w.DirtySubmodules == 1:
+		parts = append(parts, "1 dirty submodule")
+	case w.DirtySubmodules > 1:
+		parts = append(parts, fmt.Sprintf("%d dirty submodules", w.DirtySubmodules))
+	}
 	return strings.Join(parts, ", ")
 }
 
+// MergedText describes where and how the branch was merged, e.g. "merged
+// into origin/main via squash". It is empty for branches that are not merged.
+func (w *Worktree) MergedText() string {
+	if !w.IsMerged {
+		return ""
+	}
+	text := "merged"
+	if w.MergedInto != "" {
+		text += " into " + w.MergedInto
+	}
+	if w.MergedBy != "" && w.MergedBy != MergedByAncestry {
+		text += " via " + string(w.MergedBy)
+	}
+	return text
+}
+
 func (w *Worktree) SyncText() string {
 	if w.Ahead == 0 && w.Behind == 0 {
 		return "-"
@@ -80,64 +246,234 @@ func (w *Worktree) InactiveDays() int {
 	return int(time.Since(w.LastCommit).Hours() / 24)
 }
 
-// ListWorktrees parses `git worktree list --porcelain` output.
-func ListWorktrees(repoDir string) ([]Worktree, error) {
-	out, err := run(repoDir, "worktree", "list", "--porcelain")
+// ListWorktrees parses `git worktree list --porcelain -z` output. Git
+// versions without -z support (before 2.36) fall back to the newline
+// separated format, which cannot represent paths containing newlines.
+func ListWorktrees(ctx context.Context, r Runner, repoDir string) ([]Worktree, error) {
+	sep := byte(0)
+	out, err := r.Run(ctx, repoDir, "worktree", "list", "--porcelain", "-z")
+	var gitErr *GitError
+	if errors.As(err, &gitErr) && gitErr.ExitCode == 129 {
+		// 129 is git's exit status for usage errors such as unknown options.
+		sep = '\n'
+		out, err = r.Run(ctx, repoDir, "worktree", "list", "--porcelain")
+	}
 	if err != nil {
 		return nil, err
 	}
 
+	worktrees := parsePorcelain(out, sep)
+
+	// Determine which one is current. Worktrees can be nested, e.g. in the
+	// subdirectory layout, so the innermost one containing cwd wins.
+	if cwd, err := os.Getwd(); err == nil {
+		current, depth := -1, -1
+		for i := range worktrees {
+			if !isWithin(cwd, worktrees[i].Path) {
+				continue
+			}
+			if d := len(cleanPath(worktrees[i].Path)); d > depth {
+				current, depth = i, d
+			}
+		}
+		if current >= 0 {
+			worktrees[current].IsCurrent = true
+		}
+	}
+
+	return worktrees, nil
+}
+
+// parsePorcelain parses the attribute lines of `git worktree list --porcelain`
+// terminated by sep. Records are separated by an empty attribute.
+func parsePorcelain(out string, sep byte) []Worktree {
 	var worktrees []Worktree
 	var current *Worktree
 
-	scanner := bufio.NewScanner(strings.NewReader(out))
-	for scanner.Scan() {
-		line := scanner.Text()
-		switch {
-		case strings.HasPrefix(line, "worktree "):
+	for _, line := range strings.Split(out, string(sep)) {
+		key, value, _ := strings.Cut(line, " ")
+		if key == "worktree" {
 			if current != nil {
 				worktrees = append(worktrees, *current)
 			}
-			current = &Worktree{Path: strings.TrimPrefix(line, "worktree ")}
-		case strings.HasPrefix(line, "HEAD "):
-			if current != nil {
-				current.Head = strings.TrimPrefix(line, "HEAD ")
-			}
-		case strings.HasPrefix(line, "branch "):
-			if current != nil {
-				current.Branch = strings.TrimPrefix(line, "branch ")
-			}
-		case line == "bare":
-			if current != nil {
-				current.IsBare = true
-			}
-		case line == "detached":
-			if current != nil {
-				current.IsDetached = true
-			}
+			current = &Worktree{Path: value}
+			continue
+		}
+		if current == nil {
+			continue
+		}
+		switch key {
+		case "HEAD":
+			current.Head = value
+		case "branch":
+			current.Branch = value
+		case "bare":
+			current.IsBare = true
+		case "detached":
+			current.IsDetached = true
+		case "locked":
+			current.IsLocked = true
+			current.LockReason = value
+		case "prunable":
+			current.IsPrunable = true
+			current.PrunableReason = value
 		}
 	}
 	if current != nil {
 		worktrees = append(worktrees, *current)
 	}
+	return worktrees
+}
 
-	// Determine which one is current
-	cwd, err := os.Getwd()
-	if err == nil {
-		cwd, _ = filepath.Abs(cwd)
-		for i := range worktrees {
-			wtAbs, _ := filepath.Abs(worktrees[i].Path)
-			if cwd == wtAbs || strings.HasPrefix(cwd, wtAbs+string(os.PathSeparator)) {
-				worktrees[i].IsCurrent = true
+// MergeDetection selects how EnrichWorktree decides whether a branch is
+// merged into the default branch.
+type MergeDetection string
+
+const (
+	// DetectAncestry only recognises branches whose commits are reachable
+	// from the default branch, i.e. `git branch --merged`.
+	DetectAncestry MergeDetection = "ancestry"
+	// DetectSquash additionally recognises rebase and squash merges, whose
+	// commits were rewritten when they landed on the default branch.
+	DetectSquash MergeDetection = "squash"
+)
+
+// MergeMethod tells which check found a branch to be merged.
+type MergeMethod string
+
+const (
+	// MergedByAncestry means the branch tip is reachable from the target.
+	MergedByAncestry MergeMethod = "ancestry"
+	// MergedByRebase means every commit has a patch-equivalent commit on
+	// the target, as left by a rebase merge.
+	MergedByRebase MergeMethod = "rebase"
+	// MergedBySquash means the target already contains the combined changes
+	// of the branch, as left by a squash merge.
+	MergedBySquash MergeMethod = "squash"
+)
+
+// EnrichOptions controls how EnrichWorktree collects information.
+type EnrichOptions struct {
+	// DefaultBranch is the branch merge status is computed against.
+	DefaultBranch string
+	// MergeDetection defaults to DetectAncestry.
+	MergeDetection MergeDetection
+	// CommitTimes holds the committer time of local branch tips, keyed by
+	// short name, as returned by BranchCommitTimes. EnrichWorktrees loads it
+	// once for all worktrees; branches missing from it are looked up with
+	// `git log`.
+	CommitTimes map[string]time.Time
+	// MergeTargets are the refs merge status is computed against, in
+	// order, e.g. "origin/main". Empty means DefaultBranch.
+	MergeTargets []string
+	// Remotes are the repository's remotes. They tell remote-tracking
+	// targets such as "origin/main" apart from local branches with a slash
+	// such as "release/1.0".
+	Remotes []string
+	// Merged maps the local branches merged by ancestry to the first merge
+	// target they are merged into, as returned by MergedIntoTargets.
+	// EnrichWorktrees loads it once for all worktrees; if it is nil, each
+	// branch is checked on its own.
+	Merged map[string]string
+}
+
+// targets returns the merge targets, defaulting to the default branch.
+func (o EnrichOptions) targets() []string {
+	if len(o.MergeTargets) > 0 {
+		return o.MergeTargets
+	}
+	if o.DefaultBranch != "" {
+		return []string{o.DefaultBranch}
+	}
+	return nil
+}
+
+// isTarget reports whether branch is one of the merge targets or the local
+// counterpart of a remote-tracking target such as origin/<branch>. Targets
+// are never considered merged into each other.
+func (o EnrichOptions) isTarget(branch string) bool {
+	if branch == o.DefaultBranch {
+		return true
+	}
+	for _, t := range o.targets() {
+		if t == branch {
+			return true
+		}
+		for _, remote := range o.Remotes {
+			if local, ok := strings.CutPrefix(t, remote+"/"); ok && local == branch {
+				return true
 			}
 		}
 	}
+	return false
+}
 
-	return worktrees, nil
+// MergedIntoTargets maps every local branch merged by ancestry into one of
+// targets to the first such target, with one `git for-each-ref --merged`
+// call per target. Targets that cannot be resolved are skipped.
+func MergedIntoTargets(ctx context.Context, r Runner, dir string, targets []string, patterns ...string) map[string]string {
+	mergedInto := make(map[string]string)
+	for _, target := range targets {
+		merged, err := MergedBranches(ctx, r, dir, target, patterns...)
+		if err != nil {
+			continue
+		}
+		for branch := range merged {
+			if _, ok := mergedInto[branch]; !ok {
+				mergedInto[branch] = target
+			}
+		}
+	}
+	return mergedInto
 }
 
-// EnrichWorktree populates status, ahead/behind, merge status, and last commit.
-func EnrichWorktree(w *Worktree, defaultBranch string) {
+// MergedBranches returns the local branches whose tips are reachable from
+// target with a single `git for-each-ref --merged` call. patterns restrict
+// the refs checked and default to all local branches.
+func MergedBranches(ctx context.Context, r Runner, dir, target string, patterns ...string) (map[string]bool, error) {
+	if len(patterns) == 0 {
+		patterns = []string{"refs/heads/"}
+	}
+	args := append([]string{"for-each-ref", "--merged", target, "--format=%(refname:lstrip=2)"}, patterns...)
+	out, err := r.Run(ctx, dir, args...)
+	if err != nil {
+		return nil, err
+	}
+	merged := make(map[string]bool)
+	for _, name := range strings.Split(out, "\n") {
+		if name != "" {
+			merged[name] = true
+		}
+	}
+	return merged, nil
+}
+
+// BranchCommitTimes returns the committer time of the tip of every local
+// branch with a single `git for-each-ref` call.
+func BranchCommitTimes(ctx context.Context, r Runner, dir string) (map[string]time.Time, error) {
+	out, err := r.Run(ctx, dir, "for-each-ref", "--format=%(refname:lstrip=2)%09%(committerdate:unix)", "refs/heads/")
+	if err != nil {
+		return nil, err
+	}
+	times := make(map[string]time.Time)
+	for _, line := range strings.Split(out, "\n") {
+		name, ts, ok := strings.Cut(line, "\t")
+		if !ok {
+			continue
+		}
+		if sec, err := strconv.ParseInt(ts, 10, 64); err == nil {
+			times[name] = time.Unix(sec, 0)
+		}
+	}
+	return times, nil
+}
+
+// EnrichWorktree populates status, ahead/behind, upstream state, merge
+// status, and last commit. Status, sync and upstream come from a single
+// `git status --porcelain=v2 --branch -z` call. If it fails (for instance
+// because it timed out), StatusErr is set and the remaining queries are
+// skipped.
+func EnrichWorktree(ctx context.Context, r Runner, w *Worktree, opts EnrichOptions) {
 	if w.IsBare {
 		return
 	}
@@ -145,99 +481,547 @@ func EnrichWorktree(w *Worktree, defaultBranch string) {
 		return
 	}
 
-	// Modified + untracked count
-	if out, err := run(w.Path, "status", "--porcelain"); err == nil && out != "" {
-		for _, line := range strings.Split(out, "\n") {
-			if len(line) < 2 {
-				continue
+	out, err := r.Run(ctx, w.Path, "status", "--porcelain=v2", "--branch", "-z")
+	if err != nil {
+		w.StatusErr = err
+		return
+	}
+	w.parseStatus(out)
+	w.Operation = detectOperation(w.Path)
+	w.IsSparse = isSparse(ctx, r, w.Path)
+
+	// Merged into the default branch or a merge target
+	branch := w.BranchShort()
+	if branch != "" && !opts.isTarget(branch) {
+		target, method := mergedBy(ctx, r, w.Path, branch, opts)
+		w.IsMerged = method != ""
+		if len(opts.MergeTargets) > 0 {
+			w.MergedInto = target
+		}
+		w.MergedBy = method
+	}
+
+	// Last commit time
+	if t, ok := opts.CommitTimes[branch]; ok && branch != "" {
+		w.LastCommit = t
+	} else if out, err := r.Run(ctx, w.Path, "log", "-1", "--format=%ct"); err == nil && out != "" {
+		if ts, err := strconv.ParseInt(out, 10, 64); err == nil {
+			w.LastCommit = time.Unix(ts, 0)
+		}
+	}
+}
+
+// parseStatus reads the output of `git status --porcelain=v2 --branch -z`:
+// "# branch." headers followed by one entry per changed path. Entries start
+// with their type, "1" (changed), "2" (renamed or copied, followed by the
+// original path), "u" (unmerged) or "?" (untracked); XY use "." for an
+// unchanged side.
+func (w *Worktree) parseStatus(out string) {
+	hasUpstream, hasSync := false, false
+	fields := strings.Split(out, "\x00")
+	for i := 0; i < len(fields); i++ {
+		entry := fields[i]
+		switch {
+		case strings.HasPrefix(entry, "# branch.upstream "):
+			w.UpstreamBranch = strings.TrimPrefix(entry, "# branch.upstream ")
+			hasUpstream = true
+		case strings.HasPrefix(entry, "# branch.ab "):
+			// "+<ahead> -<behind>"; omitted when the upstream is gone.
+			if _, err := fmt.Sscanf(entry, "# branch.ab +%d -%d", &w.Ahead, &w.Behind); err == nil {
+				hasSync = true
+			}
+		case strings.HasPrefix(entry, "? "):
+			w.Untracked++
+		case strings.HasPrefix(entry, "u "):
+			w.Conflicted++
+		case len(entry) > 9 && (entry[0] == '1' || entry[0] == '2'):
+			// "<type> <XY> <sub> ...", where sub starts with "S" for a
+			// submodule.
+			if entry[2] != '.' {
+				w.Staged++
 			}
-			if line[:2] == "??" {
-				w.Untracked++
-			} else {
+			switch {
+			case entry[3] == '.':
+			case entry[5] == 'S':
+				w.DirtySubmodules++
+			default:
 				w.Modified++
 			}
+			if entry[0] == '2' {
+				i++ // the original path
+			}
 		}
 	}
 
-	// Ahead/behind upstream
-	if out, err := run(w.Path, "rev-list", "--left-right", "--count", "HEAD...@{upstream}"); err == nil {
-		parts := strings.Fields(out)
-		if len(parts) == 2 {
-			w.Ahead, _ = strconv.Atoi(parts[0])
-			w.Behind, _ = strconv.Atoi(parts[1])
+	switch {
+	case !hasUpstream:
+		w.Upstream = UpstreamNone
+	case hasSync:
+		w.Upstream = UpstreamTracking
+	default:
+		w.Upstream = UpstreamGone
+	}
+}
+
+// EnrichWorktrees runs EnrichWorktree for every worktree using a bounded pool
+// of at most parallelism workers. Worktrees are updated in place, so the
+// order of the slice is preserved. A parallelism of 0 or less uses one worker
+// per CPU. Worktrees not yet started when ctx is cancelled are left as is.
+func EnrichWorktrees(ctx context.Context, r Runner, worktrees []Worktree, opts EnrichOptions, parallelism int) {
+	if parallelism <= 0 {
+		parallelism = runtime.NumCPU()
+	}
+	if parallelism > len(worktrees) {
+		parallelism = len(worktrees)
+	}
+
+	if len(worktrees) > 0 {
+		// Worktrees share their refs; the main worktree comes first.
+		dir := worktrees[0].Path
+		if opts.CommitTimes == nil {
+			opts.CommitTimes, _ = BranchCommitTimes(ctx, r, dir)
+		}
+		if opts.Merged == nil {
+			opts.Merged = MergedIntoTargets(ctx, r, dir, opts.targets())
 		}
 	}
 
-	// Merged into default branch
-	branch := w.BranchShort()
-	if branch != "" && branch != defaultBranch {
-		if out, err := run(w.Path, "branch", "--merged", defaultBranch); err == nil {
-			for _, line := range strings.Split(out, "\n") {
-				name := strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(line), "* "))
-				if name == branch {
-					w.IsMerged = true
-					break
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for range parallelism {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				if ctx.Err() != nil {
+					continue
 				}
+				EnrichWorktree(ctx, r, &worktrees[i], opts)
 			}
-		}
+		}()
+	}
+	for i := range worktrees {
+		jobs <- i
 	}
+	close(jobs)
+	wg.Wait()
+}
 
-	// Last commit time
-	if out, err := run(w.Path, "log", "-1", "--format=%ct"); err == nil && out != "" {
-		if ts, err := strconv.ParseInt(out, 10, 64); err == nil {
-			w.LastCommit = time.Unix(ts, 0)
+// mergedBy reports which merge target branch was merged into and how, or
+// "" if it was not. Rebase and squash merges are only checked with
+// DetectSquash, after ancestry has been checked against every target.
+func mergedBy(ctx context.Context, r Runner, dir, branch string, opts EnrichOptions) (string, MergeMethod) {
+	merged := opts.Merged
+	if merged == nil {
+		merged = MergedIntoTargets(ctx, r, dir, opts.targets(), "refs/heads/"+branch)
+	}
+	if target, ok := merged[branch]; ok {
+		return target, MergedByAncestry
+	}
+	if opts.MergeDetection != DetectSquash {
+		return "", ""
+	}
+	for _, target := range opts.targets() {
+		if method := patchMerged(ctx, r, dir, branch, target); method != "" {
+			return target, method
 		}
 	}
+	return "", ""
+}
+
+// patchMerged reports whether branch was landed on target by rebase or
+// squash merge.
+func patchMerged(ctx context.Context, r Runner, dir, branch, target string) MergeMethod {
+	// git cherry marks commits with a patch-equivalent on target with "-".
+	out, err := r.Run(ctx, dir, "cherry", target, branch)
+	if err != nil {
+		return ""
+	}
+	if out != "" && !strings.Contains("\n"+out, "\n+") {
+		return MergedByRebase
+	}
+
+	// If merging the branch would leave target's tree unchanged, target
+	// already contains all of its changes. Conflicts mean it does not.
+	mergeTree, err := r.Run(ctx, dir, "merge-tree", "--write-tree", target, branch)
+	if err != nil {
+		return ""
+	}
+	targetTree, err := r.Run(ctx, dir, "rev-parse", target+"^{tree}")
+	if err != nil {
+		return ""
+	}
+	if mergedTree, _, _ := strings.Cut(mergeTree, "\n"); mergedTree == targetTree {
+		return MergedBySquash
+	}
+	return ""
 }
 
 // AddWorktree creates a new worktree at targetPath for the given branch.
-func AddWorktree(repoDir, targetPath, branch, baseBranch string) error {
-	if BranchExists(repoDir, branch) {
-		_, err := run(repoDir, "worktree", "add", targetPath, branch)
+func AddWorktree(ctx context.Context, r Runner, repoDir, targetPath, branch, baseBranch string) error {
+	_, err := addWorktree(ctx, r, repoDir, targetPath, branch, baseBranch)
+	return err
+}
+
+// AddSparseWorktree creates a new worktree at targetPath like AddWorktree,
+// but only checks out the directories matched by the cone-mode
+// sparse-checkout patterns. If they cannot be applied, the worktree and a
+// newly created branch are removed again.
+func AddSparseWorktree(ctx context.Context, r Runner, repoDir, targetPath, branch, baseBranch string, patterns []string) error {
+	created, err := addWorktree(ctx, r, repoDir, targetPath, branch, baseBranch, "--no-checkout")
+	if err != nil {
+		return err
+	}
+	_, err = r.Run(ctx, targetPath, append([]string{"sparse-checkout", "set", "--cone", "--"}, patterns...)...)
+	if err == nil {
+		_, err = r.Run(ctx, targetPath, "checkout")
+	}
+	if err != nil {
+		ctx := context.WithoutCancel(ctx)
+		_, _ = r.Run(ctx, repoDir, "worktree", "remove", "--force", targetPath)
+		if created {
+			_, _ = r.Run(ctx, repoDir, "branch", "-D", branch)
+		}
 		return err
 	}
+	return nil
+}
+
+// addWorktree runs `git worktree add` with flags, creating branch from
+// baseBranch if it does not exist yet, and reports whether it did.
+func addWorktree(ctx context.Context, r Runner, repoDir, targetPath, branch, baseBranch string, flags ...string) (bool, error) {
+	args := append([]string{"worktree", "add"}, flags...)
+	if BranchExists(ctx, r, repoDir, branch) {
+		_, err := r.Run(ctx, repoDir, append(args, targetPath, branch)...)
+		return false, err
+	}
 	// Create new branch from baseBranch
-	args := []string{"worktree", "add", "-b", branch, targetPath}
+	args = append(args, "-b", branch, targetPath)
 	if baseBranch != "" {
 		args = append(args, baseBranch)
 	}
-	_, err := run(repoDir, args...)
-	return err
+	_, err := r.Run(ctx, repoDir, args...)
+	return err == nil, err
+}
+
+// isSparse reports whether sparse-checkout is enabled in the worktree at
+// wtPath. The config is only read if the worktree has sparse-checkout
+// patterns, which git keeps when it is disabled again.
+func isSparse(ctx context.Context, r Runner, wtPath string) bool {
+	gitDir, err := worktreeGitDir(wtPath)
+	if err != nil {
+		return false
+	}
+	if _, err := os.Stat(filepath.Join(gitDir, "info", "sparse-checkout")); err != nil {
+		return false
+	}
+	out, err := r.Run(ctx, wtPath, "config", "--bool", "core.sparseCheckout")
+	return err == nil && out == "true"
+}
+
+// Submodule is a submodule declared in .gitmodules.
+type Submodule struct {
+	Name string
+	Path string
+}
+
+// Submodules returns the submodules declared in the .gitmodules file of the
+// worktree at wtPath. A worktree without .gitmodules has none.
+func Submodules(ctx context.Context, r Runner, wtPath string) ([]Submodule, error) {
+	if _, err := os.Stat(filepath.Join(wtPath, ".gitmodules")); err != nil {
+		return nil, nil
+	}
+	// Entries are "submodule.<name>.path\n<path>", NUL-terminated.
+	out, err := r.Run(ctx, wtPath, "config", "--file", ".gitmodules", "--null", "--get-regexp", `^submodule\..*\.path$`)
+	var gitErr *GitError
+	if errors.As(err, &gitErr) && gitErr.ExitCode == 1 {
+		return nil, nil // no submodule has a path
+	}
+	if err != nil {
+		return nil, err
+	}
+	var subs []Submodule
+	for _, entry := range strings.Split(out, "\x00") {
+		key, path, ok := strings.Cut(entry, "\n")
+		if !ok {
+			continue
+		}
+		name := strings.TrimSuffix(strings.TrimPrefix(key, "submodule."), ".path")
+		subs = append(subs, Submodule{Name: name, Path: path})
+	}
+	return subs, nil
+}
+
+// UpdateSubmodules initialises and updates the submodules of the worktree at
+// wtPath recursively and returns them. With reuse, submodules the main
+// worktree has already cloned are cloned from its module repositories in
+// the common dir (--reference --dissociate) instead of from their remotes.
+func UpdateSubmodules(ctx context.Context, r Runner, wtPath string, reuse bool) ([]Submodule, error) {
+	subs, err := Submodules(ctx, r, wtPath)
+	if err != nil || len(subs) == 0 {
+		return nil, err
+	}
+	if !reuse {
+		_, err := r.Run(ctx, wtPath, "submodule", "update", "--init", "--recursive")
+		return subs, err
+	}
+
+	common, err := GitCommonDir(ctx, r, wtPath)
+	if err != nil {
+		return nil, err
+	}
+	for _, sub := range subs {
+		args := []string{"submodule", "update", "--init", "--recursive"}
+		ref := filepath.Join(common, "modules", sub.Name)
+		if _, err := os.Stat(ref); err == nil {
+			args = append(args, "--reference", ref, "--dissociate")
+		}
+		if _, err := r.Run(ctx, wtPath, append(args, "--", sub.Path)...); err != nil {
+			return subs, err
+		}
+	}
+	return subs, nil
+}
+
+// DirtyAction selects what RemoveWorktree does with a worktree that has
+// local changes.
+type DirtyAction int
+
+const (
+	// DirtyBackup saves the changes with BackupWorktree before removing.
+	DirtyBackup DirtyAction = iota
+	// DirtyRefuse returns the KindDirty *GitError and keeps the worktree.
+	DirtyRefuse
+	// DirtyDiscard removes the worktree with --force, losing the changes.
+	DirtyDiscard
+)
+
+// RemoveOptions controls how RemoveWorktree removes a worktree.
+type RemoveOptions struct {
+	// DeleteBranch deletes the worktree's branch with `git branch -d`.
+	DeleteBranch bool
+	// ForceDeleteBranch uses `git branch -D` instead, for branches merged by
+	// squash or rebase that git does not consider merged.
+	ForceDeleteBranch bool
+	// Force removes the worktree even if it is locked.
+	Force bool
+	// Dirty handles local changes; the zero value backs them up.
+	Dirty DirtyAction
+}
+
+// Removal describes a removed worktree well enough to recreate it with
+// RestoreWorktree.
+type Removal struct {
+	Path   string `json:"path"`
+	Branch string `json:"branch,omitempty"`
+	Head   string `json:"head"`
+	// BranchTip is the commit the branch pointed to when it was deleted
+	// along with the worktree; empty if the branch was kept.
+	BranchTip string `json:"branch_tip,omitempty"`
+	// Backup is the ref the local changes were saved to, if any.
+	Backup     string    `json:"backup,omitempty"`
+	Locked     bool      `json:"locked,omitempty"`
+	LockReason string    `json:"lock_reason,omitempty"`
+	RemovedAt  time.Time `json:"removed_at"`
 }
 
 // RemoveWorktree removes a worktree and optionally deletes the branch.
-func RemoveWorktree(repoDir, wtPath string, deleteBranch bool) error {
-	// Get branch name before removal
-	var branchName string
-	if deleteBranch {
-		worktrees, err := ListWorktrees(repoDir)
-		if err == nil {
-			for _, wt := range worktrees {
-				absWt, _ := filepath.Abs(wt.Path)
-				absTarget, _ := filepath.Abs(wtPath)
-				if absWt == absTarget {
-					branchName = wt.BranchShort()
-					break
+// Local changes are handled according to opts.Dirty. The returned Removal
+// records what was removed; its Backup is set whenever changes were saved,
+// even if the removal then fails. Locked worktrees are refused with a
+// KindLocked *GitError unless opts.Force is set; other failures are
+// returned as a *GitError too.
+func RemoveWorktree(ctx context.Context, r Runner, repoDir, wtPath string, opts RemoveOptions) (rm Removal, err error) {
+	// Record the worktree before removal
+	rm.Path, _ = filepath.Abs(wtPath)
+	worktrees, err := ListWorktrees(ctx, r, repoDir)
+	if err == nil {
+		for _, wt := range worktrees {
+			absWt, _ := filepath.Abs(wt.Path)
+			if absWt == rm.Path {
+				rm.Branch = wt.BranchShort()
+				rm.Head = wt.Head
+				rm.Locked = wt.IsLocked
+				rm.LockReason = wt.LockReason
+				break
+			}
+		}
+	}
+
+	backupName := rm.Branch
+	if backupName == "" {
+		// Detached worktrees are told apart by their HEAD.
+		backupName = "detached-" + rm.Head[:min(len(rm.Head), 12)]
+	}
+
+	// git removes ignored files, e.g. .env, without complaint; they are
+	// local changes too. Locked worktrees are checked once git refuses them.
+	if opts.Dirty != DirtyDiscard && !rm.Locked && hasIgnoredFiles(ctx, r, wtPath) {
+		err = dirtyError(wtPath)
+	} else {
+		_, err = r.Run(ctx, repoDir, "worktree", "remove", wtPath)
+	}
+	if ErrorKindOf(err) == KindDirty && opts.Dirty != DirtyDiscard {
+		if opts.Dirty == DirtyRefuse {
+			return rm, err
+		}
+		if rm.Backup, err = BackupWorktree(ctx, r, wtPath, backupName); err != nil {
+			return rm, err
+		}
+		// Changes a stash cannot hold, e.g. inside submodules, are never
+		// forced away.
+		_, err = r.Run(ctx, repoDir, "worktree", "remove", wtPath)
+		if ErrorKindOf(err) == KindDirty {
+			return rm, err
+		}
+	}
+	if err != nil {
+		// Discarded local changes are forced through; locks only when asked
+		// to. Unknown failures are reported to the caller.
+		args := []string{"worktree", "remove", "--force"}
+		switch ErrorKindOf(err) {
+		case KindDirty:
+		case KindLocked, KindSubmodules:
+			if ErrorKindOf(err) == KindLocked {
+				if !opts.Force {
+					return rm, err
 				}
+				// A single --force does not override a lock.
+				args = append(args, "--force")
 			}
+			// git refuses these before checking for local changes, so they
+			// are still unseen.
+			if opts.Dirty != DirtyDiscard {
+				if rm.Backup, err = saveUnseenChanges(ctx, r, wtPath, backupName, opts.Dirty); err != nil {
+					return rm, err
+				}
+			}
+		default:
+			return rm, err
+		}
+		if _, err := r.Run(ctx, repoDir, append(args, wtPath)...); err != nil {
+			return rm, err
 		}
 	}
+	rm.RemovedAt = time.Now()
 
-	if _, err := run(repoDir, "worktree", "remove", wtPath); err != nil {
-		// Try force removal
-		if _, err := run(repoDir, "worktree", "remove", "--force", wtPath); err != nil {
-			return err
+	if opts.DeleteBranch && rm.Branch != "" {
+		flag := "-d"
+		if opts.ForceDeleteBranch {
+			flag = "-D"
+		}
+		if _, err := r.Run(ctx, repoDir, "branch", flag, rm.Branch); err == nil {
+			rm.BranchTip = rm.Head
 		}
 	}
+	return rm, nil
+}
 
-	if deleteBranch && branchName != "" {
-		_, _ = run(repoDir, "branch", "-d", branchName)
+// saveUnseenChanges handles the local changes of a worktree that is about to
+// be removed with --force according to dirty: they are refused or backed up.
+// Changes a stash cannot hold, e.g. inside submodules, are always refused.
+func saveUnseenChanges(ctx context.Context, r Runner, wtPath, name string, dirty DirtyAction) (string, error) {
+	status, err := r.Run(ctx, wtPath, "status", "--porcelain", "--ignored")
+	if err != nil || status == "" {
+		return "", err
 	}
-	return nil
+	if dirty == DirtyRefuse {
+		return "", dirtyError(wtPath)
+	}
+	backup, err := BackupWorktree(ctx, r, wtPath, name)
+	if err != nil {
+		return "", err
+	}
+	status, err = r.Run(ctx, wtPath, "status", "--porcelain", "--ignored")
+	if err == nil && status != "" {
+		err = dirtyError(wtPath)
+	}
+	return backup, err
+}
+
+// hasIgnoredFiles reports whether the worktree at wtPath contains files
+// ignored by git. It is false if they cannot be listed.
+func hasIgnoredFiles(ctx context.Context, r Runner, wtPath string) bool {
+	out, err := r.Run(ctx, wtPath, "ls-files", "--others", "--ignored", "--exclude-standard", "--directory")
+	return err == nil && out != ""
+}
+
+// dirtyError is the KindDirty *GitError git reports for a worktree with
+// local changes.
+func dirtyError(wtPath string) *GitError {
+	return &GitError{
+		Args:     []string{"worktree", "remove", wtPath},
+		ExitCode: -1,
+		Stderr:   fmt.Sprintf("'%s' contains modified or untracked files", wtPath),
+		Kind:     KindDirty,
+	}
+}
+
+// BackupWorktree saves the modified, untracked and ignored files of the
+// worktree at wtPath as a stash commit under
+// refs/wt-backup/<name>/<unix time>-<stash>, where <stash> abbreviates the
+// stash commit, and returns that ref. The changes are removed from the
+// worktree; restore them with `git stash apply <ref>`. If there is nothing
+// to save, the returned ref is empty.
+func BackupWorktree(ctx context.Context, r Runner, wtPath, name string) (string, error) {
+	before, _ := r.Run(ctx, wtPath, "rev-parse", "--verify", "--quiet", "refs/stash")
+	msg := "git-wt backup of " + name
+	if _, err := r.Run(ctx, wtPath, "stash", "push", "--all", "--message", msg); err != nil {
+		return "", err
+	}
+	after, err := r.Run(ctx, wtPath, "rev-parse", "--verify", "--quiet", "refs/stash")
+	if err != nil || after == before {
+		// git stash exits successfully when there is nothing to save.
+		return "", nil
+	}
+
+	// The stash commit keeps refs of backups made in the same second apart;
+	// the empty old value makes update-ref refuse to overwrite one anyway.
+	ref := fmt.Sprintf("refs/wt-backup/%s/%d-%s", name, time.Now().Unix(), after[:min(len(after), 12)])
+	if _, err := r.Run(ctx, wtPath, "update-ref", ref, after, ""); err != nil {
+		// The changes are still in the stash list.
+		return "", err
+	}
+	// The stash list is shared by all worktrees; keep it free of backups.
+	_, _ = r.Run(ctx, wtPath, "stash", "drop", "--quiet")
+	return ref, nil
+}
+
+// MoveWorktree moves the worktree at wtPath to newPath, creating missing
+// parent directories first. Locked worktrees are refused with a KindLocked
+// *GitError unless force is set.
+func MoveWorktree(ctx context.Context, r Runner, repoDir, wtPath, newPath string, force bool) error {
+	if err := os.MkdirAll(filepath.Dir(newPath), 0o755); err != nil {
+		return err
+	}
+	args := []string{"worktree", "move"}
+	if force {
+		// A single --force does not override a lock.
+		args = append(args, "--force", "--force")
+	}
+	_, err := r.Run(ctx, repoDir, append(args, wtPath, newPath)...)
+	return err
+}
+
+// LockWorktree locks the worktree at wtPath so that git refuses to remove,
+// move or prune it. reason may be empty.
+func LockWorktree(ctx context.Context, r Runner, repoDir, wtPath, reason string) error {
+	args := []string{"worktree", "lock"}
+	if reason != "" {
+		args = append(args, "--reason", reason)
+	}
+	_, err := r.Run(ctx, repoDir, append(args, wtPath)...)
+	return err
+}
+
+// UnlockWorktree removes the lock from the worktree at wtPath.
+func UnlockWorktree(ctx context.Context, r Runner, repoDir, wtPath string) error {
+	_, err := r.Run(ctx, repoDir, "worktree", "unlock", wtPath)
+	return err
 }
 
 // PruneWorktrees cleans up stale worktree references.
-func PruneWorktrees(repoDir string) error {
-	_, err := run(repoDir, "worktree", "prune")
+func PruneWorktrees(ctx context.Context, r Runner, repoDir string) error {
+	_, err := r.Run(ctx, repoDir, "worktree", "prune")
 	return err
 }
@@ -1,8 +1,12 @@
 package git
 
 import (
+	"context"
+	"errors"
 	"os"
 	"path/filepath"
+	"slices"
+	"strings"
 	"testing"
 	"time"
 
@@ -90,11 +94,36 @@ func TestStatusText(t *testing.T) {
 			w:    Worktree{Untracked: 7},
 			want: "7 untracked",
 		},
+		{
+			name: "dirty submodules",
+			w:    Worktree{Modified: 1, DirtySubmodules: 2},
+			want: "1 modified, 2 dirty submodules",
+		},
 		{
 			name: "both modified and untracked",
 			w:    Worktree{Modified: 2, Untracked: 4},
 			want: "2 modified, 4 untracked",
 		},
+		{
+			name: "staged and modified",
+			w:    Worktree{Staged: 1, Modified: 2},
+			want: "1 staged, 2 modified",
+		},
+		{
+			name: "conflicted first",
+			w:    Worktree{Conflicted: 2, Staged: 1, Untracked: 1},
+			want: "2 conflicted, 1 staged, 1 untracked",
+		},
+		{
+			name: "status timed out",
+			w:    Worktree{StatusErr: context.DeadlineExceeded},
+			want: "status: timeout",
+		},
+		{
+			name: "status failed",
+			w:    Worktree{StatusErr: errors.New("boom")},
+			want: "status: unknown",
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -190,6 +219,77 @@ func TestIsClean(t *testing.T) {
 	}
 }
 
+func TestIsClean_StagedAndConflicted(t *testing.T) {
+	for _, w := range []Worktree{{Staged: 1}, {Conflicted: 1}} {
+		if w.IsClean() {
+			t.Errorf("IsClean() = true for %+v, want false", w)
+		}
+	}
+}
+
+func TestEnrichWorktree_ConflictedMerge(t *testing.T) {
+	dir := testutil.InitTestRepo(t)
+	wtPath := testutil.AddWorktree(t, dir, "feature")
+	testutil.WriteFile(t, wtPath, "README.md", "feature\n")
+	runGitHelper(t, wtPath, "commit", "-am", "feature change")
+	testutil.WriteFile(t, dir, "README.md", "main\n")
+	runGitHelper(t, dir, "commit", "-am", "main change")
+
+	// The merge stops with README.md conflicted.
+	if _, err := testRunner.Run(t.Context(), wtPath, "merge", "master"); err == nil {
+		t.Fatal("expected the merge to conflict")
+	}
+
+	wt := &Worktree{Path: wtPath, Branch: "refs/heads/feature"}
+	EnrichWorktree(t.Context(), testRunner, wt, EnrichOptions{DefaultBranch: "master"})
+
+	if wt.Conflicted != 1 {
+		t.Errorf("Conflicted = %d, want 1", wt.Conflicted)
+	}
+	if wt.Operation != OpMerge || wt.OperationText() != "merge in progress" {
+		t.Errorf("Operation = %q (%q), want merge in progress", wt.Operation, wt.OperationText())
+	}
+	if wt.IsClean() {
+		t.Error("expected a conflicted worktree not to be clean")
+	}
+}
+
+func TestDetectOperation(t *testing.T) {
+	dir := testutil.InitTestRepo(t)
+	wtPath := testutil.AddWorktree(t, dir, "feature")
+
+	if op := detectOperation(wtPath); op != OpNone {
+		t.Fatalf("detectOperation() on an idle worktree = %q, want none", op)
+	}
+
+	runGitHelper(t, wtPath, "bisect", "start")
+	if op := detectOperation(wtPath); op != OpBisect {
+		t.Errorf("detectOperation() during bisect = %q, want %q", op, OpBisect)
+	}
+	if op := detectOperation(dir); op != OpNone {
+		t.Errorf("detectOperation() on the main worktree = %q, want none", op)
+	}
+	runGitHelper(t, wtPath, "bisect", "reset")
+
+	gitDir, err := readGitFile(wtPath)
+	if err != nil {
+		t.Fatalf("readGitFile() error: %v", err)
+	}
+	if err := os.MkdirAll(filepath.Join(gitDir, "rebase-merge"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if op := detectOperation(wtPath); op != OpRebase {
+		t.Errorf("detectOperation() during rebase = %q, want %q", op, OpRebase)
+	}
+}
+
+func TestIsClean_StatusUnknown(t *testing.T) {
+	w := &Worktree{StatusErr: context.DeadlineExceeded}
+	if w.IsClean() {
+		t.Error("IsClean() = true for a worktree with unknown status, want false")
+	}
+}
+
 func TestInactiveDays(t *testing.T) {
 	tests := []struct {
 		name       string
@@ -242,7 +342,7 @@ func TestInactiveDays(t *testing.T) {
 func TestListWorktrees_MainOnly(t *testing.T) {
 	dir := testutil.InitTestRepo(t)
 
-	worktrees, err := ListWorktrees(dir)
+	worktrees, err := ListWorktrees(t.Context(), testRunner, dir)
 	if err != nil {
 		t.Fatalf("ListWorktrees() error: %v", err)
 	}
@@ -271,7 +371,7 @@ func TestListWorktrees_WithAdded(t *testing.T) {
 	_ = testutil.AddWorktree(t, dir, "feature-a")
 	_ = testutil.AddWorktree(t, dir, "feature-b")
 
-	worktrees, err := ListWorktrees(dir)
+	worktrees, err := ListWorktrees(t.Context(), testRunner, dir)
 	if err != nil {
 		t.Fatalf("ListWorktrees() error: %v", err)
 	}
@@ -291,29 +391,122 @@ func TestListWorktrees_WithAdded(t *testing.T) {
 	}
 }
 
+func TestListWorktrees_NestedCurrent(t *testing.T) {
+	dir := testutil.InitTestRepo(t)
+	nested := filepath.Join(dir, ".worktrees", "feature")
+	if _, err := testRunner.Run(t.Context(), dir, "worktree", "add", "-b", "feature", nested); err != nil {
+		t.Fatal(err)
+	}
+	t.Chdir(nested)
+
+	worktrees, err := ListWorktrees(t.Context(), testRunner, dir)
+	if err != nil {
+		t.Fatalf("ListWorktrees() error: %v", err)
+	}
+	for _, wt := range worktrees {
+		if want := wt.BranchShort() == "feature"; wt.IsCurrent != want {
+			t.Errorf("%s IsCurrent = %v, want %v", wt.BranchShort(), wt.IsCurrent, want)
+		}
+	}
+}
+
 func TestListWorktrees_InvalidDir(t *testing.T) {
-	_, err := ListWorktrees("/nonexistent/path")
+	_, err := ListWorktrees(t.Context(), testRunner, "/nonexistent/path")
 	if err == nil {
 		t.Error("expected error for nonexistent directory")
 	}
 }
 
+func TestParsePorcelain(t *testing.T) {
+	out := strings.Join([]string{
+		"worktree /repo",
+		"HEAD 1111111111111111111111111111111111111111",
+		"branch refs/heads/main",
+		"",
+		"worktree /tmp/odd\npath",
+		"HEAD 2222222222222222222222222222222222222222",
+		"branch refs/heads/odd",
+		"locked",
+		"",
+		"worktree /tmp/gone",
+		"HEAD 3333333333333333333333333333333333333333",
+		"branch refs/heads/gone",
+		"locked reason with spaces",
+		"prunable gitdir file points to non-existent location",
+		"",
+	}, "\x00")
+
+	worktrees := parsePorcelain(out, 0)
+	if len(worktrees) != 3 {
+		t.Fatalf("expected 3 worktrees, got %d", len(worktrees))
+	}
+
+	odd := worktrees[1]
+	if odd.Path != "/tmp/odd\npath" {
+		t.Errorf("Path = %q, want path containing a newline", odd.Path)
+	}
+	if !odd.IsLocked || odd.LockReason != "" {
+		t.Errorf("IsLocked, LockReason = %v, %q, want true, empty", odd.IsLocked, odd.LockReason)
+	}
+	if odd.IsPrunable {
+		t.Error("expected odd worktree not to be prunable")
+	}
+
+	gone := worktrees[2]
+	if !gone.IsLocked || gone.LockReason != "reason with spaces" {
+		t.Errorf("IsLocked, LockReason = %v, %q, want true, %q", gone.IsLocked, gone.LockReason, "reason with spaces")
+	}
+	if !gone.IsPrunable || gone.PrunableReason != "gitdir file points to non-existent location" {
+		t.Errorf("IsPrunable, PrunableReason = %v, %q", gone.IsPrunable, gone.PrunableReason)
+	}
+	if worktrees[0].IsLocked || worktrees[0].IsPrunable {
+		t.Error("expected main worktree to be neither locked nor prunable")
+	}
+}
+
+func TestListWorktrees_LockedAndPrunable(t *testing.T) {
+	dir := testutil.InitTestRepo(t)
+	lockedPath := testutil.AddWorktree(t, dir, "locked")
+	gonePath := testutil.AddWorktree(t, dir, "gone")
+	runGitHelper(t, dir, "worktree", "lock", "--reason", "usb drive", lockedPath)
+	t.Cleanup(func() {
+		_, _ = testRunner.Run(context.Background(), dir, "worktree", "unlock", lockedPath)
+	})
+	if err := os.RemoveAll(gonePath); err != nil {
+		t.Fatal(err)
+	}
+
+	worktrees, err := ListWorktrees(t.Context(), testRunner, dir)
+	if err != nil {
+		t.Fatalf("ListWorktrees() error: %v", err)
+	}
+
+	locked := findWorktreeByPath(t, worktrees, lockedPath)
+	if locked == nil || !locked.IsLocked || locked.LockReason != "usb drive" {
+		t.Errorf("expected locked worktree with reason %q, got %+v", "usb drive", locked)
+	}
+	gone := findWorktreeByPath(t, worktrees, gonePath)
+	if gone == nil || !gone.IsPrunable {
+		t.Errorf("expected prunable worktree, got %+v", gone)
+	}
+}
+
 func TestAddWorktree_NewBranch(t *testing.T) {
 	dir := testutil.InitTestRepo(t)
 	targetPath := filepath.Join(t.TempDir(), "new-feature")
 
-	err := AddWorktree(dir, targetPath, "new-feature", "")
+	err := AddWorktree(t.Context(), testRunner, dir, targetPath, "new-feature", "")
 	if err != nil {
 		t.Fatalf("AddWorktree() error: %v", err)
 	}
 	t.Cleanup(func() {
-		_, _ = run(dir, "worktree", "remove", "--force", targetPath)
+		_, _ = testRunner.Run(context.Background(), dir, "worktree", "remove", "--force", targetPath)
 	})
 
 	if _, err := os.Stat(targetPath); os.IsNotExist(err) {
 		t.Fatal("expected worktree directory to exist")
 	}
-	if !BranchExists(dir, "new-feature") {
+	if !BranchExists(t.Context(), testRunner, dir, "new-feature") {
 		t.Error("expected branch 'new-feature' to exist")
 	}
 }
@@ -323,19 +516,19 @@ func TestAddWorktree_ExistingBranch(t *testing.T) {
 	testutil.CreateBranch(t, dir, "existing-branch")
 	targetPath := filepath.Join(t.TempDir(), "existing-branch")
 
-	err := AddWorktree(dir, targetPath, "existing-branch", "")
+	err := AddWorktree(t.Context(), testRunner, dir, targetPath, "existing-branch", "")
 	if err != nil {
 		t.Fatalf("AddWorktree() error: %v", err)
 	}
 	t.Cleanup(func() {
-		_, _ = run(dir, "worktree", "remove", "--force", targetPath)
+		_, _ = testRunner.Run(context.Background(), dir, "worktree", "remove", "--force", targetPath)
 	})
 
 	if _, err := os.Stat(targetPath); os.IsNotExist(err) {
 		t.Fatal("expected worktree directory to exist")
 	}
 
-	worktrees, err := ListWorktrees(dir)
+	worktrees, err := ListWorktrees(t.Context(), testRunner, dir)
 	if err != nil {
 		t.Fatalf("ListWorktrees() error: %v", err)
 	}
@@ -358,18 +551,18 @@ func TestAddWorktree_WithBaseBranch(t *testing.T) {
 
 	targetPath := filepath.Join(t.TempDir(), "from-main")
 
-	err := AddWorktree(dir, targetPath, "from-main", "HEAD~1")
+	err := AddWorktree(t.Context(), testRunner, dir, targetPath, "from-main", "HEAD~1")
 	if err != nil {
 		t.Fatalf("AddWorktree() with baseBranch error: %v", err)
 	}
 	t.Cleanup(func() {
-		_, _ = run(dir, "worktree", "remove", "--force", targetPath)
+		_, _ = testRunner.Run(context.Background(), dir, "worktree", "remove", "--force", targetPath)
 	})
 
 	if _, err := os.Stat(targetPath); os.IsNotExist(err) {
 		t.Fatal("expected worktree directory to exist")
 	}
-	if !BranchExists(dir, "from-main") {
+	if !BranchExists(t.Context(), testRunner, dir, "from-main") {
 		t.Error("expected branch 'from-main' to exist")
 	}
 }
@@ -378,7 +571,7 @@ func TestRemoveWorktree_Basic(t *testing.T) {
 	dir := testutil.InitTestRepo(t)
 	wtPath := testutil.AddWorktree(t, dir, "to-remove")
 
-	err := RemoveWorktree(dir, wtPath, false)
+	_, err := RemoveWorktree(t.Context(), testRunner, dir, wtPath, RemoveOptions{})
 	if err != nil {
 		t.Fatalf("RemoveWorktree() error: %v", err)
 	}
@@ -388,7 +581,7 @@ func TestRemoveWorktree_Basic(t *testing.T) {
 	}
 
 	// Branch should still exist when deleteBranch is false
-	if !BranchExists(dir, "to-remove") {
+	if !BranchExists(t.Context(), testRunner, dir, "to-remove") {
 		t.Error("expected branch 'to-remove' to still exist")
 	}
 }
@@ -403,7 +596,7 @@ func TestRemoveWorktree_WithBranchDeletion(t *testing.T) {
 	// to ensure the match succeeds on platforms with symlinks (e.g. macOS).
 	resolvedWtPath := realAbs(t, wtPath)
 
-	err := RemoveWorktree(dir, resolvedWtPath, true)
+	_, err := RemoveWorktree(t.Context(), testRunner, dir, resolvedWtPath, RemoveOptions{DeleteBranch: true})
 	if err != nil {
 		t.Fatalf("RemoveWorktree() error: %v", err)
 	}
@@ -413,7 +606,7 @@ func TestRemoveWorktree_WithBranchDeletion(t *testing.T) {
 	}
 
 	// Branch should be deleted when deleteBranch is true
-	if BranchExists(dir, "delete-me") {
+	if BranchExists(t.Context(), testRunner, dir, "delete-me") {
 		t.Error("expected branch 'delete-me' to be deleted")
 	}
 }
@@ -427,7 +620,7 @@ func TestEnrichWorktree_Status(t *testing.T) {
 	// Modify an already-tracked file
 	testutil.WriteFile(t, dir, "README.md", "modified content\n")
 
-	worktrees, err := ListWorktrees(dir)
+	worktrees, err := ListWorktrees(t.Context(), testRunner, dir)
 	if err != nil {
 		t.Fatalf("ListWorktrees() error: %v", err)
 	}
@@ -436,7 +629,7 @@ func TestEnrichWorktree_Status(t *testing.T) {
 	}
 
 	wt := &worktrees[0]
-	EnrichWorktree(wt, "main")
+	EnrichWorktree(t.Context(), testRunner, wt, EnrichOptions{DefaultBranch: "main"})
 
 	if wt.Modified < 1 {
 		t.Errorf("expected Modified >= 1, got %d", wt.Modified)
@@ -453,7 +646,7 @@ func TestEnrichWorktree_MergedBranch(t *testing.T) {
 	dir := testutil.InitTestRepo(t)
 	wtPath := testutil.AddWorktree(t, dir, "merged-feature")
 
-	worktrees, err := ListWorktrees(dir)
+	worktrees, err := ListWorktrees(t.Context(), testRunner, dir)
 	if err != nil {
 		t.Fatalf("ListWorktrees() error: %v", err)
 	}
@@ -463,12 +656,12 @@ func TestEnrichWorktree_MergedBranch(t *testing.T) {
 		t.Fatal("could not find worktree for merged-feature")
 	}
 
-	defaultBranch, err := DefaultBranch(dir)
+	defaultBranch, err := DefaultBranch(t.Context(), testRunner, dir, nil)
 	if err != nil {
 		defaultBranch = "main"
 	}
 
-	EnrichWorktree(wt, defaultBranch)
+	EnrichWorktree(t.Context(), testRunner, wt, EnrichOptions{DefaultBranch: defaultBranch})
 
 	// Branch was created from the same commit as the default branch, so it
 	// should be considered merged.
@@ -482,7 +675,7 @@ func TestEnrichWorktree_UnmergedBranch(t *testing.T) {
 	wtPath := testutil.AddWorktree(t, dir, "unmerged-feature")
 	testutil.MakeCommit(t, wtPath, "diverge")
 
-	worktrees, err := ListWorktrees(dir)
+	worktrees, err := ListWorktrees(t.Context(), testRunner, dir)
 	if err != nil {
 		t.Fatalf("ListWorktrees() error: %v", err)
 	}
@@ -492,21 +685,194 @@ func TestEnrichWorktree_UnmergedBranch(t *testing.T) {
 		t.Fatal("could not find worktree for unmerged-feature")
 	}
 
-	defaultBranch, err := DefaultBranch(dir)
+	defaultBranch, err := DefaultBranch(t.Context(), testRunner, dir, nil)
 	if err != nil {
 		defaultBranch = "main"
 	}
 
-	EnrichWorktree(wt, defaultBranch)
+	EnrichWorktree(t.Context(), testRunner, wt, EnrichOptions{DefaultBranch: defaultBranch})
 
 	if wt.IsMerged {
 		t.Error("expected IsMerged = false for a branch with commits ahead of default")
 	}
 }
 
+func TestEnrichWorktree_MergeDetection(t *testing.T) {
+	tests := []struct {
+		name      string
+		land      func(t *testing.T, dir string) // lands "feature" on master
+		detection MergeDetection
+		want      MergeMethod
+	}{
+		{
+			name:      "merge commit",
+			land:      func(t *testing.T, dir string) { runGitHelper(t, dir, "merge", "--no-ff", "-m", "merge", "feature") },
+			detection: DetectSquash,
+			want:      MergedByAncestry,
+		},
+		{
+			name: "rebase merge",
+			land: func(t *testing.T, dir string) {
+				runGitHelper(t, dir, "cherry-pick", "master..feature")
+			},
+			detection: DetectSquash,
+			want:      MergedByRebase,
+		},
+		{
+			name: "squash merge",
+			land: func(t *testing.T, dir string) {
+				runGitHelper(t, dir, "merge", "--squash", "feature")
+				runGitHelper(t, dir, "commit", "-m", "squashed")
+			},
+			detection: DetectSquash,
+			want:      MergedBySquash,
+		},
+		{
+			name: "squash merge without detection",
+			land: func(t *testing.T, dir string) {
+				runGitHelper(t, dir, "merge", "--squash", "feature")
+				runGitHelper(t, dir, "commit", "-m", "squashed")
+			},
+			detection: DetectAncestry,
+			want:      "",
+		},
+		{
+			name:      "not landed",
+			land:      func(t *testing.T, dir string) {},
+			detection: DetectSquash,
+			want:      "",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := testutil.InitTestRepo(t)
+			runGitHelper(t, dir, "branch", "-M", "master")
+			wtPath := testutil.AddWorktree(t, dir, "feature")
+			testutil.MakeCommit(t, wtPath, "one")
+			testutil.MakeCommit(t, wtPath, "two")
+			// Let master move on so rewritten commits differ from the originals.
+			testutil.MakeCommit(t, dir, "unrelated")
+			tt.land(t, dir)
+			testutil.MakeCommit(t, dir, "later")
+
+			wt := &Worktree{Path: wtPath, Branch: "refs/heads/feature"}
+			EnrichWorktree(t.Context(), testRunner, wt, EnrichOptions{DefaultBranch: "master", MergeDetection: tt.detection})
+
+			if wt.MergedBy != tt.want || wt.IsMerged != (tt.want != "") {
+				t.Errorf("MergedBy = %q, IsMerged = %v; want %q", wt.MergedBy, wt.IsMerged, tt.want)
+			}
+		})
+	}
+}
+
+func TestEnrichWorktree_UpstreamState(t *testing.T) {
+	dir := testutil.InitTestRepo(t)
+	remote := testutil.InitTestRepo(t)
+	runGitHelper(t, dir, "remote", "add", "origin", remote)
+	wtPath := testutil.AddWorktree(t, dir, "feature")
+
+	enrich := func() *Worktree {
+		wt := &Worktree{Path: wtPath, Branch: "refs/heads/feature"}
+		EnrichWorktree(t.Context(), testRunner, wt, EnrichOptions{DefaultBranch: "master"})
+		return wt
+	}
+
+	if wt := enrich(); wt.Upstream != UpstreamNone || wt.UpstreamBranch != "" {
+		t.Errorf("without upstream: Upstream = %v (%q), want none", wt.Upstream, wt.UpstreamBranch)
+	}
+
+	runGitHelper(t, wtPath, "push", "-u", "origin", "feature")
+	if wt := enrich(); wt.Upstream != UpstreamTracking || wt.UpstreamBranch != "origin/feature" {
+		t.Errorf("after push: Upstream = %v (%q), want tracking origin/feature", wt.Upstream, wt.UpstreamBranch)
+	}
+
+	runGitHelper(t, wtPath, "push", "origin", "--delete", "feature")
+	if wt := enrich(); wt.Upstream != UpstreamGone || wt.UpstreamBranch != "origin/feature" {
+		t.Errorf("after remote delete: Upstream = %v (%q), want gone origin/feature", wt.Upstream, wt.UpstreamBranch)
+	}
+}
+
+func TestUpstreamState_String(t *testing.T) {
+	for state, want := range map[UpstreamState]string{
+		UpstreamNone:     "none",
+		UpstreamTracking: "tracking",
+		UpstreamGone:     "gone",
+	} {
+		if got := state.String(); got != want {
+			t.Errorf("UpstreamState(%d).String() = %q, want %q", state, got, want)
+		}
+	}
+}
+
+func TestMergedText(t *testing.T) {
+	tests := []struct {
+		wt   Worktree
+		want string
+	}{
+		{Worktree{}, ""},
+		{Worktree{IsMerged: true}, "merged"},
+		{Worktree{IsMerged: true, MergedBy: MergedByAncestry}, "merged"},
+		{Worktree{IsMerged: true, MergedBy: MergedBySquash}, "merged via squash"},
+		{Worktree{IsMerged: true, MergedBy: MergedByRebase}, "merged via rebase"},
+		{Worktree{IsMerged: true, MergedInto: "origin/main"}, "merged into origin/main"},
+		{Worktree{IsMerged: true, MergedInto: "release/1.0", MergedBy: MergedBySquash}, "merged into release/1.0 via squash"},
+	}
+	for _, tt := range tests {
+		if got := tt.wt.MergedText(); got != tt.want {
+			t.Errorf("MergedText() for %+v = %q, want %q", tt.wt, got, tt.want)
+		}
+	}
+}
+
+func TestEnrichWorktree_Timeout(t *testing.T) {
+	dir := testutil.InitTestRepo(t)
+
+	worktrees, err := ListWorktrees(t.Context(), testRunner, dir)
+	if err != nil {
+		t.Fatalf("ListWorktrees() error: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(t.Context(), time.Nanosecond)
+	defer cancel()
+	<-ctx.Done()
+
+	wt := &worktrees[0]
+	EnrichWorktree(ctx, testRunner, wt, EnrichOptions{DefaultBranch: "main"})
+
+	if !errors.Is(wt.StatusErr, context.DeadlineExceeded) {
+		t.Fatalf("StatusErr = %v, want context.DeadlineExceeded", wt.StatusErr)
+	}
+	if got := wt.StatusText(); got != "status: timeout" {
+		t.Errorf("StatusText() = %q, want %q", got, "status: timeout")
+	}
+	if !wt.LastCommit.IsZero() {
+		t.Error("expected remaining queries to be skipped after a status timeout")
+	}
+}
+
+func TestEnrichWorktrees_Cancelled(t *testing.T) {
+	dir := testutil.InitTestRepo(t)
+	_ = testutil.AddWorktree(t, dir, "feature")
+
+	worktrees, err := ListWorktrees(t.Context(), testRunner, dir)
+	if err != nil {
+		t.Fatalf("ListWorktrees() error: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(t.Context())
+	cancel()
+	EnrichWorktrees(ctx, testRunner, worktrees, EnrichOptions{DefaultBranch: "main"}, 2)
+
+	for _, wt := range worktrees {
+		if !wt.LastCommit.IsZero() {
+			t.Errorf("%s was enriched despite a cancelled context", wt.BranchShort())
+		}
+	}
+}
+
 func TestEnrichWorktree_BareSkipped(t *testing.T) {
 	w := &Worktree{IsBare: true}
-	EnrichWorktree(w, "main")
+	EnrichWorktree(t.Context(), testRunner, w, EnrichOptions{DefaultBranch: "main"})
 
 	if w.Modified != 0 || w.Untracked != 0 || !w.LastCommit.IsZero() {
 		t.Error("expected bare worktree to be unchanged after EnrichWorktree")
@@ -516,13 +882,13 @@ func TestEnrichWorktree_BareSkipped(t *testing.T) {
 func TestEnrichWorktree_LastCommitPopulated(t *testing.T) {
 	dir := testutil.InitTestRepo(t)
 
-	worktrees, err := ListWorktrees(dir)
+	worktrees, err := ListWorktrees(t.Context(), testRunner, dir)
 	if err != nil {
 		t.Fatalf("ListWorktrees() error: %v", err)
 	}
 
 	wt := &worktrees[0]
-	EnrichWorktree(wt, "main")
+	EnrichWorktree(t.Context(), testRunner, wt, EnrichOptions{DefaultBranch: "main"})
 
 	if wt.LastCommit.IsZero() {
 		t.Error("expected LastCommit to be populated after enrichment")
@@ -537,12 +903,12 @@ func TestEnrichWorktree_LastCommitPopulated(t *testing.T) {
 func TestPruneWorktrees(t *testing.T) {
 	dir := testutil.InitTestRepo(t)
 
-	err := PruneWorktrees(dir)
+	err := PruneWorktrees(t.Context(), testRunner, dir)
 	if err != nil {
 		t.Fatalf("PruneWorktrees() error: %v", err)
 	}
 
-	worktrees, err := ListWorktrees(dir)
+	worktrees, err := ListWorktrees(t.Context(), testRunner, dir)
 	if err != nil {
 		t.Fatalf("ListWorktrees() after prune error: %v", err)
 	}
@@ -560,7 +926,7 @@ func TestPruneWorktrees_StaleReference(t *testing.T) {
 		t.Fatalf("failed to remove worktree dir: %v", err)
 	}
 
-	before, err := ListWorktrees(dir)
+	before, err := ListWorktrees(t.Context(), testRunner, dir)
 	if err != nil {
 		t.Fatalf("ListWorktrees() error: %v", err)
 	}
@@ -568,12 +934,12 @@ func TestPruneWorktrees_StaleReference(t *testing.T) {
 		t.Fatalf("expected at least 2 worktrees before prune (including stale), got %d", len(before))
 	}
 
-	err = PruneWorktrees(dir)
+	err = PruneWorktrees(t.Context(), testRunner, dir)
 	if err != nil {
 		t.Fatalf("PruneWorktrees() error: %v", err)
 	}
 
-	after, err := ListWorktrees(dir)
+	after, err := ListWorktrees(t.Context(), testRunner, dir)
 	if err != nil {
 		t.Fatalf("ListWorktrees() after prune error: %v", err)
 	}
@@ -581,3 +947,337 @@ func TestPruneWorktrees_StaleReference(t *testing.T) {
 		t.Errorf("expected 1 worktree after pruning stale reference, got %d", len(after))
 	}
 }
+
+func TestEnrichWorktrees_PreservesOrder(t *testing.T) {
+	dir := testutil.InitTestRepo(t)
+	dirtyPath := testutil.AddWorktree(t, dir, "dirty")
+	_ = testutil.AddWorktree(t, dir, "clean")
+	testutil.WriteFile(t, dirtyPath, "untracked.txt", "untracked\n")
+
+	for _, parallelism := range []int{0, 1, 2, 16} {
+		worktrees, err := ListWorktrees(t.Context(), testRunner, dir)
+		if err != nil {
+			t.Fatalf("ListWorktrees() error: %v", err)
+		}
+		before := make([]string, len(worktrees))
+		for i, wt := range worktrees {
+			before[i] = wt.Path
+		}
+
+		EnrichWorktrees(t.Context(), testRunner, worktrees, EnrichOptions{DefaultBranch: "master"}, parallelism)
+
+		for i, wt := range worktrees {
+			if wt.Path != before[i] {
+				t.Errorf("parallelism=%d: worktrees[%d].Path = %q, want %q", parallelism, i, wt.Path, before[i])
+			}
+			if wt.LastCommit.IsZero() {
+				t.Errorf("parallelism=%d: %s not enriched", parallelism, wt.BranchShort())
+			}
+			wantUntracked := 0
+			if wt.BranchShort() == "dirty" {
+				wantUntracked = 1
+			}
+			if wt.Untracked != wantUntracked {
+				t.Errorf("parallelism=%d: %s Untracked = %d, want %d", parallelism, wt.BranchShort(), wt.Untracked, wantUntracked)
+			}
+		}
+	}
+}
+
+func TestEnrichWorktrees_Empty(t *testing.T) {
+	// Must not block or panic when there is nothing to do.
+	EnrichWorktrees(t.Context(), testRunner, nil, EnrichOptions{DefaultBranch: "main"}, 4)
+}
+
+func TestMoveWorktree(t *testing.T) {
+	dir := testutil.InitTestRepo(t)
+	wtPath := testutil.AddWorktree(t, dir, "movable")
+	newPath := filepath.Join(t.TempDir(), "nested", "movable")
+
+	if err := MoveWorktree(t.Context(), testRunner, dir, wtPath, newPath, false); err != nil {
+		t.Fatalf("MoveWorktree() error: %v", err)
+	}
+	if _, err := os.Stat(wtPath); !os.IsNotExist(err) {
+		t.Error("expected old worktree directory to be gone")
+	}
+	if wt := findWorktree(t, dir, newPath); wt.BranchShort() != "movable" {
+		t.Errorf("moved worktree branch = %q, want %q", wt.BranchShort(), "movable")
+	}
+}
+
+func TestMoveWorktree_Locked(t *testing.T) {
+	dir := testutil.InitTestRepo(t)
+	wtPath := testutil.AddWorktree(t, dir, "locked")
+	runGitHelper(t, dir, "worktree", "lock", wtPath)
+	newPath := filepath.Join(t.TempDir(), "locked")
+
+	err := MoveWorktree(t.Context(), testRunner, dir, wtPath, newPath, false)
+	if ErrorKindOf(err) != KindLocked {
+		t.Fatalf("MoveWorktree() on locked worktree = %v, want KindLocked", err)
+	}
+
+	if err := MoveWorktree(t.Context(), testRunner, dir, wtPath, newPath, true); err != nil {
+		t.Fatalf("MoveWorktree(force) on locked worktree error: %v", err)
+	}
+	if wt := findWorktree(t, dir, newPath); !wt.IsLocked {
+		t.Error("expected moved worktree to stay locked")
+	}
+	runGitHelper(t, dir, "worktree", "unlock", newPath)
+}
+
+func TestLockAndUnlockWorktree(t *testing.T) {
+	dir := testutil.InitTestRepo(t)
+	wtPath := testutil.AddWorktree(t, dir, "usb")
+
+	if err := LockWorktree(t.Context(), testRunner, dir, wtPath, "usb drive"); err != nil {
+		t.Fatalf("LockWorktree() error: %v", err)
+	}
+	wt := findWorktree(t, dir, wtPath)
+	if !wt.IsLocked || wt.LockReason != "usb drive" {
+		t.Fatalf("after lock: IsLocked = %v, LockReason = %q", wt.IsLocked, wt.LockReason)
+	}
+
+	err := LockWorktree(t.Context(), testRunner, dir, wtPath, "")
+	if ErrorKindOf(err) != KindLocked {
+		t.Errorf("LockWorktree() on locked worktree = %v, want KindLocked", err)
+	}
+
+	if err := UnlockWorktree(t.Context(), testRunner, dir, wtPath); err != nil {
+		t.Fatalf("UnlockWorktree() error: %v", err)
+	}
+	if wt := findWorktree(t, dir, wtPath); wt.IsLocked {
+		t.Error("expected worktree to be unlocked")
+	}
+}
+
+// findWorktree returns the listed worktree whose path resolves to wtPath.
+func findWorktree(t *testing.T, dir, wtPath string) Worktree {
+	t.Helper()
+	worktrees, err := ListWorktrees(t.Context(), testRunner, dir)
+	if err != nil {
+		t.Fatalf("ListWorktrees() error: %v", err)
+	}
+	want, _ := filepath.EvalSymlinks(wtPath)
+	for _, wt := range worktrees {
+		if got, _ := filepath.EvalSymlinks(wt.Path); got == want {
+			return wt
+		}
+	}
+	t.Fatalf("worktree %s not listed", wtPath)
+	return Worktree{}
+}
+
+func TestBranchCommitTimes(t *testing.T) {
+	dir := testutil.InitTestRepo(t)
+	testutil.CreateBranch(t, dir, "feature")
+
+	times, err := BranchCommitTimes(t.Context(), testRunner, dir)
+	if err != nil {
+		t.Fatalf("BranchCommitTimes() error: %v", err)
+	}
+	if len(times) != 2 {
+		t.Fatalf("BranchCommitTimes() = %v, want master and feature", times)
+	}
+	if times["feature"].IsZero() || !times["feature"].Equal(times["master"]) {
+		t.Errorf("feature time = %v, want the same commit time as master (%v)", times["feature"], times["master"])
+	}
+}
+
+func TestMergedBranches(t *testing.T) {
+	dir := testutil.InitTestRepo(t)
+	testutil.CreateBranch(t, dir, "merged")
+	wtPath := testutil.AddWorktree(t, dir, "unmerged")
+	testutil.MakeCommit(t, wtPath, "not on master")
+
+	merged, err := MergedBranches(t.Context(), testRunner, dir, "master")
+	if err != nil {
+		t.Fatalf("MergedBranches() error: %v", err)
+	}
+	if !merged["merged"] || !merged["master"] || merged["unmerged"] {
+		t.Errorf("MergedBranches() = %v, want master and merged only", merged)
+	}
+
+	only, err := MergedBranches(t.Context(), testRunner, dir, "master", "refs/heads/merged")
+	if err != nil {
+		t.Fatalf("MergedBranches(pattern) error: %v", err)
+	}
+	if len(only) != 1 || !only["merged"] {
+		t.Errorf("MergedBranches(pattern) = %v, want only merged", only)
+	}
+}
+
+func TestBranchNamesAmbiguousWithTags(t *testing.T) {
+	dir := testutil.InitTestRepo(t)
+	testutil.CreateBranch(t, dir, "v1")
+	runGitHelper(t, dir, "tag", "v1")
+
+	// %(refname:short) would print heads/v1 here.
+	merged, err := MergedBranches(t.Context(), testRunner, dir, "master")
+	if err != nil {
+		t.Fatalf("MergedBranches() error: %v", err)
+	}
+	if !merged["v1"] {
+		t.Errorf("MergedBranches() = %v, want v1", merged)
+	}
+	times, err := BranchCommitTimes(t.Context(), testRunner, dir)
+	if err != nil {
+		t.Fatalf("BranchCommitTimes() error: %v", err)
+	}
+	if times["v1"].IsZero() {
+		t.Errorf("BranchCommitTimes() = %v, want v1", times)
+	}
+	refs, err := ExpandRefPatterns(t.Context(), testRunner, dir, []string{"v*"})
+	if err != nil {
+		t.Fatalf("ExpandRefPatterns() error: %v", err)
+	}
+	if !slices.Equal(refs, []string{"v1"}) {
+		t.Errorf("ExpandRefPatterns() = %v, want [v1]", refs)
+	}
+}
+
+func TestMergedIntoTargets(t *testing.T) {
+	dir := testutil.InitTestRepo(t)
+	testutil.CreateBranch(t, dir, "old")
+	wtPath := testutil.AddWorktree(t, dir, "release/1.0")
+	testutil.MakeCommit(t, wtPath, "release fix")
+	testutil.CreateBranch(t, wtPath, "hotfix")
+
+	got := MergedIntoTargets(t.Context(), testRunner, dir, []string{"master", "missing", "release/1.0"})
+	if got["old"] != "master" {
+		t.Errorf("old merged into %q, want master (first target wins)", got["old"])
+	}
+	if got["hotfix"] != "release/1.0" {
+		t.Errorf("hotfix merged into %q, want release/1.0", got["hotfix"])
+	}
+}
+
+func TestEnrichOptions_IsTarget(t *testing.T) {
+	opts := EnrichOptions{
+		DefaultBranch: "main",
+		MergeTargets:  []string{"origin/develop", "origin/release/2.0", "release/1.0"},
+		Remotes:       []string{"origin"},
+	}
+	for branch, want := range map[string]bool{
+		"main":        true,
+		"develop":     true,
+		"release/1.0": true,
+		"release/2.0": true,
+		"feature":     false,
+		// release/1.0 is a local branch, not 1.0 on a remote "release".
+		"1.0": false,
+	} {
+		if got := opts.isTarget(branch); got != want {
+			t.Errorf("isTarget(%q) = %v, want %v", branch, got, want)
+		}
+	}
+}
+
+func TestEnrichWorktree_DirtySubmodule(t *testing.T) {
+	dir := testutil.InitTestRepo(t)
+	testutil.AddSubmodule(t, dir, "libs/sub")
+	testutil.WriteFile(t, filepath.Join(dir, "libs/sub"), "README.md", "changed\n")
+
+	wt := &Worktree{Path: dir, Branch: "refs/heads/master"}
+	EnrichWorktree(t.Context(), testRunner, wt, EnrichOptions{DefaultBranch: "master"})
+	if wt.DirtySubmodules != 1 || wt.Modified != 0 {
+		t.Errorf("DirtySubmodules = %d, Modified = %d, want 1 and 0", wt.DirtySubmodules, wt.Modified)
+	}
+	if wt.IsClean() {
+		t.Error("IsClean() = true for a worktree with a dirty submodule")
+	}
+	if got := wt.StatusText(); got != "1 dirty submodule" {
+		t.Errorf("StatusText() = %q, want %q", got, "1 dirty submodule")
+	}
+}
+
+func TestUpdateSubmodules(t *testing.T) {
+	for _, reuse := range []bool{false, true} {
+		dir := testutil.InitTestRepo(t)
+		testutil.AddSubmodule(t, dir, "libs/sub")
+		wtPath := testutil.AddWorktree(t, dir, "feature")
+
+		subs, err := UpdateSubmodules(t.Context(), testRunner, wtPath, reuse)
+		if err != nil {
+			t.Fatalf("reuse=%v: UpdateSubmodules() error: %v", reuse, err)
+		}
+		if len(subs) != 1 || subs[0].Path != "libs/sub" {
+			t.Errorf("reuse=%v: UpdateSubmodules() = %+v, want libs/sub", reuse, subs)
+		}
+		if _, err := os.Stat(filepath.Join(wtPath, "libs/sub/README.md")); err != nil {
+			t.Errorf("reuse=%v: submodule not checked out: %v", reuse, err)
+		}
+	}
+}
+
+func TestUpdateSubmodules_NoSubmodules(t *testing.T) {
+	dir := testutil.InitTestRepo(t)
+	subs, err := UpdateSubmodules(t.Context(), testRunner, dir, true)
+	if err != nil || subs != nil {
+		t.Errorf("UpdateSubmodules() = %v, %v, want nothing", subs, err)
+	}
+}
+
+func TestRemoveWorktree_WithSubmodules(t *testing.T) {
+	dir := testutil.InitTestRepo(t)
+	testutil.AddSubmodule(t, dir, "libs/sub")
+	wtPath := testutil.AddWorktree(t, dir, "feature")
+	if _, err := UpdateSubmodules(t.Context(), testRunner, wtPath, true); err != nil {
+		t.Fatalf("UpdateSubmodules() error: %v", err)
+	}
+
+	// Changes inside a submodule cannot be backed up, so they are refused.
+	subPath := filepath.Join(wtPath, "libs/sub")
+	testutil.WriteFile(t, subPath, "README.md", "changed\n")
+	if _, err := RemoveWorktree(t.Context(), testRunner, dir, wtPath, RemoveOptions{}); ErrorKindOf(err) != KindDirty {
+		t.Fatalf("RemoveWorktree() with a dirty submodule = %v, want KindDirty", err)
+	}
+
+	runGitHelper(t, subPath, "checkout", "README.md")
+	testutil.WriteFile(t, wtPath, "untracked.txt", "x\n")
+	rm, err := RemoveWorktree(t.Context(), testRunner, dir, wtPath, RemoveOptions{})
+	if err != nil {
+		t.Fatalf("RemoveWorktree() error: %v", err)
+	}
+	if rm.Backup == "" {
+		t.Error("expected the untracked file to be backed up")
+	}
+	if _, err := os.Stat(wtPath); !os.IsNotExist(err) {
+		t.Error("expected worktree with submodules to be removed")
+	}
+}
+
+func TestAddSparseWorktree(t *testing.T) {
+	dir := testutil.InitTestRepo(t)
+	testutil.WriteFile(t, dir, "apps/web/index.html", "web\n")
+	testutil.WriteFile(t, dir, "apps/api/main.go", "package main\n")
+	runGitHelper(t, dir, "add", ".")
+	runGitHelper(t, dir, "commit", "-m", "apps")
+	targetPath := filepath.Join(t.TempDir(), "web")
+
+	if err := AddSparseWorktree(t.Context(), testRunner, dir, targetPath, "web", "", []string{"apps/web"}); err != nil {
+		t.Fatalf("AddSparseWorktree() error: %v", err)
+	}
+	t.Cleanup(func() {
+		_, _ = testRunner.Run(context.Background(), dir, "worktree", "remove", "--force", targetPath)
+	})
+
+	for path, want := range map[string]bool{"README.md": true, "apps/web/index.html": true, "apps/api/main.go": false} {
+		if _, err := os.Stat(filepath.Join(targetPath, path)); (err == nil) != want {
+			t.Errorf("%s checked out = %v, want %v", path, err == nil, want)
+		}
+	}
+
+	worktrees, err := ListWorktrees(t.Context(), testRunner, dir)
+	if err != nil {
+		t.Fatalf("ListWorktrees() error: %v", err)
+	}
+	EnrichWorktrees(t.Context(), testRunner, worktrees, EnrichOptions{DefaultBranch: "master"}, 1)
+	for _, wt := range worktrees {
+		if wantSparse := wt.BranchShort() == "web"; wt.IsSparse != wantSparse {
+			t.Errorf("%s IsSparse = %v, want %v", wt.BranchShort(), wt.IsSparse, wantSparse)
+		}
+		if !wt.IsClean() {
+			t.Errorf("%s status = %q, want clean", wt.BranchShort(), wt.StatusText())
+		}
+	}
+}
@@ -8,8 +8,10 @@ import (
 )
 
 // BuildTags returns a formatted tag string for a worktree, showing status
-// indicators like [current], [merged], [3 modified, 1 untracked], sync info,
-// and staleness warnings. Used by both the deletion TUI and the selector TUI.
+// indicators such as [current], [merged], [gone], [locked] and [sparse], local
+// changes such as [3 modified, 1 untracked], an operation in progress, sync
+// info and staleness warnings. Used by both the deletion TUI and the selector
+// TUI.
 func BuildTags(wt git.Worktree) string {
 	var tags []string
 
@@ -21,8 +23,28 @@ func BuildTags(wt git.Worktree) string {
 		tags = append(tags, dirtyStyle.Render(wt.StatusText()))
 	}
 
+	if wt.Operation != git.OpNone {
+		tags = append(tags, staleStyle.Render(wt.OperationText()))
+	}
+
 	if wt.IsMerged {
-		tags = append(tags, mergedStyle.Render("merged"))
+		tags = append(tags, mergedStyle.Render(wt.MergedText()))
+	}
+
+	if wt.Upstream == git.UpstreamGone {
+		tags = append(tags, staleStyle.Render("gone"))
+	}
+
+	if wt.IsLocked {
+		tags = append(tags, lockedStyle.Render("locked"))
+	}
+
+	if wt.IsPrunable {
+		tags = append(tags, staleStyle.Render("prunable"))
+	}
+
+	if wt.IsSparse {
+		tags = append(tags, dimStyle.Render("sparse"))
 	}
 
 	sync := wt.SyncText()
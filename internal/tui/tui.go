@@ -1,6 +1,7 @@
 package tui
 
 import (
+	"context"
 	"fmt"
 	"strings"
 
@@ -24,6 +25,7 @@ var (
 	dirtyStyle    = lipgloss.NewStyle().Foreground(lipgloss.Color("214"))
 	mergedStyle   = lipgloss.NewStyle().Foreground(lipgloss.Color("114"))
 	staleStyle    = lipgloss.NewStyle().Foreground(lipgloss.Color("196"))
+	lockedStyle   = lipgloss.NewStyle().Foreground(lipgloss.Color("75"))
 	checkStyle    = lipgloss.NewStyle().Foreground(lipgloss.Color("212"))
 	helpStyle     = lipgloss.NewStyle().Foreground(lipgloss.Color("241"))
 
@@ -44,13 +46,21 @@ type item struct {
 	checked  bool
 }
 
+// RemoveFunc removes a worktree marked for removal and returns the backup
+// ref its local changes were saved to, if any.
+type RemoveFunc func(ctx context.Context, wt git.Worktree) (backup string, err error)
+
 type model struct {
+	ctx           context.Context
+	runner        git.Runner
+	remove        RemoveFunc
 	items         []item
 	cursor        int
 	mode          mode
 	confirmCursor int // 0=No, 1=Yes
 	repoDir       string
 	removed       []string
+	backups       []string
 	errors        []string
 	width         int
 	height        int
@@ -62,14 +72,22 @@ func New(worktrees []git.Worktree, repoDir string) model {
 		items[i] = item{worktree: wt}
 	}
 	return model{
+		ctx:     context.Background(),
+		runner:  &git.ExecRunner{},
 		items:   items,
 		repoDir: repoDir,
 	}
 }
 
-func Run(worktrees []git.Worktree, repoDir string) error {
+// Run starts the interactive worktree manager. Git commands are issued through
+// r; ctx bounds them and terminates the program when cancelled. Worktrees
+// marked for removal are removed with remove.
+func Run(ctx context.Context, r git.Runner, worktrees []git.Worktree, repoDir string, remove RemoveFunc) error {
 	m := New(worktrees, repoDir)
-	p := tea.NewProgram(m, tea.WithAltScreen())
+	m.ctx = ctx
+	m.runner = r
+	m.remove = remove
+	p := tea.NewProgram(m, tea.WithAltScreen(), tea.WithContext(ctx))
 	_, err := p.Run()
 	return err
 }
@@ -113,15 +131,15 @@ func (m model) updateList(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 		}
 
 	case " ", "x":
-		// Don't allow selecting current worktree
-		if !m.items[m.cursor].worktree.IsCurrent {
+		// Don't allow selecting current or locked worktrees
+		if selectable(m.items[m.cursor].worktree) {
 			m.items[m.cursor].checked = !m.items[m.cursor].checked
 		}
 
 	case "a":
-		// Select all non-current merged worktrees
+		// Select all selectable merged worktrees
 		for i := range m.items {
-			if !m.items[i].worktree.IsCurrent && m.items[i].worktree.IsMerged {
+			if selectable(m.items[i].worktree) && m.items[i].worktree.IsMerged {
 				m.items[i].checked = true
 			}
 		}
@@ -181,18 +199,38 @@ func (m model) executeRemoval() (tea.Model, tea.Cmd) {
 		}
 		wt := m.items[i].worktree
 		branch := wt.BranchShort()
-		deleteBranch := wt.IsMerged
-		if err := git.RemoveWorktree(m.repoDir, wt.Path, deleteBranch); err != nil {
-			m.errors = append(m.errors, fmt.Sprintf("%s: %v", branch, err))
+		backup, err := m.removeWorktree(wt)
+		if backup != "" {
+			m.backups = append(m.backups, backup)
+		}
+		if err != nil {
+			m.errors = append(m.errors, fmt.Sprintf("%s: %s", branch, git.Describe(err)))
 		} else {
 			m.removed = append(m.removed, branch)
 		}
 	}
-	_ = git.PruneWorktrees(m.repoDir)
+	_ = git.PruneWorktrees(m.ctx, m.runner, m.repoDir)
 	m.mode = modeDone
 	return m, nil
 }
 
+// removeWorktree removes wt with the configured RemoveFunc, falling back to
+// the default removal options when none was given.
+func (m model) removeWorktree(wt git.Worktree) (string, error) {
+	if m.remove != nil {
+		return m.remove(m.ctx, wt)
+	}
+	rm, err := git.RemoveWorktree(m.ctx, m.runner, m.repoDir, wt.Path, git.RemoveOptions{DeleteBranch: wt.IsMerged})
+	return rm.Backup, err
+}
+
+// selectable reports whether a worktree may be marked for removal. The current
+// worktree cannot be removed, locked worktrees must be unlocked first, and a
+// rebase or similar operation in progress must be finished or aborted.
+func selectable(wt git.Worktree) bool {
+	return !wt.IsCurrent && !wt.IsLocked && wt.Operation == git.OpNone
+}
+
 func (m model) selectedCount() int {
 	count := 0
 	for _, it := range m.items {
@@ -235,6 +273,8 @@ func (m model) viewList() string {
 		}
 		if wt.IsCurrent {
 			check = currentStyle.Render("◆")
+		} else if wt.IsLocked {
+			check = lockedStyle.Render("⊘")
 		}
 
 		// Branch name
@@ -335,6 +375,9 @@ func (m model) viewDone() string {
 	}
 
 	b.WriteString(fmt.Sprintf("\n  Removed %d worktree(s).\n", len(m.removed)))
+	for _, ref := range m.backups {
+		b.WriteString(fmt.Sprintf("  Local changes saved to %s; restore with: git stash apply %s\n", ref, ref))
+	}
 	b.WriteString(helpStyle.Render("\n  Press any key to exit."))
 	b.WriteString("\n")
 
@@ -1,6 +1,7 @@
 package tui
 
 import (
+	"context"
 	"strings"
 	"testing"
 	"time"
@@ -8,6 +9,7 @@ import (
 	tea "github.com/charmbracelet/bubbletea"
 
 	"github.com/yasomaru/git-wt/internal/git"
+	"github.com/yasomaru/git-wt/internal/git/gittest"
 )
 
 // testWorktrees returns a reusable slice of worktrees for test setup.
@@ -229,6 +231,63 @@ func TestToggleSelection(t *testing.T) {
 	})
 }
 
+func TestLockedWorktreeNotSelectable(t *testing.T) {
+	t.Parallel()
+
+	wts := testWorktrees()
+	wts[1].IsLocked = true // feature-a (merged)
+	wts[1].LockReason = "usb drive"
+
+	t.Run("space does not toggle locked worktree", func(t *testing.T) {
+		t.Parallel()
+		m := New(wts, "/repo")
+		m.cursor = 1
+
+		m = updateModel(t, m, specialKeyMsg(tea.KeySpace))
+		if m.items[1].checked {
+			t.Error("after space on locked: item[1].checked = true, want false")
+		}
+	})
+
+	t.Run("a skips locked merged worktree", func(t *testing.T) {
+		t.Parallel()
+		m := New(wts, "/repo")
+
+		m = updateModel(t, m, keyMsg('a'))
+		if m.items[1].checked {
+			t.Error("item[1] (locked) should not be selected by 'a'")
+		}
+	})
+
+	t.Run("view marks locked worktree", func(t *testing.T) {
+		t.Parallel()
+		m := New(wts, "/repo")
+
+		if !strings.Contains(m.View(), "⊘") {
+			t.Error("expected locked marker in view")
+		}
+	})
+}
+
+func TestBusyWorktreeNotSelectable(t *testing.T) {
+	t.Parallel()
+
+	wts := testWorktrees()
+	wts[1].Operation = git.OpRebase // feature-a (merged)
+
+	m := New(wts, "/repo")
+	m.cursor = 1
+	m = updateModel(t, m, specialKeyMsg(tea.KeySpace))
+	if m.items[1].checked {
+		t.Error("after space on a worktree mid-rebase: item[1].checked = true, want false")
+	}
+
+	m = updateModel(t, m, keyMsg('a'))
+	if m.items[1].checked {
+		t.Error("item[1] (mid-rebase) should not be selected by 'a'")
+	}
+}
+
 func TestSelectAllMerged(t *testing.T) {
 	t.Parallel()
 
@@ -422,6 +481,39 @@ func TestConfirmYes(t *testing.T) {
 	}
 }
 
+func TestExecuteRemovalUsesRemoveFunc(t *testing.T) {
+	t.Parallel()
+
+	m := New(testWorktrees(), "/repo")
+	m.runner = gittest.NewFakeRunner()
+	m.remove = func(_ context.Context, wt git.Worktree) (string, error) {
+		switch wt.BranchShort() {
+		case "feature-b":
+			return "", &git.GitError{Kind: git.KindDirty}
+		case "feature-c":
+			return "refs/wt-backup/feature-c/1700000000", nil
+		}
+		return "", nil
+	}
+	m.items[1].checked = true
+	m.items[2].checked = true
+	m.items[3].checked = true
+	m.mode = modeConfirm
+
+	m = updateModel(t, m, keyMsg('y'))
+
+	if len(m.removed) != 2 || m.removed[0] != "feature-a" || m.removed[1] != "feature-c" {
+		t.Errorf("removed = %v, want [feature-a feature-c]", m.removed)
+	}
+	if len(m.errors) != 1 || !strings.HasPrefix(m.errors[0], "feature-b:") {
+		t.Errorf("errors = %v, want a single feature-b failure", m.errors)
+	}
+	view := m.View()
+	if !strings.Contains(view, "git stash apply refs/wt-backup/feature-c/1700000000") {
+		t.Errorf("viewDone output missing restore hint:\n%s", view)
+	}
+}
+
 func TestConfirmNo(t *testing.T) {
 	t.Parallel()
 
@@ -874,6 +966,42 @@ func TestBuildTagsFunction(t *testing.T) {
 		}
 	})
 
+	t.Run("sparse worktree", func(t *testing.T) {
+		t.Parallel()
+		wt := git.Worktree{Branch: "refs/heads/feat", IsSparse: true}
+		tags := BuildTags(wt)
+		if !strings.Contains(tags, "sparse") {
+			t.Errorf("BuildTags missing 'sparse', got %q", tags)
+		}
+	})
+
+	t.Run("operation in progress", func(t *testing.T) {
+		t.Parallel()
+		wt := git.Worktree{Branch: "refs/heads/feat", Operation: git.OpRebase, Conflicted: 1}
+		tags := BuildTags(wt)
+		if !strings.Contains(tags, "rebase in progress") || !strings.Contains(tags, "1 conflicted") {
+			t.Errorf("BuildTags missing operation or conflicts, got %q", tags)
+		}
+	})
+
+	t.Run("gone upstream", func(t *testing.T) {
+		t.Parallel()
+		wt := git.Worktree{Branch: "refs/heads/feat", Upstream: git.UpstreamGone}
+		tags := BuildTags(wt)
+		if !strings.Contains(tags, "gone") {
+			t.Errorf("BuildTags missing 'gone', got %q", tags)
+		}
+	})
+
+	t.Run("squash merged worktree", func(t *testing.T) {
+		t.Parallel()
+		wt := git.Worktree{Branch: "refs/heads/feat", IsMerged: true, MergedBy: git.MergedBySquash}
+		tags := BuildTags(wt)
+		if !strings.Contains(tags, "merged via squash") {
+			t.Errorf("BuildTags missing 'merged via squash', got %q", tags)
+		}
+	})
+
 	t.Run("dirty worktree", func(t *testing.T) {
 		t.Parallel()
 		wt := git.Worktree{Branch: "refs/heads/feat", Modified: 2, Untracked: 1}
@@ -903,6 +1031,24 @@ func TestBuildTagsFunction(t *testing.T) {
 			t.Errorf("BuildTags missing 'stale', got %q", tags)
 		}
 	})
+
+	t.Run("locked worktree", func(t *testing.T) {
+		t.Parallel()
+		wt := git.Worktree{Branch: "refs/heads/usb", IsLocked: true, LockReason: "usb drive"}
+		tags := BuildTags(wt)
+		if !strings.Contains(tags, "locked") {
+			t.Errorf("BuildTags missing 'locked', got %q", tags)
+		}
+	})
+
+	t.Run("prunable worktree", func(t *testing.T) {
+		t.Parallel()
+		wt := git.Worktree{Branch: "refs/heads/gone", IsPrunable: true}
+		tags := BuildTags(wt)
+		if !strings.Contains(tags, "prunable") {
+			t.Errorf("BuildTags missing 'prunable', got %q", tags)
+		}
+	})
 }
 
 // ===========================================================================
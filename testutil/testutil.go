@@ -42,6 +42,21 @@ func AddWorktree(t *testing.T, dir, branch string) string {
 	return wtPath
 }
 
+// AddSubmodule creates a repository with a single commit and adds it as a
+// submodule at path of the repo at dir. Submodules are cloned from local
+// paths, which git only allows when protocol.file.allow is set, so the test
+// must not run in parallel.
+func AddSubmodule(t *testing.T, dir, path string) {
+	t.Helper()
+	t.Setenv("GIT_CONFIG_COUNT", "1")
+	t.Setenv("GIT_CONFIG_KEY_0", "protocol.file.allow")
+	t.Setenv("GIT_CONFIG_VALUE_0", "always")
+
+	sub := InitTestRepo(t)
+	runGit(t, dir, "submodule", "add", sub, path)
+	runGit(t, dir, "commit", "-m", "add submodule "+path)
+}
+
 // MakeCommit creates a new commit with a dummy file change.
 func MakeCommit(t *testing.T, dir, message string) {
 	t.Helper()